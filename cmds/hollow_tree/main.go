@@ -0,0 +1,130 @@
+// Command hollow_tree hollows out a tree for 3D printing, leaving walls of a
+// fixed thickness and optional drain holes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var thickness float64
+	var meshPath string
+	var numSamples int
+	var depth int
+	var axisResolution int
+	var offsetWeight float64
+	var checkRays int
+	var drainHoles flagDrainHoles
+	var meshScale float64
+	var centerMesh bool
+	flag.Float64Var(&thickness, "thickness", 0, "wall thickness (required)")
+	flag.StringVar(&meshPath, "mesh", "",
+		"optional mesh file to compute distances from (default is to use the tree itself)")
+	flag.IntVar(&numSamples, "samples", 1000000, "number of points to sample to fit the offset")
+	flag.IntVar(&depth, "depth", 16, "maximum depth of the offset tree")
+	flag.IntVar(&axisResolution, "axis-resolution", 2,
+		"number of icosphere subdivisions to do when creating split axes")
+	flag.Float64Var(&offsetWeight, "offset-weight", 0.5,
+		"relative weight of interior samples when fitting the offset; less than 1 thickens walls")
+	flag.IntVar(&checkRays, "check-rays", 100000,
+		"number of rays to cast when checking wall thickness")
+	flag.Var(&drainHoles, "drain-hole",
+		"drain hole as 'x,y,z,dx,dy,dz,radius', starting inside the solid (may be repeated)")
+	flag.Float64Var(&meshScale, "mesh-scale", 1,
+		"scale to apply to the mesh (should match the value used to build the tree)")
+	flag.BoolVar(&centerMesh, "center-mesh", false,
+		"center the mesh bounds at the origin before scaling (should match the tree)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hollow_tree [flags] <input.bin> <output.bin>")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 || thickness <= 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(inputPath, treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	var sdf model3d.SDF
+	if meshPath != "" {
+		log.Println("Loading mesh...")
+		tris, err := treed.LoadMesh(meshPath)
+		essentials.Must(err)
+		mesh, removed := treed.PrepareMesh(tris, meshScale, centerMesh)
+		if removed > 0 {
+			log.Printf(" - removed %d degenerate triangles", removed)
+		}
+		sdf = model3d.MeshToSDF(mesh)
+	} else {
+		sdf = treed.NewSDF(tree)
+	}
+
+	log.Println("Checking wall thickness...")
+	report := treed.CheckWallThickness(tree, thickness, checkRays)
+	log.Printf(" => %d/%d surface samples are thinner than %f (thinnest is %f at %v)",
+		len(report.Violations), report.NumSamples, thickness, report.Thinnest.Thickness,
+		report.Thinnest.Point)
+
+	log.Println("Hollowing tree...")
+	shell := &treed.Shell{
+		Thickness:  thickness,
+		Axes:       treed.NewConstantAxisScheduleIcosphere(axisResolution).Init(),
+		Loss:       treed.EntropySplitLoss[float64]{PositiveWeight: offsetWeight},
+		MaxDepth:   depth,
+		NumSamples: numSamples,
+		DrainHoles: drainHoles,
+	}
+	hollow := shell.Hollow(tree, sdf)
+	log.Printf(" => leaves: %d -> %d", tree.Tree.NumLeaves(), hollow.Tree.NumLeaves())
+
+	log.Println("Saving output...")
+	essentials.Must(treed.Save(outputPath, hollow, treed.WriteBoundedSolidTree))
+}
+
+type flagDrainHoles []*treed.DrainHole
+
+func (f *flagDrainHoles) String() string {
+	parts := make([]string, len(*f))
+	for i, h := range *f {
+		parts[i] = fmt.Sprintf("%f,%f,%f,%f,%f,%f,%f", h.Origin.X, h.Origin.Y, h.Origin.Z,
+			h.Direction.X, h.Direction.Y, h.Direction.Z, h.Radius)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *flagDrainHoles) Set(value string) error {
+	parts := strings.Split(value, ",")
+	if len(parts) != 7 {
+		return fmt.Errorf("expected 7 comma-separated values but got %d", len(parts))
+	}
+	var values [7]float64
+	for i, part := range parts {
+		parsed, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected part %q: %w", part, err)
+		}
+		values[i] = parsed
+	}
+	*f = append(*f, &treed.DrainHole{
+		Origin:    model3d.XYZ(values[0], values[1], values[2]),
+		Direction: model3d.XYZ(values[3], values[4], values[5]),
+		Radius:    values[6],
+	})
+	return nil
+}
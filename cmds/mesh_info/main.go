@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: mesh_info [flags] <input.stl|obj|ply|off>")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath := args[0]
+
+	log.Println("Loading mesh...")
+	tris, err := treed.LoadMesh(inputPath)
+	essentials.Must(err)
+	mesh, removed := treed.PrepareMesh(tris, 1, false)
+
+	log.Println("Checking mesh...")
+	diagnostics := treed.DiagnoseMesh(mesh)
+
+	fmt.Println("Number of triangles:", len(tris))
+	fmt.Println("Degenerate triangles:", removed)
+	fmt.Println("Bounds:", mesh.Min(), mesh.Max())
+	fmt.Println("Holes:", diagnostics.Holes)
+	fmt.Println("Boundary edges:", diagnostics.BoundaryEdges)
+	fmt.Println("Non-manifold edges:", diagnostics.NonManifoldEdges)
+	fmt.Println("Inconsistent edges:", diagnostics.InconsistentEdges)
+	fmt.Println("Self-intersections:", diagnostics.SelfIntersections)
+	if diagnostics.Watertight() {
+		fmt.Println("The mesh is watertight.")
+	} else {
+		fmt.Println("The mesh is not watertight; pass -oracle winding when building trees.")
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/model3d/model3d"
 	"github.com/unixpickle/tree-d/treed"
+	"github.com/unixpickle/tree-d/treed/pipeline"
 )
 
 func main() {
@@ -25,6 +27,12 @@ func main() {
 	var minLeafSize int
 	var axisResolution int
 	var verbose bool
+	var meshScale float64
+	var centerMesh bool
+	var pointCloud bool
+	var windingBeta float64
+	var initTree string
+	var growInitTree bool
 	flag.IntVar(&datasetSize, "dataset-size", 1000000, "dataset size for surface")
 	flag.Float64Var(&meshDatasetFrac, "mesh-dasate-frac", 0.5,
 		"fraction of dataset to sample from mesh surface")
@@ -39,9 +47,23 @@ func main() {
 	flag.IntVar(&minLeafSize, "min-leaf-size", 5, "minimum samples per leaf for greedy trees")
 	flag.IntVar(&axisResolution, "axis-resolution", 2,
 		"number of icosphere subdivisions to do when creating split axes")
+	flag.Float64Var(&meshScale, "mesh-scale", 1,
+		"scale to apply to the mesh (should match the value used to build the tree)")
+	flag.BoolVar(&centerMesh, "center-mesh", false,
+		"center the mesh bounds at the origin before scaling (should match the tree)")
+	flag.BoolVar(&pointCloud, "point-cloud", false,
+		"treat the mesh argument as an oriented point cloud (.ply or .xyz) and fit its normals")
+	flag.Float64Var(&windingBeta, "winding-beta", 2,
+		"far-field threshold for approximating point cloud winding numbers (larger is slower "+
+			"but more accurate; 0 is exact)")
+	flag.StringVar(&initTree, "init-tree", "",
+		"existing normal map to continue training from; its trees replace the first trees "+
+			"of the ensemble")
+	flag.BoolVar(&growInitTree, "grow-init-tree", false,
+		"grow the leaves of -init-tree with greedy splits up to the maximum depth")
 	flag.BoolVar(&verbose, "verbose", false, "print out extra optimization information")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage: mesh_to_normal_map [flags] <tree.bin> <mesh.stl> <output.bin>")
+		fmt.Fprintln(os.Stderr, "Usage: mesh_to_normal_map [flags] <tree.bin> <mesh.stl|obj|ply|off> <output.bin>")
 		fmt.Fprintln(os.Stderr)
 		flag.PrintDefaults()
 	}
@@ -55,65 +77,123 @@ func main() {
 
 	treePath, meshPath, outputPath := args[0], args[1], args[2]
 
+	if pointCloud && (meshScale != 1 || centerMesh) {
+		// Point clouds are fit by pointcloud_to_tree without any transform.
+		essentials.Die("-mesh-scale and -center-mesh are not supported with -point-cloud")
+	}
+
 	log.Println("Loading tree...")
 	solidTree, err := treed.Load(treePath, treed.ReadBoundedSolidTree)
 	essentials.Must(err)
 
-	log.Println("Loading mesh...")
-	inputTris, err := treed.Load(meshPath, model3d.ReadSTL)
-	essentials.Must(err)
-	inputMesh := model3d.NewMeshTriangles(inputTris)
-	removed := 0
-	inputMesh.Iterate(func(t *model3d.Triangle) {
-		if t.Area() == 0 {
-			removed++
-			inputMesh.Remove(t)
+	var surfaceSampler func(rng *rand.Rand) model3d.Coord3D
+	var surfaceNormal func(c model3d.Coord3D) model3d.Coord3D
+	var boundsMin, boundsMax model3d.Coord3D
+	if pointCloud {
+		log.Println("Loading point cloud...")
+		cloud, err := treed.LoadPointCloud(meshPath)
+		essentials.Must(err)
+		cloudSolid, err := treed.NewPointCloudSolid(cloud, windingBeta)
+		essentials.Must(err)
+		surfaceSampler = func(rng *rand.Rand) model3d.Coord3D {
+			return cloud.Points[rng.Intn(len(cloud.Points))]
+		}
+		surfaceNormal = cloudSolid.Normal
+		boundsMin, boundsMax = cloudSolid.Min(), cloudSolid.Max()
+	} else {
+		log.Println("Loading mesh...")
+		inputTris, err := treed.LoadMesh(meshPath)
+		essentials.Must(err)
+		inputMesh, removed := treed.PrepareMesh(inputTris, meshScale, centerMesh)
+		if removed > 0 {
+			log.Printf(" - removed %d degenerate triangles", removed)
 		}
-	})
-	if removed > 0 {
-		log.Printf(" - removed %d invalid triangles", removed)
+		meshField := model3d.MeshToSDF(inputMesh)
+		surfaceSampler = treed.NewMeshSurfaceSampler(inputMesh).Sample
+		surfaceNormal = func(c model3d.Coord3D) model3d.Coord3D {
+			normal, _ := meshField.NormalSDF(c)
+			return normal
+		}
+		boundsMin, boundsMax = meshField.Min(), meshField.Max()
 	}
-	meshField := model3d.MeshToSDF(inputMesh)
 
 	log.Println("Sampling dataset...")
 	sampleDataset := func() (inputs, targets []model3d.Coord3D) {
-		meshScale := meshField.Min().Dist(meshField.Max())
+		meshScale := boundsMin.Dist(boundsMax)
 		noiseScale := meshScale * datasetEpsilon
 		meshCount := int(meshDatasetFrac * float64(datasetSize))
 		nonMeshCount := datasetSize - meshCount
-		inputs = treed.SampleDecisionBoundaryCast(solidTree, nonMeshCount, 0)
-		meshSampler := treed.MeshPointSampler(inputMesh)
-		for i := 0; i < nonMeshCount; i++ {
-			inputs = append(inputs, meshSampler())
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		inputs = treed.SampleDecisionBoundaryCast(rng, solidTree, nonMeshCount, 0)
+		for i := 0; i < meshCount; i++ {
+			inputs = append(inputs, surfaceSampler(rng))
+		}
+		for i, x := range inputs {
+			noise := model3d.XYZ(rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64())
+			inputs[i] = x.Add(noise.Scale(noiseScale))
 		}
 		targets = make([]model3d.Coord3D, len(inputs))
 		essentials.ConcurrentMap(0, len(inputs), func(i int) {
-			inputs[i] = inputs[i].Add(model3d.NewCoord3DRandNorm().Scale(noiseScale))
-			targets[i], _ = meshField.NormalSDF(inputs[i])
+			targets[i] = surfaceNormal(inputs[i])
 		})
 		return
 	}
 	inputs, targets := sampleDataset()
 	testInputs, testTargets := sampleDataset()
 
+	var initTrees []*treed.CoordTree
+	if initTree != "" {
+		log.Println("Loading initial normal map...")
+		initTrees, err = treed.LoadMultiple(initTree, treed.ReadCoordTree)
+		essentials.Must(err)
+		if len(initTrees) > numTrees {
+			log.Printf(" - only using the first %d of %d trees", numTrees, len(initTrees))
+		}
+	}
+
+	axes := treed.NewConstantAxisScheduleIcosphere(axisResolution).Init()
+	greedyLoss := treed.VarianceSplitLoss[float64, model3d.Coord3D]{MinCount: minLeafSize}
+	p := &pipeline.Pipeline[model3d.Coord3D]{
+		Builder: &pipeline.GreedyBuilder[model3d.Coord3D]{
+			Axes:     axes,
+			Loss:     greedyLoss,
+			MaxDepth: depth,
+		},
+		TAO: treed.TAO[float64, model3d.Coord3D, model3d.Coord3D]{
+			Loss:        treed.SquaredErrorTAOLoss[float64, model3d.Coord3D]{},
+			LR:          lr,
+			WeightDecay: weightDecay,
+			Momentum:    momentum,
+			Iters:       iters,
+			Verbose:     verbose,
+		},
+		TAOIters: taoIters,
+		Simplify: true,
+		Logf:     log.Printf,
+	}
+
+	if growInitTree {
+		p.Grow = (&pipeline.GreedyGrower[model3d.Coord3D]{
+			Axes:     axes,
+			Loss:     greedyLoss,
+			MaxDepth: depth,
+		}).Grow
+	}
+
 	var trees []*treed.CoordTree
 	for i := 0; i < numTrees; i++ {
 		log.Printf("Creating tree %d/%d ...", i+1, numTrees)
-		tree := BuildTree(
-			inputs,
-			targets,
-			testInputs,
-			testTargets,
-			axisResolution,
-			depth,
-			minLeafSize,
-			lr,
-			weightDecay,
-			momentum,
-			iters,
-			taoIters,
-			verbose,
-		)
+		state := &pipeline.State[model3d.Coord3D]{
+			Coords:     inputs,
+			Labels:     targets,
+			TestCoords: testInputs,
+			TestLabels: testTargets,
+		}
+		if i < len(initTrees) {
+			state.Tree = initTrees[i]
+		}
+		essentials.Must(p.Run(state))
+		tree := state.Tree
 		trees = append(trees, tree)
 
 		getResidual := func(t *treed.CoordTree, inputs, targets []model3d.Coord3D) {
@@ -128,64 +208,3 @@ func main() {
 	log.Println("Writing output...")
 	essentials.Must(treed.SaveMultiple(outputPath, trees, treed.WriteCoordTree))
 }
-
-func BuildTree(
-	inputs []model3d.Coord3D,
-	targets []model3d.Coord3D,
-	testInputs []model3d.Coord3D,
-	testTargets []model3d.Coord3D,
-	axisResolution int,
-	depth int,
-	minLeafSize int,
-	lr float64,
-	weightDecay float64,
-	momentum float64,
-	iters int,
-	taoIters int,
-	verbose bool,
-) *treed.CoordTree {
-	log.Println("Building greedy tree...")
-	axes := treed.NewConstantAxisScheduleIcosphere(axisResolution).Init()
-	tree := treed.GreedyTree[float64, model3d.Coord3D, model3d.Coord3D](
-		axes,
-		inputs,
-		targets,
-		treed.VarianceSplitLoss[float64, model3d.Coord3D]{MinCount: minLeafSize},
-		0,
-		depth,
-	)
-
-	log.Println("Performing TAO...")
-	tao := treed.TAO[float64, model3d.Coord3D, model3d.Coord3D]{
-		Loss:        treed.SquaredErrorTAOLoss[float64, model3d.Coord3D]{},
-		LR:          lr,
-		WeightDecay: weightDecay,
-		Momentum:    momentum,
-		Iters:       iters,
-		Verbose:     verbose,
-	}
-	testLoss := tao.EvaluateLoss(tree, testInputs, testTargets)
-	for i := 0; i < taoIters; i++ {
-		result := tao.Optimize(tree, inputs, targets)
-		if result.NewLoss >= result.OldLoss {
-			log.Printf("no improvement at iteration %d: loss=%f test_loss=%f", i, result.OldLoss,
-				testLoss)
-			break
-		}
-		newTestLoss := tao.EvaluateLoss(result.Tree, testInputs, testTargets)
-
-		log.Printf("TAO iteration %d: loss=%f->%f test_loss=%f->%f", i, result.OldLoss,
-			result.NewLoss, testLoss, newTestLoss)
-
-		testLoss = newTestLoss
-		tree = result.Tree
-	}
-
-	log.Println("Simplifying tree...")
-	oldCount := tree.NumLeaves()
-	tree = tree.Simplify(inputs, targets, tao.Loss)
-	newCount := tree.NumLeaves()
-	log.Printf(" => went from %d to %d leaves", oldCount, newCount)
-
-	return tree
-}
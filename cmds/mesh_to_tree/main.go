@@ -12,6 +12,7 @@ import (
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/model3d/model3d"
 	"github.com/unixpickle/tree-d/treed"
+	"github.com/unixpickle/tree-d/treed/pipeline"
 )
 
 func main() {
@@ -20,6 +21,7 @@ func main() {
 	var momentum float64
 	var iters int
 	var taoIters int
+	var patience int
 	var depth int
 	var minLeafSize int
 	var datasetSize int
@@ -31,12 +33,30 @@ func main() {
 	var activeGridSize int
 	var activeEpsilon float64
 	var axisResolution int
+	var traversalWeight float64
+	var renderCostRays int
+	var hull string
+	var hullWeight float64
+	var hullSamples int
+	var hullRefineDepth int
+	var initTree string
+	var growInitTree bool
+	var checkpointDir string
+	var resume bool
+	var seed int64
+	var checkMesh bool
 	var verbose bool
+	var meshScale float64
+	var centerMesh bool
+	var oracle string
+	var windingBeta float64
 	flag.Float64Var(&lr, "lr", 0.1, "learning rate for SVM training")
 	flag.Float64Var(&weightDecay, "weight-decay", 1e-4, "weight decay for SVM training")
 	flag.Float64Var(&momentum, "momentum", 0.9, "Nesterov momentum for SVM training")
 	flag.IntVar(&iters, "iters", 1000, "iterations for SVM training")
 	flag.IntVar(&taoIters, "tao-iters", 50, "maximum iterations of TAO")
+	flag.IntVar(&patience, "patience", 0,
+		"stop TAO after this many iterations without a test loss improvement (0 to disable)")
 	flag.IntVar(&depth, "depth", 20, "maximum tree depth")
 	flag.IntVar(&minLeafSize, "min-leaf-size", 5, "minimum samples per leaf for greedy trees")
 	flag.IntVar(&datasetSize, "dataset-size", 2000000, "number of points to sample for dataset")
@@ -52,14 +72,52 @@ func main() {
 	flag.Float64Var(&activeEpsilon, "active-epsilon", 0.01, "noise scale for active learning")
 	flag.IntVar(&axisResolution, "axis-resolution", 2,
 		"number of icosphere subdivisions to do when creating split axes")
+	flag.Float64Var(&traversalWeight, "traversal-weight", 0,
+		"weight of the ray traversal cost of each split for greedy trees")
+	flag.IntVar(&renderCostRays, "render-cost-rays", 0,
+		"number of rays to cast to estimate the render cost of the final tree (0 to disable)")
+	flag.StringVar(&hull, "hull", "none",
+		"conservative fitting mode: 'none', 'outer' (contains the mesh), or 'inner' (within the mesh)")
+	flag.Float64Var(&hullWeight, "hull-weight", 10,
+		"relative cost of misclassifying a point on the wrong side of the hull")
+	flag.IntVar(&hullSamples, "hull-samples", 1000000,
+		"number of surface points to check when repairing the hull")
+	flag.IntVar(&hullRefineDepth, "hull-refine-depth", 8,
+		"maximum depth of subtrees to grow in leaves that violate the hull before relabeling them")
+	flag.StringVar(&oracle, "oracle", "collider",
+		"method for labeling points inside the mesh: 'collider' (ray casting) or 'winding' "+
+			"(generalized winding number, for meshes with holes or self-intersections)")
+	flag.Float64Var(&windingBeta, "winding-beta", 2,
+		"far-field threshold for approximating winding numbers (larger is slower but more accurate; 0 is exact)")
+	flag.Float64Var(&meshScale, "mesh-scale", 1, "scale to apply to the input mesh")
+	flag.BoolVar(&centerMesh, "center-mesh", false,
+		"center the mesh bounds at the origin before scaling")
+	flag.StringVar(&initTree, "init-tree", "",
+		"existing tree to continue training from, instead of building a new one")
+	flag.BoolVar(&growInitTree, "grow-init-tree", false,
+		"grow the leaves of -init-tree with greedy splits up to the maximum depth")
+	flag.StringVar(&checkpointDir, "checkpoint-dir", "",
+		"directory to save the full training state to at every iteration")
+	flag.BoolVar(&resume, "resume", false,
+		"resume training from the state in -checkpoint-dir (other flags should match)")
+	flag.Int64Var(&seed, "seed", 0, "seed for random sampling (ignored with -resume)")
+	flag.BoolVar(&checkMesh, "check-mesh", false,
+		"check the mesh for holes and self-intersections before training")
 	flag.BoolVar(&verbose, "verbose", false, "print out extra optimization information")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage: mesh_to_tree [flags] <input.stl> <output.json>")
+		fmt.Fprintln(os.Stderr, "Usage: mesh_to_tree [flags] <input.stl|obj|ply|off> <output.json>")
 		fmt.Fprintln(os.Stderr)
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	if resume && checkpointDir == "" {
+		essentials.Die("-resume requires -checkpoint-dir")
+	}
+	if resume && initTree != "" {
+		essentials.Die("-init-tree cannot be used with -resume")
+	}
+
 	args := flag.Args()
 	if len(args) != 2 {
 		flag.Usage()
@@ -67,241 +125,177 @@ func main() {
 	}
 	inputPath, outputPath := args[0], args[1]
 
-	log.Println("Creating mesh dataset...")
-	inputTris, err := treed.Load(inputPath, model3d.ReadSTL)
-	essentials.Must(err)
-	inputMesh := model3d.NewMeshTriangles(inputTris)
-	coll := model3d.MeshToCollider(inputMesh)
-	solid := model3d.NewColliderSolid(coll)
-	coords, labels := Dataset(inputMesh, solid, datasetSize, surfaceSamples, surfaceEpsilon)
-
-	log.Println("Building initial tree...")
-	axes := treed.NewConstantAxisScheduleIcosphere(axisResolution).Init()
-	greedyLoss := treed.EntropySplitLoss[float64]{MinCount: minLeafSize}
-	tree := treed.GreedyTree[float64, model3d.Coord3D, bool](
-		axes,
-		coords,
-		labels,
-		greedyLoss,
-		0,
-		depth,
-	)
-	for i := 0; i < activeRebuilds; i++ {
-		essentials.Must(WriteTree(outputPath, solid, tree))
-		log.Printf("Apply active learning rebuild %d/%d...", i+1, activeRebuilds)
-		coords, labels = ActiveLearning(
-			tree,
-			solid,
-			coords,
-			labels,
-			activePoints,
-			activeGridSize,
-			activeEpsilon,
-			verbose,
-		)
-		tree = treed.GreedyTree[float64, model3d.Coord3D, bool](
-			axes,
-			coords,
-			labels,
-			greedyLoss,
-			0,
-			depth,
-		)
+	var positiveWeight float64
+	switch hull {
+	case "none":
+	case "outer":
+		positiveWeight = hullWeight
+	case "inner":
+		positiveWeight = 1 / hullWeight
+	default:
+		essentials.Die("unknown hull mode: " + hull)
 	}
 
-	log.Println("Sampling TAO dataset...")
-	if len(coords) < taoDatasetSize {
-		newCoords, newLabels := Dataset(
-			inputMesh, solid, datasetSize, surfaceSamples, surfaceEpsilon,
-		)
-		coords = append(coords, newCoords...)
-		labels = append(labels, newLabels...)
-	}
-	testCoords, testLabels := SolidDataset(solid, taoDatasetSize)
-
-	log.Println("Refining tree with TAO...")
-	tao := treed.TAO[float64, model3d.Coord3D, bool]{
-		Loss:        treed.EqualityTAOLoss[bool]{},
-		LR:          lr,
-		WeightDecay: weightDecay,
-		Momentum:    momentum,
-		Iters:       iters,
-		Verbose:     verbose,
+	log.Println("Loading mesh...")
+	inputTris, err := treed.LoadMesh(inputPath)
+	essentials.Must(err)
+	inputMesh, removed := treed.PrepareMesh(inputTris, meshScale, centerMesh)
+	if removed > 0 {
+		log.Printf(" - removed %d degenerate triangles", removed)
 	}
-	testLoss := tao.EvaluateLoss(tree, testCoords, testLabels)
-	for i := 0; i < taoIters; i++ {
-		essentials.Must(WriteTree(outputPath, solid, tree))
-		coords, labels = ActiveLearning(
-			tree,
-			solid,
-			coords,
-			labels,
-			activePoints,
-			activeGridSize,
-			activeEpsilon,
-			verbose,
-		)
-
-		result := tao.Optimize(tree, coords, labels)
-		if result.NewLoss >= result.OldLoss {
-			log.Printf("no improvement at iteration %d: loss=%f test_loss=%f", i, result.OldLoss,
-				testLoss)
-			break
+	if checkMesh {
+		diagnostics := treed.DiagnoseMesh(inputMesh)
+		if !diagnostics.Watertight() {
+			log.Printf(" - mesh is not watertight (%d holes, %d non-manifold edges, "+
+				"%d inconsistent edges, %d self-intersections)", diagnostics.Holes,
+				diagnostics.NonManifoldEdges, diagnostics.InconsistentEdges,
+				diagnostics.SelfIntersections)
+			if oracle == "collider" {
+				log.Println(" - consider passing -oracle winding")
+			}
 		}
-		newTestLoss := tao.EvaluateLoss(result.Tree, testCoords, testLabels)
-
-		log.Printf("TAO iteration %d: loss=%f->%f test_loss=%f->%f", i, result.OldLoss,
-			result.NewLoss, testLoss, newTestLoss)
-
-		testLoss = newTestLoss
-		tree = result.Tree
 	}
-
-	log.Println("Simplifying tree...")
-	oldCount := tree.NumLeaves()
-	tree = tree.Simplify(coords, labels, tao.Loss)
-	newCount := tree.NumLeaves()
-	log.Printf(" => went from %d to %d leaves", oldCount, newCount)
-
-	log.Println("Writing output...")
-	essentials.Must(WriteTree(outputPath, solid, tree))
-}
-
-func WriteTree(outputPath string, solid model3d.Solid, tree *treed.SolidTree) error {
-	boundedTree := &treed.BoundedSolidTree{
-		Min:  solid.Min(),
-		Max:  solid.Max(),
-		Tree: tree,
+	var solid model3d.Solid
+	switch oracle {
+	case "collider":
+		solid = model3d.NewColliderSolid(model3d.MeshToCollider(inputMesh))
+	case "winding":
+		solid = treed.NewWindingNumberSolid(inputMesh, windingBeta)
+	default:
+		essentials.Die("unknown oracle: " + oracle)
 	}
-	return treed.Save(outputPath, boundedTree, treed.WriteBoundedSolidTree)
-}
-
-func Dataset(
-	mesh *model3d.Mesh,
-	solid model3d.Solid,
-	datasetSize int,
-	surfaceSamples int,
-	eps float64,
-) ([]model3d.Coord3D, []bool) {
-	coords, labels := SolidDataset(solid, datasetSize-surfaceSamples)
-	if surfaceSamples > 0 {
-		meshCoords, meshLabels := MeshDataset(mesh, solid, surfaceSamples, eps)
-		coords = append(coords, meshCoords...)
-		labels = append(labels, meshLabels...)
-	}
-	return coords, labels
-}
+	min, max := pipeline.PaddedBounds(solid.Min(), solid.Max(), 0.1)
+	save := pipeline.SaveTree(outputPath, solid.Min(), solid.Max())
+	surfaceNoise := surfaceEpsilon * inputMesh.Min().Dist(inputMesh.Max())
 
-func SolidDataset(solid model3d.Solid, numPoints int) (points []model3d.Coord3D, labels []bool) {
-	min, max := PaddedBounds(solid)
-
-	points = make([]model3d.Coord3D, numPoints)
-	labels = make([]bool, numPoints)
-
-	essentials.ConcurrentMap(0, numPoints, func(i int) {
-		point := model3d.NewCoord3DRandBounds(min, max)
-		label := solid.Contains(point)
-		points[i] = point
-		labels[i] = label
-	})
-
-	return
-}
-
-func MeshDataset(
-	mesh *model3d.Mesh,
-	solid model3d.Solid,
-	numPoints int,
-	eps float64,
-) (points []model3d.Coord3D, labels []bool) {
-	points = make([]model3d.Coord3D, numPoints)
-	labels = make([]bool, numPoints)
-	delta := eps * mesh.Min().Dist(mesh.Max())
-	essentials.StatefulConcurrentMap(0, numPoints, func() func(int) {
-		sampler := treed.MeshPointSampler(mesh)
-		return func(i int) {
-			point := sampler().Add(model3d.NewCoord3DRandNorm().Scale(delta))
-			label := solid.Contains(point)
-			points[i] = point
-			labels[i] = label
-		}
-	})
-	return
-}
-
-func PaddedBounds(solid model3d.Solid) (min, max model3d.Coord3D) {
-	min, max = solid.Min(), solid.Max()
-	size := min.Dist(max)
-	min = min.AddScalar(-size * 0.1)
-	max = max.AddScalar(size * 0.1)
-	return
-}
+	axes := treed.NewConstantAxisScheduleIcosphere(axisResolution).Init()
+	greedyLoss := treed.TraversalSplitLoss[float64]{
+		MinCount: minLeafSize,
+		Weight:   traversalWeight,
 
-func ActiveLearning(
-	tree *treed.SolidTree,
-	solid model3d.Solid,
-	coords []model3d.Coord3D,
-	labels []bool,
-	activePoints int,
-	activeGridSize int,
-	activeEpsilon float64,
-	verbose bool,
-) ([]model3d.Coord3D, []bool) {
-	if activePoints == 0 {
-		return coords, labels
+		PositiveWeight: positiveWeight,
+	}
+	active := &pipeline.ActiveLearning{
+		Min:       min,
+		Max:       max,
+		Oracle:    solid.Contains,
+		NumPoints: activePoints,
+		GridSize:  activeGridSize,
+		Epsilon:   activeEpsilon,
 	}
-
 	if verbose {
-		log.Printf("Creating %d active learning samples...", activePoints)
+		active.Logf = log.Printf
 	}
-	min, max := PaddedBounds(solid)
-	epsilon := min.Dist(max) * activeEpsilon
-
-	boundedTree := &treed.BoundedSolidTree{Tree: tree, Min: min, Max: max}
-	activeSamples := treed.SampleDecisionBoundaryCast(boundedTree, activePoints/2, activePoints*128)
-	if len(activeSamples) < activePoints/2 {
-		extra := treed.SampleDecisionBoundaryMesh(
-			boundedTree,
-			activePoints/2-len(activeSamples),
-			activeGridSize,
-		)
-		activeSamples = append(activeSamples, extra...)
+	p := &pipeline.Pipeline[bool]{
+		Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			return pipeline.Dataset(rng, min, max, inputMesh, solid.Contains, n,
+				essentials.MinInt(n, surfaceSamples), surfaceNoise)
+		},
+		TestDataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			return pipeline.UniformDataset(rng, min, max, solid.Contains, n)
+		},
+		DatasetSize:     datasetSize,
+		TestDatasetSize: taoDatasetSize,
+		TAODatasetSize:  taoDatasetSize,
+		TAOTopUpSize:    datasetSize,
+		Builder: &pipeline.GreedyBuilder[bool]{
+			Axes:     axes,
+			Loss:     greedyLoss,
+			MaxDepth: depth,
+		},
+		ActiveLearning: active.Augment,
+		Rebuilds:       activeRebuilds,
+		ActiveTAO:      true,
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:        treed.WeightedBoolTAOLoss{PositiveWeight: positiveWeight},
+			LR:          lr,
+			WeightDecay: weightDecay,
+			Momentum:    momentum,
+			Iters:       iters,
+			Verbose:     verbose,
+		},
+		TAOIters: taoIters,
+		Patience: patience,
+		Simplify: true,
+		Checkpoint: func(s *pipeline.State[bool]) error {
+			if err := save(s); err != nil {
+				return err
+			}
+			if checkpointDir != "" {
+				return pipeline.SaveCheckpoint(checkpointDir, s)
+			}
+			return nil
+		},
+		Logf: log.Printf,
 	}
-
-	// Sample some points slightly outside the decision boundary
-	// to allow faster growth/shrinking.
-	for i := 0; i < len(activeSamples); i += 2 {
-		activeSamples[i] = activeSamples[i].Add(model3d.NewCoord3DRandNorm().Scale(epsilon))
+	if growInitTree {
+		p.Grow = (&pipeline.GreedyGrower[bool]{
+			Axes:     axes,
+			Loss:     greedyLoss,
+			MaxDepth: depth,
+		}).Grow
 	}
-
-	// Sample around points that are misclassified.
-	var badPoints []model3d.Coord3D
-	for i, c := range coords {
-		if tree.Predict(c) != labels[i] {
-			badPoints = append(badPoints, c)
+	state := &pipeline.State[bool]{Seed: seed}
+	if initTree != "" {
+		log.Println("Loading initial tree...")
+		loaded, err := treed.Load(initTree, treed.ReadBoundedSolidTree)
+		essentials.Must(err)
+		if loaded.Min != solid.Min() || loaded.Max != solid.Max() {
+			// Splits are stored in absolute coordinates, so a tree for a
+			// differently scaled or centered mesh is meaningless.
+			if loaded.Min.Max(solid.Max()) != solid.Max() ||
+				solid.Min().Max(loaded.Max) != loaded.Max {
+				essentials.Die(fmt.Sprintf("initial tree bounds %v-%v do not overlap mesh "+
+					"bounds %v-%v; check -mesh-scale and -center-mesh", loaded.Min, loaded.Max,
+					solid.Min(), solid.Max()))
+			}
+			log.Printf(" - initial tree bounds %v-%v differ from mesh bounds %v-%v",
+				loaded.Min, loaded.Max, solid.Min(), solid.Max())
 		}
+		state.Tree = loaded.Tree
 	}
-	if len(badPoints) > 0 {
-		for i := 0; i < activePoints/2; i++ {
-			point := badPoints[rand.Intn(len(badPoints))]
-			point = point.Add(model3d.NewCoord3DRandNorm().Scale(epsilon))
-			activeSamples = append(activeSamples, point)
-		}
+	if resume {
+		log.Println("Resuming from checkpoint...")
+		var err error
+		state, err = pipeline.LoadCheckpoint[bool](checkpointDir)
+		essentials.Must(err)
+		log.Printf(" => stage %d, iteration %d, %d training points", state.Stage,
+			state.Iteration, len(state.Coords))
 	}
+	essentials.Must(p.Run(state))
+	tree, coords, labels := state.Tree, state.Coords, state.Labels
 
-	var numCorrect int
-	for _, c := range activeSamples {
-		label := solid.Contains(c)
-		pred := tree.Predict(c)
-		coords = append(coords, c)
-		labels = append(labels, label)
-		if pred == label {
-			numCorrect++
+	if hull != "none" {
+		log.Printf("Repairing %s hull...", hull)
+		value := hull == "outer"
+		points := pipeline.SurfacePoints(state.Rand, inputMesh, hullSamples)
+		for i, c := range coords {
+			if labels[i] == value {
+				points = append(points, c)
+			}
 		}
+		var numRepaired int
+		tree, numRepaired = treed.RefineHull[float64, model3d.Coord3D](
+			tree,
+			axes,
+			coords,
+			labels,
+			points,
+			value,
+			greedyLoss,
+			hullRefineDepth,
+		)
+		log.Printf(" => relabeled %d leaves", numRepaired)
 	}
-	if verbose {
-		log.Printf("=> active accuracy is %f", float64(numCorrect)/float64(activePoints))
+
+	if renderCostRays > 0 {
+		log.Println("Estimating render cost...")
+		boundedTree := &treed.BoundedSolidTree{Min: solid.Min(), Max: solid.Max(), Tree: tree}
+		cost := treed.EstimateRenderCost(boundedTree, renderCostRays)
+		log.Printf(" => mean branch changes per ray: %f", cost.BranchChanges)
 	}
 
-	return coords, labels
+	log.Println("Writing output...")
+	state.Tree = tree
+	essentials.Must(save(state))
 }
@@ -7,6 +7,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/model3d/model3d"
 	"github.com/unixpickle/tree-d/treed"
+	"github.com/unixpickle/tree-d/treed/pipeline"
 )
 
 func main() {
@@ -22,6 +24,7 @@ func main() {
 	var momentum float64
 	var iters int
 	var taoIters int
+	var patience int
 	var depth int
 	var minLeafSize int
 	var initDatasetSize int
@@ -31,12 +34,30 @@ func main() {
 	var mutationCount int
 	var mutationStddev flagFloats = []float64{0.025}
 	var hitAndRunIterations int
+	var removeSlivers bool
+	var minInradius float64
+	var minComponentVolume float64
+	var initTree string
+	var growInitTree bool
+	var checkpointDir string
+	var resume bool
+	var seed int64
+	var checkMesh bool
 	var verbose bool
+	var meshScale float64
+	var centerMesh bool
+	var oracle string
+	var windingBeta float64
+	var oracleCmd string
+	var oracleProcesses int
+	var oracleBatchSize int
 	flag.Float64Var(&lr, "lr", 0.1, "learning rate for SVM training")
 	flag.Float64Var(&weightDecay, "weight-decay", 1e-4, "weight decay for SVM training")
 	flag.Float64Var(&momentum, "momentum", 0.9, "Nesterov momentum for SVM training")
 	flag.IntVar(&iters, "iters", 1000, "iterations for SVM training")
 	flag.IntVar(&taoIters, "tao-iters", 50, "maximum iterations of TAO")
+	flag.IntVar(&patience, "patience", 0,
+		"stop TAO after this many iterations without a test loss improvement (0 to disable)")
 	flag.IntVar(&depth, "depth", 18, "maximum tree depth")
 	flag.IntVar(&minLeafSize, "min-leaf-size", 5, "minimum samples per leaf when splitting")
 	flag.IntVar(&initDatasetSize, "init-dataset-size", 50000,
@@ -49,36 +70,131 @@ func main() {
 	flag.Var(&mutationStddev, "mutation-stddev", "scale of mutations; may be comma-separated list")
 	flag.IntVar(&hitAndRunIterations, "hit-and-run-iterations", 20,
 		"minimum dataset size at leaves")
+	flag.BoolVar(&removeSlivers, "remove-slivers", false,
+		"remove thin slivers and small disconnected components after training")
+	flag.Float64Var(&minInradius, "min-inradius", 0.002,
+		"minimum inradius of occupied leaves for -remove-slivers, relative to the bounding box diagonal")
+	flag.Float64Var(&minComponentVolume, "min-component-volume", 0.001,
+		"minimum volume of connected components for -remove-slivers, relative to the bounding box volume")
+	flag.StringVar(&oracle, "oracle", "collider",
+		"method for labeling points inside the mesh: 'collider' (ray casting) or 'winding' "+
+			"(generalized winding number, for meshes with holes or self-intersections)")
+	flag.Float64Var(&windingBeta, "winding-beta", 2,
+		"far-field threshold for approximating winding numbers (larger is slower but more accurate; 0 is exact)")
+	flag.StringVar(&oracleCmd, "oracle-cmd", "",
+		"command to run as an external oracle process instead of reading a mesh")
+	flag.IntVar(&oracleProcesses, "oracle-processes", 1,
+		"number of copies of -oracle-cmd to run concurrently")
+	flag.IntVar(&oracleBatchSize, "oracle-batch-size", 1024,
+		"maximum number of points per query to -oracle-cmd")
+	flag.Float64Var(&meshScale, "mesh-scale", 1, "scale to apply to the input mesh")
+	flag.BoolVar(&centerMesh, "center-mesh", false,
+		"center the mesh bounds at the origin before scaling")
+	flag.StringVar(&initTree, "init-tree", "",
+		"existing tree to continue training from, instead of building a new one")
+	flag.BoolVar(&growInitTree, "grow-init-tree", false,
+		"grow the leaves of -init-tree with adaptive greedy splits up to the maximum depth")
+	flag.StringVar(&checkpointDir, "checkpoint-dir", "",
+		"directory to save the full training state to at every iteration")
+	flag.BoolVar(&resume, "resume", false,
+		"resume training from the state in -checkpoint-dir (other flags should match)")
+	flag.Int64Var(&seed, "seed", 0, "seed for random sampling (ignored with -resume)")
+	flag.BoolVar(&checkMesh, "check-mesh", false,
+		"check the mesh for holes and self-intersections before training")
 	flag.BoolVar(&verbose, "verbose", false, "print out extra optimization information")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage: mesh_to_tree_v2 [flags] <input.stl> <output.json>")
+		fmt.Fprintln(os.Stderr, "Usage: mesh_to_tree_v2 [flags] <input.stl|obj|ply|off> <output.json>")
+		fmt.Fprintln(os.Stderr, "       mesh_to_tree_v2 [flags] -oracle-cmd <command> <output.json>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "With -oracle-cmd, points are labeled by an external process. The")
+		fmt.Fprintln(os.Stderr, "process first writes its bounds to stdout as six little-endian float64")
+		fmt.Fprintln(os.Stderr, "values (min x, y, z, then max x, y, z). It then repeatedly reads a")
+		fmt.Fprintln(os.Stderr, "uint32 count N followed by N*3 float64 coordinates from stdin, and")
+		fmt.Fprintln(os.Stderr, "replies with N bytes, each 1 for inside or 0 for outside. The process")
+		fmt.Fprintln(os.Stderr, "should exit when stdin is closed.")
 		fmt.Fprintln(os.Stderr)
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	if resume && checkpointDir == "" {
+		essentials.Die("-resume requires -checkpoint-dir")
+	}
+	if resume && initTree != "" {
+		essentials.Die("-init-tree cannot be used with -resume")
+	}
+
 	args := flag.Args()
-	if len(args) != 2 {
-		flag.Usage()
-		os.Exit(1)
+	var inputPath, outputPath string
+	if oracleCmd != "" {
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		outputPath = args[0]
+	} else {
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		inputPath, outputPath = args[0], args[1]
 	}
-	inputPath, outputPath := args[0], args[1]
 
-	log.Println("Creating mesh dataset...")
-	inputTris, err := treed.Load(inputPath, model3d.ReadSTL)
-	essentials.Must(err)
-	inputMesh := model3d.NewMeshTriangles(inputTris)
-	coll := model3d.MeshToCollider(inputMesh)
-	solid := model3d.NewColliderSolid(coll)
-	coords, labels := SolidDataset(solid, initDatasetSize)
+	var inputMesh *model3d.Mesh
+	var solid model3d.Solid
+	var processOracle *treed.ProcessOracle
+	if oracleCmd != "" {
+		if surfaceSplitCount != 0 {
+			essentials.Die("-surface-split-count requires an input mesh")
+		}
+		log.Println("Starting oracle processes...")
+		var err error
+		processOracle, err = treed.NewProcessOracle(strings.Fields(oracleCmd),
+			oracleProcesses, oracleBatchSize)
+		essentials.Must(err)
+		defer func() {
+			essentials.Must(processOracle.Close())
+		}()
+		solid = processOracle
+	} else {
+		log.Println("Loading mesh...")
+		inputTris, err := treed.LoadMesh(inputPath)
+		essentials.Must(err)
+		var removed int
+		inputMesh, removed = treed.PrepareMesh(inputTris, meshScale, centerMesh)
+		if removed > 0 {
+			log.Printf(" - removed %d degenerate triangles", removed)
+		}
+		if checkMesh {
+			diagnostics := treed.DiagnoseMesh(inputMesh)
+			if !diagnostics.Watertight() {
+				log.Printf(" - mesh is not watertight (%d holes, %d non-manifold edges, "+
+					"%d inconsistent edges, %d self-intersections)", diagnostics.Holes,
+					diagnostics.NonManifoldEdges, diagnostics.InconsistentEdges,
+					diagnostics.SelfIntersections)
+				if oracle == "collider" {
+					log.Println(" - consider passing -oracle winding")
+				}
+			}
+		}
+		switch oracle {
+		case "collider":
+			solid = model3d.NewColliderSolid(model3d.MeshToCollider(inputMesh))
+		case "winding":
+			solid = treed.NewWindingNumberSolid(inputMesh, windingBeta)
+		default:
+			essentials.Die("unknown oracle: " + oracle)
+		}
+	}
+	save := pipeline.SaveTree(outputPath, solid.Min(), solid.Max())
 
-	log.Println("Building initial tree...")
+	axes := treed.NewConstantAxisScheduleIcosphere(axisResolution).Init()
 	mutationCounts := make([]int, len(mutationStddev))
 	for i := range mutationStddev {
 		mutationCounts[i] = mutationCount
 	}
 	axisSchedule := &treed.MutationAxisSchedule[float64, model3d.Coord3D]{
-		Initial: treed.NewConstantAxisScheduleIcosphere(axisResolution).Init(),
+		Initial: axes,
 		Counts:  mutationCounts,
 		Stddevs: mutationStddev,
 	}
@@ -87,99 +203,140 @@ func main() {
 		Iterations: hitAndRunIterations,
 	}
 	bounds := treed.NewPolytopeBounds(solid.Min(), solid.Max())
-	var tree *treed.Tree[float64, model3d.Coord3D, bool]
+	var builder pipeline.Builder[bool] = &pipeline.AdaptiveBuilder[bool]{
+		AxisSchedule: axisSchedule,
+		Bounds:       bounds,
+		Oracle:       solid.Contains,
+		Loss:         greedyLoss,
+		Sampler:      sampler,
+		MinSamples:   minDatasetSize,
+		MaxDepth:     depth,
+	}
 	if surfaceSplitCount != 0 {
-		tree = treed.MeshSurfaceTree[bool](
-			inputMesh,
-			bounds,
-			coords,
-			labels,
-			solid.Contains,
-			greedyLoss,
-			sampler,
-			minDatasetSize,
-			0,
-			depth,
-			surfaceSplitCount,
-		)
-	} else {
-		tree = treed.AdaptiveGreedyTree[float64, model3d.Coord3D, bool](
-			axisSchedule,
-			bounds,
-			coords,
-			labels,
-			solid.Contains,
-			greedyLoss,
-			sampler,
-			minDatasetSize,
-			0,
-			depth,
-		)
+		builder = pipeline.BuilderFunc[bool](func(
+			coords []model3d.Coord3D,
+			labels []bool,
+		) *treed.SolidTree {
+			return treed.MeshSurfaceTree[bool](
+				inputMesh,
+				bounds,
+				coords,
+				labels,
+				solid.Contains,
+				greedyLoss,
+				sampler,
+				minDatasetSize,
+				0,
+				depth,
+				surfaceSplitCount,
+			)
+		})
 	}
 
-	testCoords, testLabels := SolidDataset(solid, initDatasetSize)
-
-	log.Println("Refining tree with TAO...")
-	tao := treed.TAO[float64, model3d.Coord3D, bool]{
-		Loss:        treed.EqualityTAOLoss[bool]{},
-		LR:          lr,
-		WeightDecay: weightDecay,
-		Momentum:    momentum,
-		Iters:       iters,
-		Verbose:     verbose,
+	p := &pipeline.Pipeline[bool]{
+		Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			if processOracle != nil {
+				// Label the entire dataset with full batches, rather than
+				// one point per Goroutine at a time.
+				coords := pipeline.UniformPoints(rng, solid.Min(), solid.Max(), n)
+				labels, err := processOracle.ContainsBatch(coords)
+				essentials.Must(err)
+				return coords, labels
+			}
+			return pipeline.UniformDataset(rng, solid.Min(), solid.Max(), solid.Contains, n)
+		},
+		DatasetSize:     initDatasetSize,
+		TestDatasetSize: initDatasetSize,
+		Builder:         builder,
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:        treed.EqualityTAOLoss[bool]{},
+			LR:          lr,
+			WeightDecay: weightDecay,
+			Momentum:    momentum,
+			Iters:       iters,
+			Verbose:     verbose,
 
-		// Adaptive dataset configuration.
-		MinSamples: minDatasetSize,
-		Sampler:    sampler,
-		Bounds:     bounds,
-		Oracle:     solid.Contains,
-	}
-	testLoss := tao.EvaluateLoss(tree, testCoords, testLabels)
-	for i := 0; i < taoIters; i++ {
-		essentials.Must(WriteTree(outputPath, solid, tree))
-
-		result := tao.Optimize(tree, coords, labels)
-		if result.NewLoss >= result.OldLoss {
-			log.Printf("no improvement at iteration %d: loss=%f test_loss=%f", i, result.OldLoss,
-				testLoss)
-			break
+			// Adaptive dataset configuration.
+			MinSamples: minDatasetSize,
+			Sampler:    sampler,
+			Bounds:     bounds,
+			Oracle:     solid.Contains,
+		},
+		TAOIters: taoIters,
+		Patience: patience,
+		Checkpoint: func(s *pipeline.State[bool]) error {
+			if err := save(s); err != nil {
+				return err
+			}
+			if checkpointDir != "" {
+				return pipeline.SaveCheckpoint(checkpointDir, s)
+			}
+			return nil
+		},
+		Logf: log.Printf,
+	}
+	if growInitTree {
+		p.Grow = (&pipeline.AdaptiveGrower[bool]{
+			AxisSchedule: axisSchedule,
+			Bounds:       bounds,
+			Oracle:       solid.Contains,
+			Loss:         greedyLoss,
+			Sampler:      sampler,
+			MinSamples:   minDatasetSize,
+			MaxDepth:     depth,
+		}).Grow
+	}
+	state := &pipeline.State[bool]{Seed: seed}
+	if initTree != "" {
+		log.Println("Loading initial tree...")
+		loaded, err := treed.Load(initTree, treed.ReadBoundedSolidTree)
+		essentials.Must(err)
+		if loaded.Min != solid.Min() || loaded.Max != solid.Max() {
+			// Splits are stored in absolute coordinates, so a tree for a
+			// differently scaled or centered mesh is meaningless.
+			if loaded.Min.Max(solid.Max()) != solid.Max() ||
+				solid.Min().Max(loaded.Max) != loaded.Max {
+				essentials.Die(fmt.Sprintf("initial tree bounds %v-%v do not overlap mesh "+
+					"bounds %v-%v; check -mesh-scale and -center-mesh", loaded.Min, loaded.Max,
+					solid.Min(), solid.Max()))
+			}
+			log.Printf(" - initial tree bounds %v-%v differ from mesh bounds %v-%v",
+				loaded.Min, loaded.Max, solid.Min(), solid.Max())
 		}
-		newTestLoss := tao.EvaluateLoss(result.Tree, testCoords, testLabels)
-
-		log.Printf("TAO iteration %d: loss=%f->%f test_loss=%f->%f", i, result.OldLoss,
-			result.NewLoss, testLoss, newTestLoss)
-
-		testLoss = newTestLoss
-		tree = result.Tree
+		state.Tree = loaded.Tree
 	}
-
-	log.Println("Writing output...")
-	essentials.Must(WriteTree(outputPath, solid, tree))
-}
-
-func WriteTree(outputPath string, solid model3d.Solid, tree *treed.SolidTree) error {
-	boundedTree := &treed.BoundedSolidTree{
-		Min:  solid.Min(),
-		Max:  solid.Max(),
-		Tree: tree,
+	if resume {
+		log.Println("Resuming from checkpoint...")
+		var err error
+		state, err = pipeline.LoadCheckpoint[bool](checkpointDir)
+		essentials.Must(err)
+		log.Printf(" => stage %d, iteration %d, %d training points", state.Stage,
+			state.Iteration, len(state.Coords))
 	}
-	return treed.Save(outputPath, boundedTree, treed.WriteBoundedSolidTree)
-}
-
-func SolidDataset(solid model3d.Solid, numPoints int) (points []model3d.Coord3D, labels []bool) {
-	min, max := solid.Min(), solid.Max()
-
-	points = make([]model3d.Coord3D, numPoints)
-	labels = make([]bool, numPoints)
+	essentials.Must(p.Run(state))
+	tree := state.Tree
 
-	essentials.ConcurrentMap(0, numPoints, func(i int) {
-		point := model3d.NewCoord3DRandBounds(min, max)
-		label := solid.Contains(point)
-		points[i] = point
-		labels[i] = label
-	})
+	if removeSlivers {
+		log.Println("Removing slivers...")
+		size := solid.Max().Sub(solid.Min())
+		volume := size.X * size.Y * size.Z
+		filter := &treed.SliverFilter{
+			MinInradius:        minInradius * size.Norm(),
+			MinComponentVolume: minComponentVolume * volume,
+		}
+		result := filter.Filter(&treed.BoundedSolidTree{
+			Min:  solid.Min(),
+			Max:  solid.Max(),
+			Tree: tree,
+		})
+		log.Printf(" => removed %d leaves with volume %f", result.LeavesRemoved,
+			result.VolumeRemoved)
+		tree = result.Tree.Tree
+	}
 
-	return
+	log.Println("Writing output...")
+	state.Tree = tree
+	essentials.Must(save(state))
 }
 
 type flagFloats []float64
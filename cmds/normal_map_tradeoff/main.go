@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
 
 	"github.com/unixpickle/essentials"
@@ -16,10 +17,16 @@ import (
 func main() {
 	var datasetSize int
 	var datasetEpsilon float64
+	var meshScale float64
+	var centerMesh bool
 	flag.IntVar(&datasetSize, "dataset-size", 1000000, "dataset size for surface")
 	flag.Float64Var(&datasetEpsilon, "dataset-epsilon", 1e-4, "noise to add to input points")
+	flag.Float64Var(&meshScale, "mesh-scale", 1,
+		"scale to apply to the mesh (should match the value used to build the tree)")
+	flag.BoolVar(&centerMesh, "center-mesh", false,
+		"center the mesh bounds at the origin before scaling (should match the tree)")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage: mesh_to_normal_map [flags] <tree.bin> <mesh.stl> <map.bin>")
+		fmt.Fprintln(os.Stderr, "Usage: mesh_to_normal_map [flags] <tree.bin> <mesh.stl|obj|ply|off> <map.bin>")
 		fmt.Fprintln(os.Stderr)
 		flag.PrintDefaults()
 	}
@@ -38,18 +45,11 @@ func main() {
 	essentials.Must(err)
 
 	log.Println("Loading mesh...")
-	inputTris, err := treed.Load(meshPath, model3d.ReadSTL)
+	inputTris, err := treed.LoadMesh(meshPath)
 	essentials.Must(err)
-	inputMesh := model3d.NewMeshTriangles(inputTris)
-	removed := 0
-	inputMesh.Iterate(func(t *model3d.Triangle) {
-		if t.Area() == 0 {
-			removed++
-			inputMesh.Remove(t)
-		}
-	})
+	inputMesh, removed := treed.PrepareMesh(inputTris, meshScale, centerMesh)
 	if removed > 0 {
-		log.Printf(" - removed %d invalid triangles", removed)
+		log.Printf(" - removed %d degenerate triangles", removed)
 	}
 	meshField := model3d.MeshToSDF(inputMesh)
 
@@ -61,7 +61,8 @@ func main() {
 	sampleDataset := func() (inputs, targets []model3d.Coord3D) {
 		meshScale := meshField.Min().Dist(meshField.Max())
 		noiseScale := meshScale * datasetEpsilon
-		inputs = treed.SampleDecisionBoundaryCast(solidTree, datasetSize, 0)
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		inputs = treed.SampleDecisionBoundaryCast(rng, solidTree, datasetSize, 0)
 		targets = make([]model3d.Coord3D, len(inputs))
 		essentials.ConcurrentMap(0, len(inputs), func(i int) {
 			inputs[i] = inputs[i].Add(model3d.NewCoord3DRandNorm().Scale(noiseScale))
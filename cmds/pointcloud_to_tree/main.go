@@ -0,0 +1,157 @@
+// Command pointcloud_to_tree builds a tree from an oriented point cloud,
+// using adaptive dataset sampling like mesh_to_tree_v2.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+	"github.com/unixpickle/tree-d/treed/pipeline"
+)
+
+func main() {
+	var lr float64
+	var weightDecay float64
+	var momentum float64
+	var iters int
+	var taoIters int
+	var depth int
+	var minLeafSize int
+	var initDatasetSize int
+	var minDatasetSize int
+	var axisResolution int
+	var mutationCount int
+	var mutationStddev flagFloats = []float64{0.025}
+	var hitAndRunIterations int
+	var windingBeta float64
+	var verbose bool
+	flag.Float64Var(&lr, "lr", 0.1, "learning rate for SVM training")
+	flag.Float64Var(&weightDecay, "weight-decay", 1e-4, "weight decay for SVM training")
+	flag.Float64Var(&momentum, "momentum", 0.9, "Nesterov momentum for SVM training")
+	flag.IntVar(&iters, "iters", 1000, "iterations for SVM training")
+	flag.IntVar(&taoIters, "tao-iters", 50, "maximum iterations of TAO")
+	flag.IntVar(&depth, "depth", 18, "maximum tree depth")
+	flag.IntVar(&minLeafSize, "min-leaf-size", 5, "minimum samples per leaf when splitting")
+	flag.IntVar(&initDatasetSize, "init-dataset-size", 50000,
+		"initial number of points to sample for dataset")
+	flag.IntVar(&minDatasetSize, "min-dataset-size", 1000, "minimum dataset size at leaves")
+	flag.IntVar(&axisResolution, "axis-resolution", 2,
+		"number of icosphere subdivisions to do when creating split axes")
+	flag.IntVar(&mutationCount, "mutation-count", 30, "number of mutation directions")
+	flag.Var(&mutationStddev, "mutation-stddev", "scale of mutations; may be comma-separated list")
+	flag.IntVar(&hitAndRunIterations, "hit-and-run-iterations", 20,
+		"steps of hit-and-run sampling for polytope sampling")
+	flag.Float64Var(&windingBeta, "winding-beta", 2,
+		"far-field threshold for approximating winding numbers (larger is slower but more accurate; 0 is exact)")
+	flag.BoolVar(&verbose, "verbose", false, "print out extra optimization information")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: pointcloud_to_tree [flags] <input.ply|xyz> <output.bin>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "The input must contain a normal for every point. PLY vertices should")
+		fmt.Fprintln(os.Stderr, "have nx, ny, and nz properties, and XYZ lines should contain six")
+		fmt.Fprintln(os.Stderr, "numbers: x y z nx ny nz.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	log.Println("Loading point cloud...")
+	cloud, err := treed.LoadPointCloud(inputPath)
+	essentials.Must(err)
+	if len(cloud.Points) < 2 {
+		essentials.Die("point cloud must contain at least two points")
+	}
+	log.Printf(" => loaded %d points", len(cloud.Points))
+	solid, err := treed.NewPointCloudSolid(cloud, windingBeta)
+	essentials.Must(err)
+
+	mutationCounts := make([]int, len(mutationStddev))
+	for i := range mutationStddev {
+		mutationCounts[i] = mutationCount
+	}
+	sampler := &treed.HitAndRunSampler[float64, model3d.Coord3D]{
+		Iterations: hitAndRunIterations,
+	}
+	bounds := treed.NewPolytopeBounds(solid.Min(), solid.Max())
+	save := pipeline.SaveTree(outputPath, solid.Min(), solid.Max())
+	p := &pipeline.Pipeline[bool]{
+		Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			return pipeline.UniformDataset(rng, solid.Min(), solid.Max(), solid.Contains, n)
+		},
+		DatasetSize:     initDatasetSize,
+		TestDatasetSize: initDatasetSize,
+		Builder: &pipeline.AdaptiveBuilder[bool]{
+			AxisSchedule: &treed.MutationAxisSchedule[float64, model3d.Coord3D]{
+				Initial: treed.NewConstantAxisScheduleIcosphere(axisResolution).Init(),
+				Counts:  mutationCounts,
+				Stddevs: mutationStddev,
+			},
+			Bounds:     bounds,
+			Oracle:     solid.Contains,
+			Loss:       treed.EntropySplitLoss[float64]{MinCount: minLeafSize},
+			Sampler:    sampler,
+			MinSamples: minDatasetSize,
+			MaxDepth:   depth,
+		},
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:        treed.EqualityTAOLoss[bool]{},
+			LR:          lr,
+			WeightDecay: weightDecay,
+			Momentum:    momentum,
+			Iters:       iters,
+			Verbose:     verbose,
+
+			// Adaptive dataset configuration.
+			MinSamples: minDatasetSize,
+			Sampler:    sampler,
+			Bounds:     bounds,
+			Oracle:     solid.Contains,
+		},
+		TAOIters:   taoIters,
+		Checkpoint: save,
+		Logf:       log.Printf,
+	}
+	state := &pipeline.State[bool]{}
+	essentials.Must(p.Run(state))
+
+	log.Println("Writing output...")
+	essentials.Must(save(state))
+}
+
+type flagFloats []float64
+
+func (i *flagFloats) String() string {
+	parts := make([]string, len(*i))
+	for j, x := range *i {
+		parts[j] = strconv.FormatFloat(x, 'f', 0, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (i *flagFloats) Set(value string) error {
+	var res []float64
+	for _, part := range strings.Split(value, ",") {
+		parsed, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected part %q: %w", part, err)
+		}
+		res = append(res, parsed)
+	}
+	*i = res
+	return nil
+}
@@ -0,0 +1,59 @@
+// Command remove_slivers removes thin slivers and small disconnected specks
+// from the occupied region of a tree.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var minInradius float64
+	var minLeafVolume float64
+	var minComponentVolume float64
+	flag.Float64Var(&minInradius, "min-inradius", 0.002,
+		"minimum inradius of occupied leaves, relative to the bounding box diagonal")
+	flag.Float64Var(&minLeafVolume, "min-leaf-volume", 0,
+		"minimum volume of occupied leaves, relative to the bounding box volume")
+	flag.Float64Var(&minComponentVolume, "min-component-volume", 0.001,
+		"minimum volume of connected components, relative to the bounding box volume")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: remove_slivers [flags] <input.bin> <output.bin>")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(inputPath, treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	log.Println("Removing slivers...")
+	size := tree.Max.Sub(tree.Min)
+	volume := size.X * size.Y * size.Z
+	filter := &treed.SliverFilter{
+		MinInradius:        minInradius * size.Norm(),
+		MinLeafVolume:      minLeafVolume * volume,
+		MinComponentVolume: minComponentVolume * volume,
+	}
+	result := filter.Filter(tree)
+	log.Printf(" => removed %d sliver leaves and %d components (%d leaves total)",
+		result.SliverLeaves, result.ComponentsRemoved, result.LeavesRemoved)
+	log.Printf(" => volume removed: %f (%f%% of bounds)", result.VolumeRemoved,
+		100*result.VolumeRemoved/volume)
+
+	log.Println("Saving output...")
+	essentials.Must(treed.Save(outputPath, result.Tree, treed.WriteBoundedSolidTree))
+}
@@ -20,11 +20,13 @@ func main() {
 	var fps float64
 	var frames int
 	var normalMapPath string
+	var leafGraph bool
 	flag.IntVar(&gridSize, "grid-size", 3, "grid size (used for rows and columns)")
 	flag.IntVar(&imageSize, "image-size", 300, "size of each image in the grid")
 	flag.Float64Var(&fps, "fps", 10.0, "FPS for GIF outputs")
 	flag.IntVar(&frames, "frames", 20, "total number of frames for GIF outputs")
 	flag.StringVar(&normalMapPath, "normal-map", "", "path to optional normal map tree")
+	flag.BoolVar(&leafGraph, "leaf-graph", false, "cast rays by walking between neighboring leaves")
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: render_tree [flags] <input.bin> <output.png>")
 		fmt.Fprintln(os.Stderr)
@@ -44,7 +46,13 @@ func main() {
 	essentials.Must(err)
 
 	log.Println("Creating renderable object...")
-	var collider model3d.Collider = treed.NewCollider(tree)
+	var collider model3d.Collider
+	if leafGraph {
+		log.Println(" - Computing leaf graph...")
+		collider = treed.NewLeafGraphCollider(tree)
+	} else {
+		collider = treed.NewCollider(tree)
+	}
 	if normalMapPath != "" {
 		log.Println(" - Loading normal map...")
 		normalMapTrees, err := treed.LoadMultiple(normalMapPath, treed.ReadCoordTree)
@@ -0,0 +1,60 @@
+// Command restructure_tree rearranges the branches of a tree to make it
+// faster to evaluate and render, without changing its predictions.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var numSamples int
+	var numRays int
+	flag.IntVar(&numSamples, "samples", 1000000, "number of points to sample to estimate volumes")
+	flag.IntVar(&numRays, "rays", 100000, "number of rays to cast to estimate render cost")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: restructure_tree [flags] <input.bin> <output.bin>")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(inputPath, treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	log.Println("Sampling points...")
+	samples := make([]model3d.Coord3D, numSamples)
+	for i := range samples {
+		samples[i] = model3d.NewCoord3DRandBounds(tree.Min, tree.Max)
+	}
+
+	log.Println("Restructuring tree...")
+	newTree := treed.Restructure(tree, samples)
+
+	log.Printf(" => leaves: %d -> %d", tree.Tree.NumLeaves(), newTree.Tree.NumLeaves())
+	log.Printf(" => mean depth: %f -> %f", tree.Tree.MeanDepth(samples),
+		newTree.Tree.MeanDepth(samples))
+	if numRays > 0 {
+		oldCost := treed.EstimateRenderCost(tree, numRays)
+		newCost := treed.EstimateRenderCost(newTree, numRays)
+		log.Printf(" => mean nodes tested per ray: %f -> %f", oldCost.NodesTested,
+			newCost.NodesTested)
+	}
+
+	log.Println("Saving output...")
+	essentials.Must(treed.Save(outputPath, newTree, treed.WriteBoundedSolidTree))
+}
@@ -0,0 +1,170 @@
+// Command shape_to_tree fits a tree to an analytic shape described in JSON,
+// and measures its accuracy against the known ground truth.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+	"github.com/unixpickle/tree-d/treed/pipeline"
+)
+
+func main() {
+	var lr float64
+	var weightDecay float64
+	var momentum float64
+	var iters int
+	var taoIters int
+	var depth int
+	var minLeafSize int
+	var initDatasetSize int
+	var minDatasetSize int
+	var axisResolution int
+	var mutationCount int
+	var mutationStddev flagFloats = []float64{0.025}
+	var hitAndRunIterations int
+	var evalSamples int
+	var verbose bool
+	flag.Float64Var(&lr, "lr", 0.1, "learning rate for SVM training")
+	flag.Float64Var(&weightDecay, "weight-decay", 1e-4, "weight decay for SVM training")
+	flag.Float64Var(&momentum, "momentum", 0.9, "Nesterov momentum for SVM training")
+	flag.IntVar(&iters, "iters", 1000, "iterations for SVM training")
+	flag.IntVar(&taoIters, "tao-iters", 50, "maximum iterations of TAO")
+	flag.IntVar(&depth, "depth", 18, "maximum tree depth")
+	flag.IntVar(&minLeafSize, "min-leaf-size", 5, "minimum samples per leaf when splitting")
+	flag.IntVar(&initDatasetSize, "init-dataset-size", 50000,
+		"initial number of points to sample for dataset")
+	flag.IntVar(&minDatasetSize, "min-dataset-size", 1000, "minimum dataset size at leaves")
+	flag.IntVar(&axisResolution, "axis-resolution", 2,
+		"number of icosphere subdivisions to do when creating split axes")
+	flag.IntVar(&mutationCount, "mutation-count", 30, "number of mutation directions")
+	flag.Var(&mutationStddev, "mutation-stddev", "scale of mutations; may be comma-separated list")
+	flag.IntVar(&hitAndRunIterations, "hit-and-run-iterations", 20,
+		"steps of hit-and-run sampling for polytope sampling")
+	flag.IntVar(&evalSamples, "eval-samples", 1000000,
+		"number of points to sample when comparing the tree to the shape")
+	flag.BoolVar(&verbose, "verbose", false, "print out extra optimization information")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: shape_to_tree [flags] <shape.json> <output.bin>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Shapes are JSON objects with a \"type\" field. Primitives are")
+		fmt.Fprintln(os.Stderr, "  sphere (center, radius), box (min, max), cylinder (p1, p2, radius),")
+		fmt.Fprintln(os.Stderr, "  capsule (p1, p2, radius), and torus (center, axis, outer_radius,")
+		fmt.Fprintln(os.Stderr, "  inner_radius).")
+		fmt.Fprintln(os.Stderr, "Operations are union, intersection, difference, and smooth_union")
+		fmt.Fprintln(os.Stderr, "  (smoothness), each with a list of children. For example:")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, `  {"type": "smooth_union", "smoothness": 0.1, "children": [`)
+		fmt.Fprintln(os.Stderr, `    {"type": "sphere", "center": [0, 0, 0], "radius": 1},`)
+		fmt.Fprintln(os.Stderr, `    {"type": "box", "min": [0, -0.3, -0.3], "max": [1.5, 0.3, 0.3]}`)
+		fmt.Fprintln(os.Stderr, `  ]}`)
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	log.Println("Loading shape...")
+	spec, err := treed.Load(inputPath, treed.ReadShapeSpec)
+	essentials.Must(err)
+	sdf, err := spec.SDF()
+	essentials.Must(err)
+
+	oracle := func(c model3d.Coord3D) bool {
+		return sdf.SDF(c) > 0
+	}
+
+	mutationCounts := make([]int, len(mutationStddev))
+	for i := range mutationStddev {
+		mutationCounts[i] = mutationCount
+	}
+	sampler := &treed.HitAndRunSampler[float64, model3d.Coord3D]{
+		Iterations: hitAndRunIterations,
+	}
+	bounds := treed.NewPolytopeBounds(sdf.Min(), sdf.Max())
+	p := &pipeline.Pipeline[bool]{
+		Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			return pipeline.UniformDataset(rng, sdf.Min(), sdf.Max(), oracle, n)
+		},
+		DatasetSize:     initDatasetSize,
+		TestDatasetSize: initDatasetSize,
+		Builder: &pipeline.AdaptiveBuilder[bool]{
+			AxisSchedule: &treed.MutationAxisSchedule[float64, model3d.Coord3D]{
+				Initial: treed.NewConstantAxisScheduleIcosphere(axisResolution).Init(),
+				Counts:  mutationCounts,
+				Stddevs: mutationStddev,
+			},
+			Bounds:     bounds,
+			Oracle:     oracle,
+			Loss:       treed.EntropySplitLoss[float64]{MinCount: minLeafSize},
+			Sampler:    sampler,
+			MinSamples: minDatasetSize,
+			MaxDepth:   depth,
+		},
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:        treed.EqualityTAOLoss[bool]{},
+			LR:          lr,
+			WeightDecay: weightDecay,
+			Momentum:    momentum,
+			Iters:       iters,
+			Verbose:     verbose,
+
+			// Adaptive dataset configuration.
+			MinSamples: minDatasetSize,
+			Sampler:    sampler,
+			Bounds:     bounds,
+			Oracle:     oracle,
+		},
+		TAOIters: taoIters,
+		Logf:     log.Printf,
+	}
+	state := &pipeline.State[bool]{}
+	essentials.Must(p.Run(state))
+	tree := &treed.BoundedSolidTree{Min: sdf.Min(), Max: sdf.Max(), Tree: state.Tree}
+
+	log.Println("Evaluating tree...")
+	metrics := treed.EvaluateOccupancy(tree, oracle, evalSamples)
+	log.Printf(" => leaves=%d accuracy=%f iou=%f volume=%f (true volume %f)",
+		tree.Tree.NumLeaves(), metrics.Accuracy, metrics.IoU, metrics.TreeVolume,
+		metrics.TrueVolume)
+
+	log.Println("Writing output...")
+	essentials.Must(treed.Save(outputPath, tree, treed.WriteBoundedSolidTree))
+}
+
+type flagFloats []float64
+
+func (i *flagFloats) String() string {
+	parts := make([]string, len(*i))
+	for j, x := range *i {
+		parts[j] = strconv.FormatFloat(x, 'f', 0, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (i *flagFloats) Set(value string) error {
+	var res []float64
+	for _, part := range strings.Split(value, ",") {
+		parsed, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected part %q: %w", part, err)
+		}
+		res = append(res, parsed)
+	}
+	*i = res
+	return nil
+}
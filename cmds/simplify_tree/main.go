@@ -15,10 +15,23 @@ import (
 func main() {
 	var maxLeaves int
 	var numSamples int
+	var meshScale float64
+	var centerMesh bool
+	var oracle string
+	var windingBeta float64
 	flag.IntVar(&maxLeaves, "max-leaves", 512, "maximum number of leaves")
 	flag.IntVar(&numSamples, "num-samples", 2000000, "number of point samples to use")
+	flag.StringVar(&oracle, "oracle", "collider",
+		"method for labeling points inside the mesh: 'collider' (ray casting) or 'winding' "+
+			"(generalized winding number, for meshes with holes or self-intersections)")
+	flag.Float64Var(&windingBeta, "winding-beta", 2,
+		"far-field threshold for approximating winding numbers (larger is slower but more accurate; 0 is exact)")
+	flag.Float64Var(&meshScale, "mesh-scale", 1,
+		"scale to apply to the mesh (should match the value used to build the tree)")
+	flag.BoolVar(&centerMesh, "center-mesh", false,
+		"center the mesh bounds at the origin before scaling (should match the tree)")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage: simplify_tree [flags] <input.stl> <input.bin> <output.bin>")
+		fmt.Fprintln(os.Stderr, "Usage: simplify_tree [flags] <input.stl|obj|ply|off> <input.bin> <output.bin>")
 		fmt.Fprintln(os.Stderr)
 		flag.PrintDefaults()
 	}
@@ -36,10 +49,21 @@ func main() {
 	essentials.Must(err)
 
 	log.Println("Loading mesh...")
-	tris, err := treed.Load(meshPath, model3d.ReadSTL)
+	tris, err := treed.LoadMesh(meshPath)
 	essentials.Must(err)
-	mesh := model3d.NewMeshTriangles(tris)
-	meshSolid := model3d.NewColliderSolid(model3d.MeshToCollider(mesh))
+	mesh, removed := treed.PrepareMesh(tris, meshScale, centerMesh)
+	if removed > 0 {
+		log.Printf(" - removed %d degenerate triangles", removed)
+	}
+	var meshSolid model3d.Solid
+	switch oracle {
+	case "collider":
+		meshSolid = model3d.NewColliderSolid(model3d.MeshToCollider(mesh))
+	case "winding":
+		meshSolid = treed.NewWindingNumberSolid(mesh, windingBeta)
+	default:
+		essentials.Die("unknown oracle: " + oracle)
+	}
 
 	log.Println("Sampling points...")
 	points := make([]model3d.Coord3D, numSamples)
@@ -0,0 +1,68 @@
+// Command tree_components reports the connected components of a tree, and
+// can fill internal cavities which are not connected to the outside.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var maxCavityVolume float64
+	flag.Float64Var(&maxCavityVolume, "max-cavity-volume", 0,
+		"if non-zero, only fill cavities up to this volume, relative to the bounding box volume")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: tree_components [flags] <input.bin> [filled_output.bin]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "If an output path is specified, cavities are filled in the output tree.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 && len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(args[0], treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	log.Println("Computing components...")
+	analysis := treed.AnalyzeComponents(tree)
+
+	var numOccupied, numEmpty int
+	var occupiedVolume, emptyVolume float64
+	for _, component := range analysis.Components {
+		if component.Value {
+			numOccupied++
+			occupiedVolume += component.Volume
+		} else {
+			numEmpty++
+			emptyVolume += component.Volume
+		}
+	}
+	cavities := analysis.Cavities()
+	var cavityVolume float64
+	for _, cavity := range cavities {
+		cavityVolume += cavity.Volume
+	}
+	fmt.Printf("Occupied components: %d (volume %f)\n", numOccupied, occupiedVolume)
+	fmt.Printf("Empty components: %d (volume %f)\n", numEmpty, emptyVolume)
+	fmt.Printf("Cavities: %d (volume %f)\n", len(cavities), cavityVolume)
+
+	if len(args) == 2 {
+		size := tree.Max.Sub(tree.Min)
+		filled, count := analysis.FillCavities(maxCavityVolume * size.X * size.Y * size.Z)
+		log.Printf("Filled %d cavities.", count)
+		log.Println("Saving output...")
+		essentials.Must(treed.Save(args[1], filled, treed.WriteBoundedSolidTree))
+	}
+}
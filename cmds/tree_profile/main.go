@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/model3d/render3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var imageSize int
+	var frames int
+	var metric string
+	var leafGraph bool
+	flag.IntVar(&imageSize, "image-size", 200, "size of each rendered view")
+	flag.IntVar(&frames, "frames", 8, "number of views in the camera sweep")
+	flag.StringVar(&metric, "metric", "changes",
+		"metric for the heatmap: 'changes', 'leaves', or 'nodes'")
+	flag.BoolVar(&leafGraph, "leaf-graph", false, "cast rays by walking between neighboring leaves")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: tree_profile [flags] <input.bin> <heatmap.png>")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if frames < 1 {
+		essentials.Die("-frames must be positive")
+	} else if imageSize < 2 {
+		// The camera maps pixels to directions using the image size minus one.
+		essentials.Die("-image-size must be at least 2")
+	}
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	metricIndex := map[string]int{"changes": 0, "leaves": 1, "nodes": 2}
+	heatmapMetric, ok := metricIndex[metric]
+	if !ok {
+		essentials.Die("unknown metric: " + metric)
+	}
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(inputPath, treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	log.Println("Creating collider...")
+	var lastStats treed.RayStats
+	record := treed.RecordRayStats(func(_ *model3d.Ray, stats *treed.RayStats) {
+		lastStats = *stats
+	})
+	var collider *treed.Collider
+	if leafGraph {
+		collider = treed.NewLeafGraphCollider(tree, record)
+	} else {
+		collider = treed.NewCollider(tree, record)
+	}
+	object := render3d.Objectify(collider, nil)
+
+	log.Println("Casting rays...")
+	var results [3][]float64
+	heatmaps := make([][]float64, frames)
+	for i := 0; i < frames; i++ {
+		theta := math.Pi * 2 * float64(i) / float64(frames)
+		direction := model3d.NewMatrix3Rotation(model3d.Z(1), theta).MulColumn(
+			model3d.YZ(-1, 0.1).Normalize(),
+		)
+		camera := render3d.DirectionalCamera(object, direction, math.Pi/3.6)
+		caster := camera.Caster(float64(imageSize-1), float64(imageSize-1))
+		heatmap := make([]float64, 0, imageSize*imageSize)
+		for y := 0; y < imageSize; y++ {
+			for x := 0; x < imageSize; x++ {
+				ray := &model3d.Ray{
+					Origin:    camera.Origin,
+					Direction: caster(float64(x), float64(y)),
+				}
+				collider.FirstRayCollision(ray)
+				values := [3]float64{
+					float64(lastStats.BranchChanges),
+					float64(lastStats.LeavesCrossed),
+					float64(lastStats.NodesTested),
+				}
+				for j, v := range values {
+					results[j] = append(results[j], v)
+				}
+				heatmap = append(heatmap, values[heatmapMetric])
+			}
+		}
+		heatmaps[i] = heatmap
+	}
+
+	fmt.Println("Number of leaves:", tree.Tree.NumLeaves())
+	fmt.Println("Rays cast:", len(results[0]))
+	for i, name := range []string{"Branch changes", "Leaves crossed", "Nodes tested"} {
+		values := results[i]
+		sort.Float64s(values)
+		fmt.Printf(
+			"%s: mean=%.2f p50=%.0f p90=%.0f p99=%.0f max=%.0f\n",
+			name,
+			mean(values),
+			percentile(values, 0.5),
+			percentile(values, 0.9),
+			percentile(values, 0.99),
+			values[len(values)-1],
+		)
+	}
+
+	log.Println("Saving heatmap...")
+	maxValue := percentile(results[heatmapMetric], 0.99)
+	essentials.Must(saveHeatmap(outputPath, heatmaps, imageSize, maxValue))
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, x := range values {
+		sum += x
+	}
+	return sum / float64(len(values))
+}
+
+// percentile computes a percentile of a sorted list.
+func percentile(sorted []float64, frac float64) float64 {
+	idx := int(math.Round(frac * float64(len(sorted)-1)))
+	return sorted[idx]
+}
+
+// saveHeatmap saves the views side-by-side, where the color scale saturates
+// at maxValue.
+func saveHeatmap(path string, heatmaps [][]float64, imageSize int, maxValue float64) error {
+	img := image.NewRGBA(image.Rect(0, 0, imageSize*len(heatmaps), imageSize))
+	for i, heatmap := range heatmaps {
+		for j, value := range heatmap {
+			x, y := j%imageSize, j/imageSize
+			img.Set(x+i*imageSize, y, heatColor(value/math.Max(maxValue, 1)))
+		}
+	}
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return png.Encode(w, img)
+}
+
+// heatColor maps a value in [0, 1] from black through red and yellow to
+// white.
+func heatColor(frac float64) color.Color {
+	frac = math.Max(0, math.Min(1, frac)) * 3
+	channel := func(start float64) uint8 {
+		return uint8(math.Round(255 * math.Max(0, math.Min(1, frac-start))))
+	}
+	return color.RGBA{R: channel(0), G: channel(1), B: channel(2), A: 255}
+}
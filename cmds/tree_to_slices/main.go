@@ -0,0 +1,140 @@
+// Command tree_to_slices exports cross-sections of a tree at evenly spaced
+// heights, for use in additive manufacturing.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model2d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var layerHeight float64
+	var resolution float64
+	var format string
+	var antialias bool
+	flag.Float64Var(&layerHeight, "layer-height", 0,
+		"distance between slices (default is 1/100 of the height of the bounds)")
+	flag.Float64Var(&resolution, "resolution", 0,
+		"pixels per unit length (default is 512 pixels along the largest side)")
+	flag.StringVar(&format, "format", "png", "output format: 'png' or 'svg'")
+	flag.BoolVar(&antialias, "antialias", false, "shade PNG pixels by the area they cover")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: tree_to_slices [flags] <input.bin> <output_dir>")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputDir := args[0], args[1]
+	if format != "png" && format != "svg" {
+		essentials.Die("unknown format: " + format)
+	}
+	// Zero means to use the default for both flags.
+	if layerHeight < 0 {
+		essentials.Die("-layer-height must be positive")
+	} else if resolution < 0 {
+		essentials.Die("-resolution must be positive")
+	}
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(inputPath, treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	size := tree.Max.Sub(tree.Min)
+	if !(size.X > 0 && size.Y > 0 && size.Z > 0) {
+		essentials.Die(fmt.Sprintf("tree bounds have zero size: %v-%v", tree.Min, tree.Max))
+	}
+	if layerHeight == 0 {
+		layerHeight = size.Z / 100
+	}
+	if resolution == 0 {
+		resolution = 512 / math.Max(size.X, size.Y)
+	}
+	width := int(math.Ceil(size.X * resolution))
+	height := int(math.Ceil(size.Y * resolution))
+	numLayers := int(math.Ceil(size.Z / layerHeight))
+
+	essentials.Must(os.MkdirAll(outputDir, 0755))
+	log.Printf("Exporting %d layers...", numLayers)
+	for i := 0; i < numLayers; i++ {
+		// The last layer may be cut off by the bounds, in which case we
+		// slice through the middle of the part that remains.
+		bottom := tree.Min.Z + float64(i)*layerHeight
+		z := bottom + math.Min(layerHeight, tree.Max.Z-bottom)/2
+		slice := treed.SliceBoundedTree(tree, z)
+		path := filepath.Join(outputDir, fmt.Sprintf("layer_%05d.%s", i, format))
+		if format == "png" {
+			pixels := treed.RasterizeSlice(slice, width, height, antialias)
+			essentials.Must(WritePNG(path, pixels, width, height))
+		} else {
+			essentials.Must(WriteSVG(path, slice, width, height))
+		}
+	}
+}
+
+func WritePNG(path string, pixels []float64, width, height int) error {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(math.Round(pixels[x+y*width] * 255))})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+// WriteSVG writes the occupied polygons of a slice as a single path, in
+// units of the tree's coordinate system with the y axis flipped.
+func WriteSVG(path string, slice *treed.BoundedTree[float64, model2d.Coord, bool],
+	width, height int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	size := slice.Max.Sub(slice.Min)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n")
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+		`viewBox="0 0 %f %f">`+"\n", width, height, size.X, size.Y)
+	fmt.Fprintf(w, `<rect width="%f" height="%f" fill="black" />`+"\n", size.X, size.Y)
+	fmt.Fprint(w, `<path fill="white" d="`)
+	for _, poly := range treed.SlicePolygons(slice) {
+		for i, c := range poly {
+			cmd := "L"
+			if i == 0 {
+				cmd = "M"
+			}
+			fmt.Fprintf(w, "%s%f %f ", cmd, c.X-slice.Min.X, slice.Max.Y-c.Y)
+		}
+		fmt.Fprint(w, "Z ")
+	}
+	fmt.Fprintln(w, `" />`)
+	fmt.Fprintln(w, "</svg>")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
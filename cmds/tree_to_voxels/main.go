@@ -0,0 +1,76 @@
+// Command tree_to_voxels converts a tree into a voxel grid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var resolution int
+	var exact bool
+	var sparse bool
+	flag.IntVar(&resolution, "resolution", 64, "number of voxels along the longest side of the bounds")
+	flag.BoolVar(&exact, "exact", false, "compute the exact occupied fraction of each voxel")
+	flag.BoolVar(&sparse, "sparse", false, "only write non-empty voxels (for .raw and .npy outputs)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: tree_to_voxels [flags] <input.bin> <output.raw|.npy|.vox>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Dense .raw outputs contain one byte per voxel, and sparse .raw outputs")
+		fmt.Fprintln(os.Stderr, "contain (int32 x, int32 y, int32 z, float32 value) records.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	var writer func(io.Writer, *treed.VoxelGrid) error
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".raw":
+		writer = treed.WriteVoxelsRaw
+		if sparse {
+			writer = treed.WriteSparseVoxelsRaw
+		}
+	case ".npy":
+		writer = treed.WriteVoxelsNPY
+		if sparse {
+			writer = treed.WriteSparseVoxelsNPY
+		}
+	case ".vox":
+		writer = treed.WriteVoxelsVox
+	default:
+		essentials.Die("unknown output extension: " + filepath.Ext(outputPath))
+	}
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(inputPath, treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	log.Println("Voxelizing...")
+	size := tree.Max.Sub(tree.Min)
+	voxelSize := size.MaxCoord() / float64(resolution)
+	var gridSize [3]int
+	for i, x := range size.Array() {
+		gridSize[i] = essentials.MaxInt(1, int(math.Round(x/voxelSize)))
+	}
+	log.Printf(" => grid size: %dx%dx%d", gridSize[0], gridSize[1], gridSize[2])
+	grid := treed.NewVoxelGridTree(tree, gridSize, exact)
+
+	log.Println("Saving output...")
+	essentials.Must(treed.Save(outputPath, grid, writer))
+}
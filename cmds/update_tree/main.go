@@ -0,0 +1,202 @@
+// Command update_tree retrains the parts of an existing tree that are
+// affected by an edit to its mesh, leaving the rest of the tree unchanged.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func main() {
+	var oldMeshPath string
+	var regionStr string
+	var margin float64
+	var levels int
+	var depth int
+	var minDatasetSize int
+	var axisResolution int
+	var mutationCount int
+	var mutationStddev float64
+	var hitAndRunIterations int
+	var minLeafSize int
+	var lr float64
+	var weightDecay float64
+	var momentum float64
+	var iters int
+	var taoIters int
+	var oracle string
+	var meshScale float64
+	var centerMesh bool
+	var windingBeta float64
+	var verbose bool
+	flag.StringVar(&oldMeshPath, "old-mesh", "",
+		"mesh that the tree was built from, used to find the changed region")
+	flag.StringVar(&regionStr, "region", "",
+		"changed region as 'minX,minY,minZ,maxX,maxY,maxZ', instead of -old-mesh")
+	flag.Float64Var(&margin, "margin", 0.01,
+		"padding around changed triangles, relative to the bounding box diagonal")
+	flag.IntVar(&levels, "levels", 2,
+		"number of levels above each affected leaf to rebuild")
+	flag.IntVar(&depth, "depth", 18, "maximum tree depth")
+	flag.IntVar(&minDatasetSize, "min-dataset-size", 1000, "minimum dataset size at leaves")
+	flag.IntVar(&axisResolution, "axis-resolution", 2,
+		"number of icosphere subdivisions to do when creating split axes")
+	flag.IntVar(&mutationCount, "mutation-count", 30, "number of mutation directions")
+	flag.Float64Var(&mutationStddev, "mutation-stddev", 0.025, "scale of mutations")
+	flag.IntVar(&hitAndRunIterations, "hit-and-run-iterations", 20,
+		"number of hit-and-run steps when sampling points in a polytope")
+	flag.IntVar(&minLeafSize, "min-leaf-size", 5, "minimum samples per leaf when splitting")
+	flag.Float64Var(&lr, "lr", 0.1, "learning rate for SVM training")
+	flag.Float64Var(&weightDecay, "weight-decay", 1e-4, "weight decay for SVM training")
+	flag.Float64Var(&momentum, "momentum", 0.9, "Nesterov momentum for SVM training")
+	flag.IntVar(&iters, "iters", 1000, "iterations for SVM training")
+	flag.IntVar(&taoIters, "tao-iters", 10, "maximum iterations of TAO for each subtree")
+	flag.StringVar(&oracle, "oracle", "collider",
+		"method for labeling points inside the mesh: 'collider' (ray casting) or 'winding' "+
+			"(generalized winding number, for meshes with holes or self-intersections)")
+	flag.Float64Var(&meshScale, "mesh-scale", 1,
+		"scale to apply to the meshes (should match the value used to build the tree)")
+	flag.BoolVar(&centerMesh, "center-mesh", false,
+		"center the meshes at the origin before scaling, using the bounds of -old-mesh if "+
+			"it is passed (should match the tree)")
+	flag.Float64Var(&windingBeta, "winding-beta", 2,
+		"far-field threshold for approximating winding numbers (larger is slower but more accurate; 0 is exact)")
+	flag.BoolVar(&verbose, "verbose", false, "print out extra optimization information")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: update_tree [flags] <new_mesh.stl|obj|ply|off> <input.bin> <output.bin>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Exactly one of -old-mesh or -region must be passed.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 3 || (oldMeshPath == "") == (regionStr == "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+	meshPath, inputPath, outputPath := args[0], args[1], args[2]
+
+	log.Println("Loading tree...")
+	tree, err := treed.Load(inputPath, treed.ReadBoundedSolidTree)
+	essentials.Must(err)
+
+	log.Println("Loading meshes...")
+	newMesh := LoadMesh(meshPath)
+	center := newMesh.Min().Mid(newMesh.Max())
+	var oldMesh *model3d.Mesh
+	if oldMeshPath != "" {
+		oldMesh = LoadMesh(oldMeshPath)
+		center = oldMesh.Min().Mid(oldMesh.Max())
+	}
+	transform := func(m *model3d.Mesh) *model3d.Mesh {
+		if centerMesh {
+			m = m.Translate(center.Scale(-1))
+		}
+		if meshScale != 1 {
+			m = m.Scale(meshScale)
+		}
+		return m
+	}
+	newMesh = transform(newMesh)
+	if min, max := newMesh.Min(), newMesh.Max(); min.Min(tree.Min) != tree.Min ||
+		max.Max(tree.Max) != tree.Max {
+		// The tree bounds are kept, so anything outside of them would be
+		// silently clipped.
+		essentials.Die(fmt.Sprintf("new mesh bounds %v-%v exceed tree bounds %v-%v; "+
+			"rebuild the tree from scratch instead", min, max, tree.Min, tree.Max))
+	}
+
+	var region treed.RegionQuery[float64, model3d.Coord3D]
+	if oldMesh != nil {
+		log.Println("Finding changed region...")
+		oldMesh = transform(oldMesh)
+		changed := treed.MeshChangedRegion(oldMesh, newMesh, margin*tree.Min.Dist(tree.Max))
+		log.Printf(" => found %d changed boxes", len(changed))
+		region = changed
+	} else {
+		region = ParseRegion(regionStr)
+	}
+
+	var meshSolid model3d.Solid
+	switch oracle {
+	case "collider":
+		meshSolid = model3d.NewColliderSolid(model3d.MeshToCollider(newMesh))
+	case "winding":
+		meshSolid = treed.NewWindingNumberSolid(newMesh, windingBeta)
+	default:
+		essentials.Die("unknown oracle: " + oracle)
+	}
+
+	log.Println("Updating tree...")
+	updater := &treed.LocalUpdater{
+		AxisSchedule: &treed.MutationAxisSchedule[float64, model3d.Coord3D]{
+			Initial: treed.NewConstantAxisScheduleIcosphere(axisResolution).Init(),
+			Counts:  []int{mutationCount},
+			Stddevs: []float64{mutationStddev},
+		},
+		Loss: treed.EntropySplitLoss[float64]{MinCount: minLeafSize},
+		Sampler: &treed.HitAndRunSampler[float64, model3d.Coord3D]{
+			Iterations: hitAndRunIterations,
+		},
+		MinSamples: minDatasetSize,
+		Levels:     levels,
+		MaxDepth:   depth,
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:        treed.EqualityTAOLoss[bool]{},
+			LR:          lr,
+			WeightDecay: weightDecay,
+			Momentum:    momentum,
+			Iters:       iters,
+			Verbose:     verbose,
+		},
+		TAOIters: taoIters,
+		Verbose:  verbose,
+	}
+	result := updater.Update(tree, region, meshSolid.Contains)
+	log.Printf(" => %d affected leaves, rebuilt %d subtrees (%d => %d leaves)",
+		result.AffectedLeaves, result.Subtrees, result.OldLeaves, result.NewLeaves)
+	log.Printf(" => tree went from %d to %d leaves", tree.Tree.NumLeaves(),
+		result.Tree.Tree.NumLeaves())
+
+	log.Println("Saving tree...")
+	essentials.Must(treed.Save(outputPath, result.Tree, treed.WriteBoundedSolidTree))
+}
+
+func LoadMesh(path string) *model3d.Mesh {
+	tris, err := treed.LoadMesh(path)
+	essentials.Must(err)
+	mesh, removed := treed.PrepareMesh(tris, 1, false)
+	if removed > 0 {
+		log.Printf(" - removed %d degenerate triangles from %s", removed, path)
+	}
+	return mesh
+}
+
+func ParseRegion(s string) *treed.RectQuery {
+	parts := strings.Split(s, ",")
+	if len(parts) != 6 {
+		essentials.Die("region should have 6 comma-separated values")
+	}
+	var values [6]float64
+	for i, part := range parts {
+		x, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			essentials.Die(fmt.Sprintf("invalid region value %q: %s", part, err))
+		}
+		values[i] = x
+	}
+	return &treed.RectQuery{
+		Min: model3d.XYZ(values[0], values[1], values[2]),
+		Max: model3d.XYZ(values[3], values[4], values[5]),
+	}
+}
@@ -0,0 +1,107 @@
+// Command voxels_to_tree fits a tree to a voxel grid, using the grid as an
+// oracle for random points.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+	"github.com/unixpickle/tree-d/treed/pipeline"
+)
+
+func main() {
+	var voxelSize float64
+	var lr float64
+	var weightDecay float64
+	var momentum float64
+	var iters int
+	var taoIters int
+	var depth int
+	var minLeafSize int
+	var datasetSize int
+	var testDatasetSize int
+	var axisResolution int
+	var verbose bool
+	flag.Float64Var(&voxelSize, "voxel-size", 1, "side length of each voxel in the output tree")
+	flag.Float64Var(&lr, "lr", 0.1, "learning rate for SVM training")
+	flag.Float64Var(&weightDecay, "weight-decay", 1e-4, "weight decay for SVM training")
+	flag.Float64Var(&momentum, "momentum", 0.9, "Nesterov momentum for SVM training")
+	flag.IntVar(&iters, "iters", 1000, "iterations for SVM training")
+	flag.IntVar(&taoIters, "tao-iters", 10, "maximum iterations of TAO")
+	flag.IntVar(&depth, "depth", 16, "maximum tree depth")
+	flag.IntVar(&minLeafSize, "min-leaf-size", 5, "minimum samples per leaf for greedy trees")
+	flag.IntVar(&datasetSize, "dataset-size", 2000000, "number of points to sample for dataset")
+	flag.IntVar(&testDatasetSize, "test-dataset-size", 100000,
+		"number of points to sample for evaluating TAO")
+	flag.IntVar(&axisResolution, "axis-resolution", 2,
+		"number of icosphere subdivisions to do when creating split axes")
+	flag.BoolVar(&verbose, "verbose", false, "print out extra optimization information")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: voxels_to_tree [flags] <input.npy|.vox> <output.bin>")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath, outputPath := args[0], args[1]
+
+	var reader func(io.Reader) (*treed.VoxelGrid, error)
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".npy":
+		reader = treed.ReadVoxelsNPY
+	case ".vox":
+		reader = treed.ReadVoxelsVox
+	default:
+		essentials.Die("unknown input extension: " + filepath.Ext(inputPath))
+	}
+
+	log.Println("Loading voxels...")
+	grid, err := treed.Load(inputPath, reader)
+	essentials.Must(err)
+	grid.Max = grid.Max.Scale(voxelSize)
+	log.Printf(" => grid size: %dx%dx%d", grid.Size[0], grid.Size[1], grid.Size[2])
+
+	p := &pipeline.Pipeline[bool]{
+		Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			return pipeline.UniformDataset(rng, grid.Min, grid.Max, grid.Contains, n)
+		},
+		DatasetSize:     datasetSize,
+		TestDatasetSize: testDatasetSize,
+		Builder: &pipeline.GreedyBuilder[bool]{
+			Axes:     treed.NewConstantAxisScheduleIcosphere(axisResolution).Init(),
+			Loss:     treed.EntropySplitLoss[float64]{MinCount: minLeafSize},
+			MaxDepth: depth,
+		},
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:        treed.EqualityTAOLoss[bool]{},
+			LR:          lr,
+			WeightDecay: weightDecay,
+			Momentum:    momentum,
+			Iters:       iters,
+			Verbose:     verbose,
+		},
+		TAOIters: taoIters,
+		Simplify: true,
+		Logf:     log.Printf,
+	}
+	state := &pipeline.State[bool]{}
+	essentials.Must(p.Run(state))
+
+	log.Println("Writing output...")
+	boundedTree := &treed.BoundedSolidTree{Min: grid.Min, Max: grid.Max, Tree: state.Tree}
+	essentials.Must(treed.Save(outputPath, boundedTree, treed.WriteBoundedSolidTree))
+}
@@ -3,6 +3,7 @@ package treed
 import (
 	"math"
 	"math/rand"
+	"sort"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/model3d/model3d"
@@ -36,6 +37,12 @@ type ConstantAxisSchedule[F constraints.Float, C Coord[F, C]] []C
 // The splits argument determines the number of sub-divisions.
 func NewConstantAxisScheduleIcosphere(splits int) ConstantAxisSchedule[float64, model3d.Coord3D] {
 	axes := model3d.NewMeshIcosphere(model3d.Origin, 1.0, splits).VertexSlice()
+
+	// The vertices are in a random order, but ties between axes are broken by
+	// their order, so we sort them to make tree building reproducible.
+	sort.Slice(axes, func(i, j int) bool {
+		return coordLess(axes[i], axes[j])
+	})
 	axes = append(axes, model3d.X(1), model3d.Y(1), model3d.Z(1))
 
 	// Remove redundant directions.
@@ -145,6 +152,53 @@ func AdaptiveGreedyTree[F constraints.Float, C Coord[F, C], T any](
 	)
 }
 
+// GrowAdaptiveGreedyTree is like GrowGreedyTree, except that new subtrees are
+// built with AdaptiveGreedyTree() within the polytope of each leaf.
+//
+// The bounds argument is the polytope of the root of t.
+func GrowAdaptiveGreedyTree[F constraints.Float, C Coord[F, C], T any](
+	t *Tree[F, C, T],
+	axisSchedule AxisSchedule[F, C],
+	bounds Polytope[F, C],
+	coords []C,
+	labels []T,
+	oracle func(c C) T,
+	loss SplitLoss[F, T],
+	sampler PolytopeSampler[F, C],
+	minSamples int,
+	concurrency int,
+	maxDepth int,
+) *Tree[F, C, T] {
+	data := groupByLeaf(t, coords, labels, nil)
+
+	replacements := map[*Tree[F, C, T]]*Tree[F, C, T]{}
+	var findLeaves func(t *Tree[F, C, T], p Polytope[F, C], depth int)
+	findLeaves = func(t *Tree[F, C, T], p Polytope[F, C], depth int) {
+		if !t.IsLeaf() {
+			findLeaves(t.LessThan, p.Constrain(t.Axis, t.Threshold), depth+1)
+			findLeaves(t.GreaterEqual, p.Constrain(t.Axis.Scale(-1), -t.Threshold), depth+1)
+			return
+		}
+		if d, ok := data[t]; ok && depth < maxDepth {
+			replacements[t] = adaptiveGreedyTree(
+				axisSchedule,
+				p,
+				d.Coords,
+				d.Labels,
+				oracle,
+				loss,
+				sampler,
+				minSamples,
+				concurrency,
+				maxDepth-depth,
+			)
+		}
+	}
+	findLeaves(t, bounds, 0)
+
+	return replaceLeaves(t, replacements)
+}
+
 func adaptiveGreedyTree[F constraints.Float, C Coord[F, C], T any](
 	axisSchedule AxisSchedule[F, C],
 	bounds Polytope[F, C],
@@ -60,27 +60,37 @@ func TreeSolid(b *BoundedSolidTree) model3d.Solid {
 	)
 }
 
+// TreePolytopes computes the polytopes of the occupied leaves of a tree.
 func TreePolytopes(b *BoundedSolidTree) []model3d.ConvexPolytope {
-	boundsPoly := model3d.NewConvexPolytopeRect(b.Min, b.Max)
-	return computePolytopes(b.Tree, boundsPoly)
+	var res []model3d.ConvexPolytope
+	leaves := b.Tree.Leaves()
+	for i, p := range LeafPolytopes(b) {
+		if leaves[i].Leaf {
+			res = append(res, p)
+		}
+	}
+	return res
 }
 
-func computePolytopes(
-	tree *SolidTree,
-	polytope model3d.ConvexPolytope,
-) []model3d.ConvexPolytope {
-	if tree.IsLeaf() {
-		if tree.Leaf == true {
-			return []model3d.ConvexPolytope{append(model3d.ConvexPolytope{}, polytope...)}
-		} else {
-			return []model3d.ConvexPolytope{}
+// LeafPolytopes computes the polytope of every leaf in a bounded tree,
+// ordered by Tree.Leaves().
+func LeafPolytopes[T any](b *BoundedTree[float64, model3d.Coord3D, T]) []model3d.ConvexPolytope {
+	var res []model3d.ConvexPolytope
+	var iterate func(t *Tree[float64, model3d.Coord3D, T], region model3d.ConvexPolytope)
+	iterate = func(t *Tree[float64, model3d.Coord3D, T], region model3d.ConvexPolytope) {
+		if t.IsLeaf() {
+			res = append(res, append(model3d.ConvexPolytope{}, region...))
+			return
 		}
+		iterate(t.LessThan, append(region, &model3d.LinearConstraint{
+			Normal: t.Axis,
+			Max:    t.Threshold,
+		}))
+		iterate(t.GreaterEqual, append(region, &model3d.LinearConstraint{
+			Normal: t.Axis.Scale(-1),
+			Max:    -t.Threshold,
+		}))
 	}
-	subPoly := append(
-		polytope,
-		&model3d.LinearConstraint{Normal: tree.Axis, Max: tree.Threshold},
-	)
-	results := computePolytopes(tree.LessThan, subPoly)
-	subPoly[len(subPoly)-1] = &model3d.LinearConstraint{Normal: tree.Axis.Scale(-1), Max: -tree.Threshold}
-	return append(results, computePolytopes(tree.GreaterEqual, subPoly)...)
+	iterate(b.Tree, model3d.NewConvexPolytopeRect(b.Min, b.Max))
+	return res
 }
@@ -0,0 +1,268 @@
+package treed
+
+import (
+	"math"
+
+	"github.com/unixpickle/model3d/model3d"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize/convex/lp"
+)
+
+// A BoxTree mirrors the structure of a 3D tree, storing a tight axis-aligned
+// bounding box around the region of space which reaches each node.
+//
+// Boxes are clipped to the bounds of the original tree. Unreachable nodes
+// have empty boxes, where Min is greater than Max.
+type BoxTree[T any] struct {
+	Min model3d.Coord3D
+	Max model3d.Coord3D
+
+	Tree         *Tree[float64, model3d.Coord3D, T]
+	LessThan     *BoxTree[T]
+	GreaterEqual *BoxTree[T]
+}
+
+// NewBoxTree computes the bounding box of every node in a bounded tree.
+//
+// Each box is found by solving linear programs over the constraints of the
+// node's ancestors. When a numerical issue prevents a linear program from
+// being solved, the parent's bound is used instead, so boxes are always
+// conservative.
+func NewBoxTree[T any](b *BoundedTree[float64, model3d.Coord3D, T]) *BoxTree[T] {
+	center := b.Min.Mid(b.Max)
+	scale := b.Max.Sub(b.Min).Scale(0.5).Max(model3d.XYZ(1e-8, 1e-8, 1e-8))
+	root := &boxTreeRegion{
+		Min:         b.Min,
+		Max:         b.Max,
+		Constraints: model3d.NewConvexPolytopeRect(b.Min, b.Max),
+	}
+	for i := 0; i < 6; i++ {
+		// Any point on a face of the bounds is optimal for the
+		// corresponding direction.
+		if i%2 == 0 {
+			root.Extremes[i] = b.Min
+		} else {
+			root.Extremes[i] = b.Max
+		}
+		root.HasExtreme[i] = true
+	}
+	builder := &boxTreeBuilder[T]{
+		Center:  center,
+		Scale:   scale,
+		Epsilon: scale.MaxCoord() * 1e-8,
+		Queue:   newForkQueue[*BoxTree[T]](0),
+	}
+	return builder.Queue.Run(func() *BoxTree[T] {
+		return builder.Build(b.Tree, root)
+	})
+}
+
+// IsLeaf returns true if the node corresponds to a leaf of the tree.
+func (b *BoxTree[T]) IsLeaf() bool {
+	return b.Tree.IsLeaf()
+}
+
+// Empty returns true if no point in the bounds reaches the node.
+func (b *BoxTree[T]) Empty() bool {
+	return b.Min.X > b.Max.X || b.Min.Y > b.Max.Y || b.Min.Z > b.Max.Z
+}
+
+// RayInterval computes the range of scales [minT, maxT] for which the ray
+// passes through the node's box, restricted to the range of scales that is
+// passed in. The final return value is false if the range is empty.
+func (b *BoxTree[T]) RayInterval(r *model3d.Ray, minT, maxT float64) (float64, float64, bool) {
+	if b.Empty() {
+		return 0, 0, false
+	}
+	minT, maxT, _, _ = rayBoxInterval(b.Min, b.Max, r, minT, maxT)
+	return minT, maxT, minT <= maxT
+}
+
+// rayBoxInterval clips the range of scales [minT, maxT] to the scales where
+// a ray is within a box, returning the new range along with the axes of the
+// faces where the ray enters and exits the box.
+//
+// If a bound of the range is not changed, the corresponding axis is zero.
+func rayBoxInterval(
+	min, max model3d.Coord3D,
+	r *model3d.Ray,
+	minT, maxT float64,
+) (newMinT, newMaxT float64, minAxis, maxAxis model3d.Coord3D) {
+	minArr, maxArr := min.Array(), max.Array()
+	origin, direction := r.Origin.Array(), r.Direction.Array()
+	for i := 0; i < 3; i++ {
+		if direction[i] == 0 {
+			if origin[i] < minArr[i] || origin[i] > maxArr[i] {
+				return 0, -1, minAxis, maxAxis
+			}
+			continue
+		}
+		t1 := (minArr[i] - origin[i]) / direction[i]
+		t2 := (maxArr[i] - origin[i]) / direction[i]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		var axis [3]float64
+		axis[i] = 1
+		if t1 > minT {
+			minT = t1
+			minAxis = model3d.NewCoord3DArray(axis)
+		}
+		if t2 < maxT {
+			maxT = t2
+			maxAxis = model3d.NewCoord3DArray(axis)
+		}
+	}
+	return minT, maxT, minAxis, maxAxis
+}
+
+// boxTreeRegion stores the constraints of a node along with its bounding box
+// and the optimal solutions used to produce the box.
+type boxTreeRegion struct {
+	Min model3d.Coord3D
+	Max model3d.Coord3D
+
+	Constraints model3d.ConvexPolytope
+
+	// Extremes stores a point in the region minimizing or maximizing each
+	// coordinate, in the order min X, max X, min Y, etc.
+	Extremes   [6]model3d.Coord3D
+	HasExtreme [6]bool
+}
+
+func (b *boxTreeRegion) Empty() bool {
+	return b.Min.X > b.Max.X || b.Min.Y > b.Max.Y || b.Min.Z > b.Max.Z
+}
+
+type boxTreeBuilder[T any] struct {
+	// Center and Scale are used to normalize coordinates, so that the
+	// linear programs are well-conditioned.
+	Center  model3d.Coord3D
+	Scale   model3d.Coord3D
+	Epsilon float64
+
+	Queue *forkQueue[*BoxTree[T]]
+}
+
+func (b *boxTreeBuilder[T]) Build(
+	t *Tree[float64, model3d.Coord3D, T],
+	region *boxTreeRegion,
+) *BoxTree[T] {
+	res := &BoxTree[T]{
+		Min:  region.Min,
+		Max:  region.Max,
+		Tree: t,
+	}
+	if t.IsLeaf() {
+		return res
+	}
+	lessThan := b.childRegion(region, &model3d.LinearConstraint{
+		Normal: t.Axis,
+		Max:    t.Threshold,
+	})
+	greaterEqual := b.childRegion(region, &model3d.LinearConstraint{
+		Normal: t.Axis.Scale(-1),
+		Max:    -t.Threshold,
+	})
+	res.LessThan, res.GreaterEqual = b.Queue.Fork(
+		func() *BoxTree[T] {
+			return b.Build(t.LessThan, lessThan)
+		},
+		func() *BoxTree[T] {
+			return b.Build(t.GreaterEqual, greaterEqual)
+		},
+	)
+	return res
+}
+
+func (b *boxTreeBuilder[T]) childRegion(
+	parent *boxTreeRegion,
+	constraint *model3d.LinearConstraint,
+) *boxTreeRegion {
+	if parent.Empty() {
+		return parent
+	}
+
+	// Check if the box is entirely on one side of the constraint.
+	n := constraint.Normal
+	minDot := n.Mul(parent.Min).Min(n.Mul(parent.Max)).Sum()
+	maxDot := n.Mul(parent.Min).Max(n.Mul(parent.Max)).Sum()
+	if maxDot <= constraint.Max {
+		return parent
+	} else if minDot > constraint.Max+b.Epsilon*n.Norm() {
+		return &boxTreeRegion{
+			Min: model3d.XYZ(1, 1, 1).Scale(math.Inf(1)),
+			Max: model3d.XYZ(1, 1, 1).Scale(math.Inf(-1)),
+		}
+	}
+
+	res := &boxTreeRegion{
+		Min:         parent.Min,
+		Max:         parent.Max,
+		Constraints: make(model3d.ConvexPolytope, len(parent.Constraints)+1),
+	}
+	copy(res.Constraints, parent.Constraints)
+	res.Constraints[len(parent.Constraints)] = constraint
+
+	minArr, maxArr := res.Min.Array(), res.Max.Array()
+	for i := 0; i < 6; i++ {
+		if parent.HasExtreme[i] && constraint.Contains(parent.Extremes[i]) {
+			// The optimum is unaffected by the new constraint.
+			res.Extremes[i] = parent.Extremes[i]
+			res.HasExtreme[i] = true
+			continue
+		}
+		point, ok := b.solveExtreme(res.Constraints, i)
+		if !ok {
+			continue
+		}
+		res.Extremes[i] = point
+		res.HasExtreme[i] = true
+		axis := i / 2
+		value := point.Array()[axis]
+		if i%2 == 0 {
+			minArr[axis] = math.Max(minArr[axis], value-b.Epsilon)
+		} else {
+			maxArr[axis] = math.Min(maxArr[axis], value+b.Epsilon)
+		}
+	}
+	res.Min = model3d.NewCoord3DArray(minArr)
+	res.Max = model3d.NewCoord3DArray(maxArr)
+	return res
+}
+
+// solveExtreme finds a point within the constraints that minimizes (for even
+// indices) or maximizes (for odd indices) the coordinate at index/2.
+func (b *boxTreeBuilder[T]) solveExtreme(
+	constraints model3d.ConvexPolytope,
+	index int,
+) (model3d.Coord3D, bool) {
+	g := mat.NewDense(len(constraints), 3, nil)
+	h := make([]float64, len(constraints))
+	for i, l := range constraints {
+		normal := l.Normal.Mul(b.Scale)
+		max := l.Max - l.Normal.Dot(b.Center)
+		norm := normal.Norm()
+		if norm == 0 {
+			return model3d.Coord3D{}, false
+		}
+		normal = normal.Scale(1 / norm)
+		g.Set(i, 0, normal.X)
+		g.Set(i, 1, normal.Y)
+		g.Set(i, 2, normal.Z)
+		h[i] = max / norm
+	}
+	c := make([]float64, 3)
+	if index%2 == 0 {
+		c[index/2] = 1
+	} else {
+		c[index/2] = -1
+	}
+	cNew, aNew, bNew := lp.Convert(c, g, h, nil, nil)
+	_, x, err := lp.Simplex(cNew, aNew, bNew, 1e-10, nil)
+	if err != nil {
+		return model3d.Coord3D{}, false
+	}
+	solution := model3d.XYZ(x[0]-x[3], x[1]-x[4], x[2]-x[5])
+	return solution.Mul(b.Scale).Add(b.Center), true
+}
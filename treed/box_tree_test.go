@@ -0,0 +1,56 @@
+package treed
+
+import (
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestBoxTree(t *testing.T) {
+	bounded := testTree()
+	boxes := NewBoxTree(bounded)
+
+	// Track the actual bounds of points reaching each node.
+	type pointBounds struct {
+		Min   model3d.Coord3D
+		Max   model3d.Coord3D
+		Count int
+	}
+	actual := map[*BoxTree[bool]]*pointBounds{}
+	for i := 0; i < 100000; i++ {
+		c := model3d.NewCoord3DRandBounds(bounded.Min, bounded.Max)
+		node := boxes
+		for {
+			if b, ok := actual[node]; ok {
+				b.Min = b.Min.Min(c)
+				b.Max = b.Max.Max(c)
+				b.Count++
+			} else {
+				actual[node] = &pointBounds{Min: c, Max: c, Count: 1}
+			}
+			if node.Min.Min(c) != node.Min || node.Max.Max(c) != node.Max {
+				t.Fatalf("point %v is outside box %v-%v", c, node.Min, node.Max)
+			}
+			if node.IsLeaf() {
+				break
+			}
+			if node.Tree.Axis.Dot(c) < node.Tree.Threshold {
+				node = node.LessThan
+			} else {
+				node = node.GreaterEqual
+			}
+		}
+	}
+
+	// Make sure the boxes are tight, at least for nodes with
+	// enough samples to estimate their bounds.
+	for node, b := range actual {
+		if b.Count < 1000 {
+			continue
+		}
+		if node.Min.Dist(b.Min) > 0.05 || node.Max.Dist(b.Max) > 0.05 {
+			t.Errorf("box %v-%v is not tight around points %v-%v",
+				node.Min, node.Max, b.Min, b.Max)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"math"
 	"sync"
 
-	"github.com/unixpickle/essentials"
+	"github.com/pkg/errors"
+	"github.com/unixpickle/model3d/model2d"
 	"github.com/unixpickle/model3d/model3d"
+	"golang.org/x/exp/constraints"
 )
 
 // A NormalMap is a function that maps 3D spatial coordinates to normal
@@ -45,21 +47,91 @@ func (n *normalMapCollider) FirstRayCollision(r *model3d.Ray) (collision model3d
 	return
 }
 
+// LeafCollision is the extra information attached to every ray collision
+// reported by a Collider.
+type LeafCollision struct {
+	// LeafIndex is the index of the leaf that the ray enters at the collision,
+	// in the order given by Tree.Leaves() on the original (unbounded) tree.
+	// It is -1 if the ray is leaving the bounds of the tree.
+	LeafIndex int
+
+	// PrevLeafIndex is like LeafIndex, but for the leaf that the ray exits at
+	// the collision.
+	PrevLeafIndex int
+}
+
 // A Collider implements model3d.Collider for a wrapped boolean tree.
+//
+// Ray collisions report a *LeafCollision in their Extra field.
+//
+// Rays are clipped to the bounds of the tree, and then traverse the tree
+// using a BoxTree to skip subtrees whose regions the ray does not reach.
+// The BoxTree is built on the first ray cast, so that colliders which are
+// only used for other queries do not pay for it.
+// Alternatively, a Collider created with NewLeafGraphCollider walks directly
+// from leaf to leaf using a LeafGraph.
 type Collider struct {
-	min, max model3d.Coord3D
-	tree     *SolidTree
+	min, max    model3d.Coord3D
+	tree        *SolidTree
+	bounded     *BoundedSolidTree
+	boxesOnce   sync.Once
+	boxes       *BoxTree[bool]
+	graph       *LeafGraph[bool]
+	leafIndices *LeafIndexer[float64, model3d.Coord3D, bool]
+	rayStats    func(r *model3d.Ray, stats *RayStats)
+}
+
+// A ColliderOption configures a Collider.
+type ColliderOption func(c *Collider)
+
+// RayStats records the work done by a Collider for a single ray cast.
+type RayStats struct {
+	// BranchChanges is the number of times the ray moved into a different
+	// leaf (or into or out of the bounds), matching the number of changes
+	// counted by the web viewer.
+	BranchChanges int
 
-	lock          sync.RWMutex
-	truePolytopes []model3d.Collider
+	// LeavesCrossed is the number of leaves within the bounds that the ray
+	// visited.
+	LeavesCrossed int
+
+	// NodesTested is the number of tree nodes (or neighboring leaves, for a
+	// leaf graph) that were tested against the ray.
+	NodesTested int
+}
+
+// RecordRayStats creates an option which calls f with the statistics of
+// every ray cast. Since rays may be cast concurrently, f must be safe to call
+// from multiple Goroutines.
+func RecordRayStats(f func(r *model3d.Ray, stats *RayStats)) ColliderOption {
+	return func(c *Collider) {
+		c.rayStats = f
+	}
 }
 
-func NewCollider(b *BoundedSolidTree) *Collider {
-	return &Collider{
-		min:  b.Min,
-		max:  b.Max,
-		tree: b.AsTree(false, model3d.X(1), model3d.Y(1), model3d.Z(1)),
+func NewCollider(b *BoundedSolidTree, opts ...ColliderOption) *Collider {
+	res := &Collider{
+		min:         b.Min,
+		max:         b.Max,
+		tree:        b.AsTree(false, model3d.X(1), model3d.Y(1), model3d.Z(1)),
+		bounded:     b,
+		leafIndices: NewLeafIndexer(b.Tree),
 	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// NewLeafGraphCollider creates a Collider which casts rays by walking from
+// each leaf to its neighbors, rather than by traversing the tree.
+//
+// The results are identical to a Collider from NewCollider. Which of the two
+// is faster depends on the tree, so it is worth profiling both.
+func NewLeafGraphCollider(b *BoundedSolidTree, opts ...ColliderOption) *Collider {
+	res := NewCollider(b, opts...)
+	res.graph = NewLeafGraph(b)
+	return res
 }
 
 func (c *Collider) Min() model3d.Coord3D {
@@ -85,175 +157,412 @@ func (c *Collider) FirstRayCollision(r *model3d.Ray) (collision model3d.RayColli
 }
 
 func (c *Collider) rayCollisions(r *model3d.Ray, firstOnly bool, f func(model3d.RayCollision)) (count int) {
-	curPoint := r.Origin
-	curT := 0.0
-	prevValue := c.tree.Predict(curPoint)
-
-	c.tree.RayChangePoints(curPoint, r.Direction, func(t float64, p, n model3d.Coord3D) bool {
-		curT += t
-		newValue := c.tree.Predict(p)
-		if newValue == prevValue {
+	if isDegenerateRay[float64](r.Origin, r.Direction) {
+		return
+	}
+	prevLeaf := c.tree.FindLeaf(r.Origin)
+	prevValue := prevLeaf.Leaf
+	prevIndex := c.leafIndex(prevLeaf)
+
+	var stats RayStats
+	if c.rayStats != nil {
+		defer func() {
+			c.rayStats(r, &stats)
+		}()
+	}
+
+	// Returns false if iteration should stop.
+	handleLeaf := func(t float64, axis model3d.Coord3D, value bool, index int) bool {
+		if index != prevIndex {
+			stats.BranchChanges++
+		}
+		if value == prevValue {
+			prevIndex = index
 			return true
 		}
-
-		prevValue = newValue
 		count++
 		if f != nil {
-			if !newValue {
-				n = n.Scale(-1)
+			normal := axis.Normalize()
+			if (normal.Dot(r.Direction) < 0) != value {
+				normal = normal.Scale(-1)
 			}
 			f(model3d.RayCollision{
-				Scale:  curT,
-				Normal: n,
+				Scale:  t,
+				Normal: normal,
+				Extra: &LeafCollision{
+					LeafIndex:     index,
+					PrevLeafIndex: prevIndex,
+				},
 			})
 		}
-		if firstOnly {
-			return false
-		}
-		return true
-	})
+		prevValue = value
+		prevIndex = index
+		return !firstOnly
+	}
 
-	return count
+	minT, maxT, minAxis, maxAxis := rayBoxInterval(c.min, c.max, r, 0, math.Inf(1))
+	if minT >= maxT {
+		return
+	}
+	handleTreeLeaf := func(leaf *SolidTree, t float64, axis model3d.Coord3D) bool {
+		stats.LeavesCrossed++
+		return handleLeaf(t, axis, leaf.Leaf, c.leafIndex(leaf))
+	}
+	var completed bool
+	if c.graph != nil {
+		completed = c.graphRayLeaves(r, minT, maxT, minAxis, &stats, handleTreeLeaf)
+	} else {
+		completed = c.rayLeaves(c.boxTree(), r, minT, maxT, minAxis, &stats, handleTreeLeaf)
+	}
+	if completed {
+		handleLeaf(maxT, maxAxis, false, -1)
+	}
+	return
 }
 
-func (c *Collider) SphereCollision(center model3d.Coord3D, r float64) bool {
-	c.lock.RLock()
-	polytopes := c.truePolytopes
-	c.lock.RUnlock()
-	if polytopes == nil {
-		c.lock.Lock()
-		if c.truePolytopes == nil {
-			polytopes := computePolytopes(c.tree, model3d.ConvexPolytope{})
-			c.truePolytopes = make([]model3d.Collider, len(polytopes))
-			essentials.ConcurrentMap(0, len(polytopes), func(i int) {
-				m := polytopes[i].Mesh()
-				c.truePolytopes[i] = model3d.MeshToCollider(m)
-			})
+// rayLeaves calls f for each leaf that a ray passes through between the
+// scales minT and maxT, in order along the ray.
+//
+// The leaf is passed along with the scale where the ray enters it, and the
+// axis of the plane through which the ray entered the leaf.
+//
+// If f returns false, iteration is terminated early, and false is returned.
+func (c *Collider) rayLeaves(
+	node *BoxTree[bool],
+	r *model3d.Ray,
+	minT, maxT float64,
+	entryAxis model3d.Coord3D,
+	stats *RayStats,
+	f func(leaf *SolidTree, t float64, axis model3d.Coord3D) bool,
+) bool {
+	stats.NodesTested++
+	if _, _, ok := node.RayInterval(r, minT, maxT); !ok {
+		return true
+	}
+	t := node.Tree
+	if t.IsLeaf() {
+		return f(t, minT, entryAxis)
+	}
+	dirDot := t.Axis.Dot(r.Direction)
+	curDot := t.Axis.Dot(r.Origin)
+	if dirDot == 0 {
+		child := node.LessThan
+		if curDot >= t.Threshold {
+			child = node.GreaterEqual
 		}
-		polytopes = c.truePolytopes
-		c.lock.Unlock()
+		return c.rayLeaves(child, r, minT, maxT, entryAxis, stats, f)
 	}
-	for _, polytope := range polytopes {
-		if polytope.SphereCollision(center, r) {
-			return true
+
+	splitT := (t.Threshold - curDot) / dirDot
+	near, far := node.LessThan, node.GreaterEqual
+	if dirDot < 0 {
+		near, far = far, near
+	}
+	if minT < splitT {
+		if !c.rayLeaves(near, r, minT, math.Min(maxT, splitT), entryAxis, stats, f) {
+			return false
 		}
 	}
-	return false
+	if splitT < maxT {
+		farAxis := entryAxis
+		if splitT >= minT {
+			farAxis = t.Axis
+		}
+		if !c.rayLeaves(far, r, math.Max(minT, splitT), maxT, farAxis, stats, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// graphRayLeaves is like rayLeaves, but walks through the leaf graph rather
+// than the tree.
+//
+// The first leaf is found using the tree, and the tree is also used as a
+// fallback whenever the next leaf is not a neighbor of the current one, for
+// example when the ray passes exactly through an edge.
+func (c *Collider) graphRayLeaves(
+	r *model3d.Ray,
+	minT, maxT float64,
+	minAxis model3d.Coord3D,
+	stats *RayStats,
+	f func(leaf *SolidTree, t float64, axis model3d.Coord3D) bool,
+) bool {
+	cur := -1
+	var curT float64
+	var curAxis model3d.Coord3D
+	firstLeaf := func(leaf *SolidTree, t float64, axis model3d.Coord3D) bool {
+		cur, curT, curAxis = c.leafIndex(leaf), t, axis
+		return false
+	}
+	c.rayLeaves(c.boxTree(), r, minT, maxT, minAxis, stats, firstLeaf)
+
+	for cur != -1 {
+		if !f(c.graph.Leaves[cur], curT, curAxis) {
+			return false
+		}
+		_, exitT, _, _ := c.graph.rayInterval(cur, r, minT, maxT, minAxis)
+		if exitT >= maxT {
+			break
+		}
+		next := -1
+		var exitAxis model3d.Coord3D
+	FaceLoop:
+		for _, face := range c.graph.Faces[cur] {
+			dirDot := face.Axis.Dot(r.Direction)
+			if dirDot == 0 || (dirDot > 0) == face.GreaterEqual {
+				// The ray cannot exit through this face.
+				continue
+			}
+			if (face.Threshold-face.Axis.Dot(r.Origin))/dirDot != exitT {
+				continue
+			}
+			exitAxis = face.Axis
+			for _, neighbor := range face.Neighbors {
+				stats.NodesTested++
+				t, _, axis, ok := c.graph.rayInterval(neighbor, r, minT, maxT, minAxis)
+				if ok && t == exitT {
+					next, curT, curAxis = neighbor, t, axis
+					break FaceLoop
+				}
+			}
+		}
+		if next == -1 {
+			cur = -1
+			c.rayLeaves(c.boxTree(), r, exitT, maxT, exitAxis, stats, firstLeaf)
+		} else {
+			cur = next
+		}
+	}
+	return true
+}
+
+func (c *Collider) boxTree() *BoxTree[bool] {
+	c.boxesOnce.Do(func() {
+		c.boxes = NewBoxTree(c.bounded)
+	})
+	return c.boxes
+}
+
+func (c *Collider) leafIndex(leaf *SolidTree) int {
+	return c.leafIndices.Index(leaf)
+}
+
+// SphereCollision checks if any occupied region of the tree intersects a
+// sphere.
+//
+// This descends the tree, only visiting branches whose half-spaces touch the
+// sphere, and then computes the exact distance from the sphere's center to
+// each reachable occupied polytope.
+func (c *Collider) SphereCollision(center model3d.Coord3D, r float64) bool {
+	return c.polytopeCollision(
+		c.tree,
+		model3d.ConvexPolytope{},
+		func(l *model3d.LinearConstraint) bool {
+			return l.Normal.Dot(center)-l.Max <= r*l.Normal.Norm()
+		},
+		func(p model3d.ConvexPolytope) bool {
+			_, dist, ok := PolytopeClosestPoint(p, center)
+			return ok && dist <= r
+		},
+	)
 }
 
-func (c *Collider) computePolytopes(
+// RectCollision checks if any occupied region of the tree intersects an
+// axis-aligned box.
+func (c *Collider) RectCollision(rect *model3d.Rect) bool {
+	boxConstraints := model3d.NewConvexPolytopeRect(rect.MinVal, rect.MaxVal)
+	return c.polytopeCollision(
+		c.tree,
+		model3d.ConvexPolytope{},
+		func(l *model3d.LinearConstraint) bool {
+			minDot := l.Normal.Mul(rect.MinVal).Min(l.Normal.Mul(rect.MaxVal)).Sum()
+			return minDot <= l.Max
+		},
+		func(p model3d.ConvexPolytope) bool {
+			return PolytopeNonEmpty(append(p, boxConstraints...))
+		},
+	)
+}
+
+// SegmentCollision checks if any occupied region of the tree intersects a
+// line segment.
+func (c *Collider) SegmentCollision(seg model3d.Segment) bool {
+	return c.polytopeCollision(
+		c.tree,
+		model3d.ConvexPolytope{},
+		func(l *model3d.LinearConstraint) bool {
+			return math.Min(l.Normal.Dot(seg[0]), l.Normal.Dot(seg[1])) <= l.Max
+		},
+		func(p model3d.ConvexPolytope) bool {
+			minT, maxT := 0.0, 1.0
+			direction := seg[1].Sub(seg[0])
+			for _, l := range p {
+				dot := l.Normal.Dot(direction)
+				offset := l.Max - l.Normal.Dot(seg[0])
+				if dot == 0 {
+					if offset < 0 {
+						return false
+					}
+				} else if dot > 0 {
+					maxT = math.Min(maxT, offset/dot)
+				} else {
+					minT = math.Max(minT, offset/dot)
+				}
+			}
+			return minT <= maxT
+		},
+	)
+}
+
+// polytopeCollision descends the tree while tracking the polytope of each
+// branch, skipping half-spaces for which touches() returns false, and then
+// checks each reachable occupied leaf with the collides() function.
+func (c *Collider) polytopeCollision(
 	tree *SolidTree,
 	polytope model3d.ConvexPolytope,
-) []model3d.ConvexPolytope {
+	touches func(l *model3d.LinearConstraint) bool,
+	collides func(p model3d.ConvexPolytope) bool,
+) bool {
 	if tree.IsLeaf() {
-		if tree.Leaf == true {
-			return []model3d.ConvexPolytope{append(model3d.ConvexPolytope{}, polytope...)}
-		} else {
-			return []model3d.ConvexPolytope{}
+		return tree.Leaf && collides(polytope)
+	}
+	constraints := [2]*model3d.LinearConstraint{
+		{Normal: tree.Axis, Max: tree.Threshold},
+		{Normal: tree.Axis.Scale(-1), Max: -tree.Threshold},
+	}
+	for i, child := range [2]*SolidTree{tree.LessThan, tree.GreaterEqual} {
+		if !touches(constraints[i]) {
+			continue
+		}
+		if c.polytopeCollision(child, append(polytope, constraints[i]), touches, collides) {
+			return true
 		}
 	}
-	subPoly := append(
-		polytope,
-		&model3d.LinearConstraint{Normal: tree.Axis, Max: tree.Threshold},
-	)
-	results := c.computePolytopes(tree.LessThan, subPoly)
-	subPoly[len(subPoly)-1] = &model3d.LinearConstraint{Normal: tree.Axis.Scale(-1), Max: -tree.Threshold}
-	return append(results, c.computePolytopes(tree.GreaterEqual, subPoly)...)
+	return false
 }
 
+// ErrDegenerateRay is returned when a ray cannot be traced through a tree,
+// for example because its origin or direction is not finite.
+var ErrDegenerateRay = errors.New("degenerate ray")
+
 // RayChangePoints iterates the points where the ray causes a change in the
 // tree decision path.
 //
-// For each ray collision, the point of the change and associated scale for the
-// direction is passed to f, as well as the normal axis of the surface.
+// For each change, the point of the change and the scale of the direction
+// since the previous change (or the origin) is passed to f, as well as the
+// normal axis of the surface, which points back towards the origin.
 //
 // If f returns false, iteration is terminated early.
-func (t *Tree[F, C, T]) RayChangePoints(origin, direction C, f func(F, C, C) bool) {
-	for {
-		point, normal, changeT := t.nextBranchChange(origin, direction)
-		if math.IsInf(float64(changeT), 0) {
-			return
+//
+// Scales are computed from the original origin, rather than by stepping from
+// point to point, so results are invariant to the scale and position of the
+// tree up to rounding error.
+//
+// If the ray cannot be traced, ErrDegenerateRay is returned before f is
+// called.
+func (t *Tree[F, C, T]) RayChangePoints(origin, direction C, f func(F, C, C) bool) error {
+	if isDegenerateRay[F](origin, direction) {
+		return ErrDegenerateRay
+	}
+	var prevT F
+	first := true
+	t.rayLeafIntervals(origin, direction, 0, F(math.Inf(1)), nil, func(minT F, axis *C) bool {
+		if first {
+			// The first leaf contains the origin.
+			first = false
+			return true
 		}
-		if !f(changeT, point, normal.Scale(1/normal.Norm())) {
-			return
+		normal := *axis
+		if normal.Dot(direction) > 0 {
+			normal = normal.Scale(-1)
 		}
-		origin = point
-	}
+		changeT := minT - prevT
+		prevT = minT
+		return f(changeT, origin.Add(direction.Scale(minT)), normal.Scale(1/normal.Norm()))
+	})
+	return nil
 }
 
-func (t *Tree[F, C, T]) nextBranchChange(origin, direction C) (point, normal C, changeT F) {
+// rayLeafIntervals calls f with the scale at which the ray enters each leaf
+// along the ray, in order, for scales in [minT, maxT].
+//
+// The axis of the branch through which the ray entered the leaf is also
+// passed, or entryAxis if the leaf is entered at minT.
+//
+// If f returns false, iteration is terminated early, and false is returned.
+func (t *Tree[F, C, T]) rayLeafIntervals(
+	origin, direction C,
+	minT, maxT F,
+	entryAxis *C,
+	f func(minT F, axis *C) bool,
+) bool {
 	if t.IsLeaf() {
-		var zero C
-		return zero, zero, F(math.Inf(1))
+		return f(minT, entryAxis)
 	}
 	dirDot := t.Axis.Dot(direction)
-
-	absDirDot := dirDot
-	if absDirDot < 0 {
-		absDirDot = -absDirDot
-	}
-	if absDirDot < t.Axis.Norm()*direction.Norm()*1e-8 {
-		var zero C
-		return zero, zero, F(math.Inf(1))
-	}
-
 	curDot := t.Axis.Dot(origin)
-	child := t.LessThan
-	if curDot >= t.Threshold {
-		child = t.GreaterEqual
+	splitT := (t.Threshold - curDot) / dirDot
+	if dirDot == 0 || math.IsInf(float64(splitT), 0) || math.IsNaN(float64(splitT)) {
+		// The ray never crosses the plane, at least not at a finite scale.
+		child := t.LessThan
+		if curDot >= t.Threshold {
+			child = t.GreaterEqual
+		}
+		return child.rayLeafIntervals(origin, direction, minT, maxT, entryAxis, f)
 	}
 
-	normal = t.Axis
-	if child == t.LessThan {
-		normal = normal.Scale(-1)
+	near, far := t.LessThan, t.GreaterEqual
+	if dirDot < 0 {
+		near, far = far, near
 	}
-
-	thisT := (t.Threshold - curDot) / dirDot
-
-	// This edge case might seem extremely unusual, but it actually occurs
-	// naturally for trees with tight bounding boxes.
-	if t.Threshold == curDot {
-		maxT := F(1e8)
-		maxDot := t.Axis.Dot(origin.Add(direction.Scale(maxT)))
-		if (curDot >= t.Threshold) != (maxDot >= t.Threshold) {
-			changeT := t.changeT(origin, direction, thisT, maxT)
-			return origin.Add(direction.Scale(changeT)), normal, changeT
+	if minT < splitT {
+		newMaxT := maxT
+		if splitT < newMaxT {
+			newMaxT = splitT
+		}
+		if !near.rayLeafIntervals(origin, direction, minT, newMaxT, entryAxis, f) {
+			return false
 		}
 	}
-
-	if thisT <= 0 {
-		return child.nextBranchChange(origin, direction)
-	} else {
-		childPoint, childNormal, childT := child.nextBranchChange(origin, direction)
-		if thisT > childT {
-			return childPoint, childNormal, childT
-		} else {
-			maxT := thisT * 2
-			if maxT < 1e-4 {
-				maxT = 1e-4
-			}
-			changeT := t.changeT(origin, direction, thisT, maxT)
-			return origin.Add(direction.Scale(changeT)), normal, changeT
+	if splitT < maxT {
+		farAxis := entryAxis
+		newMinT := minT
+		if splitT >= minT {
+			farAxis = &t.Axis
+			newMinT = splitT
+		}
+		if !far.rayLeafIntervals(origin, direction, newMinT, maxT, farAxis, f) {
+			return false
 		}
 	}
+	return true
 }
 
-func (t *Tree[F, C, T]) changeT(origin, direction C, minT, maxT F) F {
-	orig := t.Axis.Dot(origin) < t.Threshold
-	x := origin.Add(direction.Scale(minT))
-	if t.Axis.Dot(x) < t.Threshold != orig {
-		return minT
-	}
-	if t.Axis.Dot(origin.Add(direction.Scale(maxT))) < t.Threshold == orig {
-		panic("impossible situation encountered: collision was expected")
+func isDegenerateRay[F constraints.Float, C Coord[F, C]](origin, direction C) bool {
+	return !isFiniteCoord[F](origin) || !isFiniteCoord[F](direction) || direction.Norm() == 0
+}
+
+func isFiniteCoord[F constraints.Float, C Coord[F, C]](c C) bool {
+	switch c := any(c).(type) {
+	case model3d.Coord3D:
+		arr := c.Array()
+		return isFiniteSlice(arr[:])
+	case model2d.Coord:
+		arr := c.Array()
+		return isFiniteSlice(arr[:])
 	}
-	for i := 0; i < 32; i++ {
-		midT := (minT + maxT) / 2
-		if t.Axis.Dot(origin.Add(direction.Scale(midT))) < t.Threshold != orig {
-			maxT = midT
-		} else {
-			minT = midT
+	// Components are not accessible for other coordinate types, but scaling
+	// by zero maps each finite component to zero and every other component
+	// to NaN, so the sum cannot overflow like the sum of c itself.
+	return c.Scale(0).Sum() == 0
+}
+
+func isFiniteSlice(values []float64) bool {
+	for _, x := range values {
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return false
 		}
 	}
-	return maxT
+	return true
 }
@@ -1,9 +1,11 @@
 package treed
 
 import (
+	"math"
 	"math/rand"
 	"testing"
 
+	"github.com/unixpickle/model3d/model2d"
 	"github.com/unixpickle/model3d/model3d"
 )
 
@@ -11,15 +13,22 @@ func TestColliderSphereCollision(t *testing.T) {
 	bounded := testTree()
 	mesh := model3d.MarchingCubesSearch(TreeSolid(bounded), 0.01, 8)
 	meshCollider := model3d.MeshToCollider(mesh)
+	meshSolid := model3d.NewColliderSolid(meshCollider)
 	treeCollider := NewCollider(bounded)
 
+	// Spheres inside the solid count as collisions, even though they do not
+	// touch the surface of the mesh.
+	meshSphereCollision := func(c model3d.Coord3D, r float64) bool {
+		return meshSolid.Contains(c) || meshCollider.SphereCollision(c, r)
+	}
+
 	for i := 0; i < 5000; i++ {
 		c := model3d.NewCoord3DRandNorm()
 		r := rand.Float64() * 2
 
-		mainResult := meshCollider.SphereCollision(c, r)
-		lowerResult := meshCollider.SphereCollision(c, r-0.05)
-		upperResult := meshCollider.SphereCollision(c, r+0.05)
+		mainResult := meshSphereCollision(c, r)
+		lowerResult := meshSphereCollision(c, r-0.05)
+		upperResult := meshSphereCollision(c, r+0.05)
 		if mainResult == lowerResult && mainResult == upperResult {
 			actualResult := treeCollider.SphereCollision(c, r)
 			if actualResult != mainResult {
@@ -32,6 +41,368 @@ func TestColliderSphereCollision(t *testing.T) {
 	}
 }
 
+func TestColliderRectCollision(t *testing.T) {
+	bounded := testTree()
+	mesh := model3d.MarchingCubesSearch(TreeSolid(bounded), 0.01, 8)
+	meshCollider := model3d.MeshToCollider(mesh)
+	meshSolid := model3d.NewColliderSolid(meshCollider)
+	treeCollider := NewCollider(bounded)
+
+	meshRectCollision := func(rect *model3d.Rect) bool {
+		center := rect.MinVal.Mid(rect.MaxVal)
+		return meshSolid.Contains(center) || meshCollider.RectCollision(rect)
+	}
+
+	for i := 0; i < 2000; i++ {
+		center := model3d.NewCoord3DRandNorm()
+		size := model3d.NewCoord3DRandUniform()
+		rect := &model3d.Rect{MinVal: center.Sub(size), MaxVal: center.Add(size)}
+
+		mainResult := meshRectCollision(rect)
+		lowerResult := meshRectCollision(rect.Expand(-0.05))
+		upperResult := meshRectCollision(rect.Expand(0.05))
+		if mainResult == lowerResult && mainResult == upperResult {
+			actualResult := treeCollider.RectCollision(rect)
+			if actualResult != mainResult {
+				t.Errorf("rect %v-%v should have collision=%v but got %v",
+					rect.MinVal, rect.MaxVal, mainResult, actualResult)
+			}
+		} else {
+			i--
+		}
+	}
+}
+
+func TestColliderLeafCollisions(t *testing.T) {
+	bounded := testTree()
+	collider := NewCollider(bounded)
+	leaves := bounded.Tree.Leaves()
+	for i := 0; i < 1000; i++ {
+		ray := &model3d.Ray{
+			Origin:    model3d.NewCoord3DRandNorm(),
+			Direction: model3d.NewCoord3DRandUnit(),
+		}
+		collider.RayCollisions(ray, func(rc model3d.RayCollision) {
+			info := rc.Extra.(*LeafCollision)
+			if info.LeafIndex == info.PrevLeafIndex {
+				t.Fatal("collision should change leaves")
+			}
+			entering := rc.Normal.Dot(ray.Direction) < 0
+			if info.LeafIndex != -1 && leaves[info.LeafIndex].Leaf != entering {
+				t.Fatal("entered leaf does not match collision direction")
+			}
+			if info.PrevLeafIndex != -1 && leaves[info.PrevLeafIndex].Leaf == entering {
+				t.Fatal("exited leaf does not match collision direction")
+			}
+		})
+	}
+}
+
+func TestColliderRayChangePoints(t *testing.T) {
+	bounded := testTree()
+	collider := NewCollider(bounded)
+	for i := 0; i < 1000; i++ {
+		ray := &model3d.Ray{
+			Origin:    model3d.NewCoord3DRandNorm(),
+			Direction: model3d.NewCoord3DRandUnit(),
+		}
+		var expected, actual []model3d.RayCollision
+		rayChangePointCollisions(collider.tree, ray, func(rc model3d.RayCollision) {
+			expected = append(expected, rc)
+		})
+		collider.RayCollisions(ray, func(rc model3d.RayCollision) {
+			actual = append(actual, rc)
+		})
+		if len(expected) != len(actual) {
+			t.Fatalf("expected %d collisions but got %d", len(expected), len(actual))
+		}
+		for j, x := range expected {
+			a := actual[j]
+			if math.Abs(x.Scale-a.Scale) > 1e-5 || x.Normal.Dist(a.Normal) > 1e-5 {
+				t.Fatalf("collision %d: expected %v but got %v", j, x, a)
+			}
+		}
+	}
+}
+
+func TestRayChangePointsTransformed(t *testing.T) {
+	bounded := testTree()
+	tree := bounded.AsTree(false, model3d.X(1), model3d.Y(1), model3d.Z(1))
+
+	type change struct {
+		T      float64
+		Normal model3d.Coord3D
+	}
+	changes := func(tree *SolidTree, r *model3d.Ray) []change {
+		var res []change
+		curT := 0.0
+		err := tree.RayChangePoints(r.Origin, r.Direction, func(t float64, _, n model3d.Coord3D) bool {
+			curT += t
+			if curT > 100 {
+				// Planes which are nearly parallel to the ray may be
+				// crossed very far away after rounding.
+				return false
+			}
+			res = append(res, change{T: curT, Normal: n})
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for i := 0; i < 200; i++ {
+		rotation := model3d.NewMatrix3Rotation(model3d.NewCoord3DRandUnit(), rand.Float64()*10)
+		scale := math.Pow(10, rand.Float64()*12-6)
+		offset := model3d.NewCoord3DRandNorm().Scale(scale * 100)
+		transform := func(c model3d.Coord3D) model3d.Coord3D {
+			return rotation.MulColumn(c).Scale(scale).Add(offset)
+		}
+		transformed := transformTree(tree, rotation, scale, offset)
+
+		for j := 0; j < 10; j++ {
+			ray := &model3d.Ray{
+				Origin:    model3d.NewCoord3DRandNorm(),
+				Direction: model3d.NewCoord3DRandUnit(),
+			}
+			if j%2 == 0 {
+				// Rays along the tree's axes often start on or travel
+				// within the planes of the bounds.
+				ray.Origin = model3d.XYZ(1, 1, 1).Sub(model3d.NewCoord3DRandUniform().Scale(2))
+				ray.Origin = ray.Origin.Mul(model3d.XYZ(1, 0, 1))
+				ray.Direction = model3d.Y(1)
+			}
+			tRay := &model3d.Ray{
+				Origin:    transform(ray.Origin),
+				Direction: rotation.MulColumn(ray.Direction).Scale(scale),
+			}
+			expected := changes(tree, ray)
+			actual := changes(transformed, tRay)
+			if len(expected) != len(actual) {
+				t.Fatalf("scale %e: expected %d changes but got %d", scale,
+					len(expected), len(actual))
+			}
+			for k, x := range expected {
+				a := actual[k]
+				if math.Abs(x.T-a.T) > 1e-6*math.Max(1, x.T) {
+					t.Fatalf("scale %e: change %d: expected t=%f but got %f", scale, k, x.T, a.T)
+				}
+				if rotation.MulColumn(x.Normal).Dist(a.Normal) > 1e-6 {
+					t.Fatalf("scale %e: change %d: bad normal", scale, k)
+				}
+				if a.Normal.Dot(tRay.Direction) > 0 {
+					t.Fatalf("normal should point towards the origin")
+				}
+			}
+
+			// Every reported change should actually change leaves.
+			prevLeaf := transformed.FindLeaf(tRay.Origin)
+			for k, a := range actual {
+				nextT := a.T * 2
+				if k+1 < len(actual) {
+					nextT = actual[k+1].T
+				}
+				leaf := transformed.FindLeaf(tRay.Origin.Add(tRay.Direction.Scale((a.T + nextT) / 2)))
+				if leaf == prevLeaf {
+					t.Fatalf("scale %e: change %d does not change leaves", scale, k)
+				}
+				prevLeaf = leaf
+			}
+		}
+	}
+}
+
+func TestRayChangePointsDegenerate(t *testing.T) {
+	bounded := testTree()
+	tree := bounded.Tree
+	badRays := []*model3d.Ray{
+		{Origin: model3d.XYZ(math.NaN(), 0, 0), Direction: model3d.X(1)},
+		{Origin: model3d.XYZ(0, math.Inf(1), 0), Direction: model3d.X(1)},
+		{Origin: model3d.XYZ(0, 0, 0), Direction: model3d.XYZ(0, 0, 0)},
+		{Origin: model3d.XYZ(0, 0, 0), Direction: model3d.XYZ(0, math.Inf(-1), 1)},
+	}
+	for _, r := range badRays {
+		err := tree.RayChangePoints(r.Origin, r.Direction, func(float64, model3d.Coord3D,
+			model3d.Coord3D) bool {
+			t.Fatal("unexpected callback")
+			return false
+		})
+		if err != ErrDegenerateRay {
+			t.Errorf("ray %v: expected ErrDegenerateRay but got %v", r, err)
+		}
+		for _, collider := range []*Collider{NewCollider(bounded), NewLeafGraphCollider(bounded)} {
+			count := collider.RayCollisions(r, func(model3d.RayCollision) {
+				t.Fatal("unexpected collision")
+			})
+			if count != 0 {
+				t.Errorf("ray %v: expected no collisions but got %d", r, count)
+			}
+		}
+	}
+}
+
+func TestRayChangePointsLargeCoords(t *testing.T) {
+	// The components sum to infinity, but each of them is finite.
+	origin := model3d.XYZ(1e308, 1e308, 0)
+	if !isFiniteCoord[float64](origin) {
+		t.Error("large coordinate should be finite")
+	}
+	if !isFiniteCoord[float64](model2d.XY(1e308, 1e308)) {
+		t.Error("large 2D coordinate should be finite")
+	}
+	if isFiniteCoord[float64](model2d.XY(0, math.NaN())) {
+		t.Error("2D coordinate with NaN should not be finite")
+	}
+
+	tree := testTree().Tree
+	var count int
+	err := tree.RayChangePoints(origin, model3d.XYZ(-1, -1, 0), func(float64, model3d.Coord3D,
+		model3d.Coord3D) bool {
+		count++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Error("expected the ray to cross the tree")
+	}
+}
+
+func TestLeafGraphCollider(t *testing.T) {
+	bounded := testTree()
+	treeCollider := NewCollider(bounded)
+	graphCollider := NewLeafGraphCollider(bounded)
+	for i := 0; i < 2000; i++ {
+		ray := &model3d.Ray{
+			Origin:    model3d.NewCoord3DRandNorm(),
+			Direction: model3d.NewCoord3DRandUnit(),
+		}
+		if i%2 == 0 {
+			// Test axis-aligned rays starting at leaf boundaries, which
+			// are likely to pass exactly through edges.
+			ray.Origin = ray.Origin.Mul(model3d.XYZ(1, 1, 0))
+			ray.Direction = [3]model3d.Coord3D{
+				model3d.X(1), model3d.Y(-1), model3d.Z(1),
+			}[i%3]
+		}
+		var expected, actual []model3d.RayCollision
+		treeCollider.RayCollisions(ray, func(rc model3d.RayCollision) {
+			expected = append(expected, rc)
+		})
+		graphCollider.RayCollisions(ray, func(rc model3d.RayCollision) {
+			actual = append(actual, rc)
+		})
+		if len(expected) != len(actual) {
+			t.Fatalf("expected %d collisions but got %d", len(expected), len(actual))
+		}
+		for j, x := range expected {
+			a := actual[j]
+			if x.Scale != a.Scale || x.Normal != a.Normal ||
+				*x.Extra.(*LeafCollision) != *a.Extra.(*LeafCollision) {
+				t.Fatalf("collision %d: expected %v but got %v", j, x, a)
+			}
+		}
+	}
+}
+
+func TestColliderRayStats(t *testing.T) {
+	bounded := testTree()
+	var stats RayStats
+	record := RecordRayStats(func(r *model3d.Ray, s *RayStats) {
+		stats = *s
+	})
+	treeCollider := NewCollider(bounded, record)
+	graphCollider := NewLeafGraphCollider(bounded, record)
+	for i := 0; i < 1000; i++ {
+		ray := &model3d.Ray{
+			Origin:    model3d.NewCoord3DRandNorm(),
+			Direction: model3d.NewCoord3DRandUnit(),
+		}
+		count := treeCollider.RayCollisions(ray, nil)
+		treeStats := stats
+		graphCollider.RayCollisions(ray, nil)
+		graphStats := stats
+
+		if treeStats.BranchChanges != graphStats.BranchChanges ||
+			treeStats.LeavesCrossed != graphStats.LeavesCrossed {
+			t.Fatalf("tree stats %v do not match graph stats %v", treeStats, graphStats)
+		}
+		if treeStats.BranchChanges < count {
+			t.Fatalf("expected at least %d branch changes but got %d", count,
+				treeStats.BranchChanges)
+		}
+		if treeStats.LeavesCrossed == 0 {
+			if treeStats.BranchChanges != 0 {
+				t.Fatal("ray should not cross any branches")
+			}
+			continue
+		}
+		// Every leaf is entered with a change, and then the ray exits the
+		// bounds, unless the ray starts in the first leaf.
+		expectedChanges := treeStats.LeavesCrossed + 1
+		if treeCollider.leafIndex(treeCollider.tree.FindLeaf(ray.Origin)) != -1 {
+			expectedChanges--
+		}
+		if treeStats.BranchChanges != expectedChanges {
+			t.Fatalf("expected %d branch changes but got %d", expectedChanges,
+				treeStats.BranchChanges)
+		}
+		if treeStats.NodesTested < treeStats.LeavesCrossed {
+			t.Fatal("every leaf should be tested")
+		}
+	}
+}
+
+func TestPolytopeClosestPoint(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		var polytope model3d.ConvexPolytope
+		for j := 0; j < 10; j++ {
+			polytope = append(polytope, &model3d.LinearConstraint{
+				Normal: model3d.NewCoord3DRandUnit(),
+				Max:    rand.Float64() + 0.1,
+			})
+		}
+		c := model3d.NewCoord3DRandNorm().Scale(3)
+		point, dist, ok := PolytopeClosestPoint(polytope, c)
+		if !ok {
+			t.Fatal("polytope should contain the origin")
+		}
+		if math.Abs(point.Dist(c)-dist) > 1e-8 {
+			t.Fatalf("distance %f does not match point distance %f", dist, point.Dist(c))
+		}
+		for _, l := range polytope {
+			if l.Normal.Dot(point) > l.Max+1e-8 {
+				t.Fatalf("closest point %v is outside of polytope", point)
+			}
+		}
+
+		// No point along a segment from the closest point to an interior
+		// point should be closer to c.
+		for j := 0; j < 100; j++ {
+			frac := rand.Float64()
+			other := point.Scale(1 - frac).Add(model3d.NewCoord3DRandUnit().Scale(0.01 * frac))
+			if polytope.Contains(other) && other.Dist(c) < dist-1e-8 {
+				t.Fatalf("found closer point %v (%f < %f)", other, other.Dist(c), dist)
+			}
+		}
+	}
+}
+
+func TestPolytopeClosestPointEmpty(t *testing.T) {
+	polytope := model3d.ConvexPolytope{
+		&model3d.LinearConstraint{Normal: model3d.X(1), Max: -1},
+		&model3d.LinearConstraint{Normal: model3d.X(-1), Max: -1},
+	}
+	if _, _, ok := PolytopeClosestPoint(polytope, model3d.XYZ(3, 0, 0)); ok {
+		t.Error("empty polytope should not have a closest point")
+	}
+	if PolytopeNonEmpty(polytope) {
+		t.Error("polytope should be empty")
+	}
+}
+
 func testTree() *BoundedSolidTree {
 	rand.Seed(0)
 
@@ -62,3 +433,180 @@ func testTree() *BoundedSolidTree {
 		Tree: tree,
 	}
 }
+
+func BenchmarkCollider(b *testing.B) {
+	bounded := testTree()
+	collider := NewCollider(bounded)
+	rays := benchmarkRays()
+	// Box trees are built on the first ray cast.
+	collider.RayCollisions(rays[0], nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		collider.RayCollisions(rays[i%len(rays)], nil)
+	}
+}
+
+func BenchmarkLeafGraphCollider(b *testing.B) {
+	bounded := testTree()
+	collider := NewLeafGraphCollider(bounded)
+	rays := benchmarkRays()
+	// Box trees are built on the first ray cast.
+	collider.RayCollisions(rays[0], nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		collider.RayCollisions(rays[i%len(rays)], nil)
+	}
+}
+
+func BenchmarkBaselineCollider(b *testing.B) {
+	bounded := testTree()
+	tree := bounded.AsTree(false, model3d.X(1), model3d.Y(1), model3d.Z(1))
+	rays := benchmarkRays()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		baselineRayCollisions(tree, rays[i%len(rays)])
+	}
+}
+
+func benchmarkRays() []*model3d.Ray {
+	rays := make([]*model3d.Ray, 1000)
+	for i := range rays {
+		rays[i] = &model3d.Ray{
+			Origin:    model3d.NewCoord3DRandUnit().Scale(3),
+			Direction: model3d.NewCoord3DRandUnit(),
+		}
+	}
+	return rays
+}
+
+// rayChangePointCollisions computes ray collisions directly from the branch
+// changes of a tree, serving as a reference implementation.
+func rayChangePointCollisions(tree *SolidTree, r *model3d.Ray, f func(model3d.RayCollision)) {
+	var scales []float64
+	var normals []model3d.Coord3D
+	curT := 0.0
+	err := tree.RayChangePoints(r.Origin, r.Direction, func(t float64, _, n model3d.Coord3D) bool {
+		curT += t
+		scales = append(scales, curT)
+		normals = append(normals, n)
+		return true
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Points exactly on a branch may be on either side due to rounding,
+	// so we classify the segments between changes.
+	prevValue := tree.Predict(r.Origin)
+	for i, t := range scales {
+		nextT := t + 1
+		if i+1 < len(scales) {
+			nextT = scales[i+1]
+		}
+		value := tree.Predict(r.Origin.Add(r.Direction.Scale((t + nextT) / 2)))
+		if value == prevValue {
+			continue
+		}
+		if f != nil {
+			n := normals[i]
+			if !value {
+				n = n.Scale(-1)
+			}
+			f(model3d.RayCollision{Scale: t, Normal: n})
+		}
+		prevValue = value
+	}
+}
+
+// baselineRayCollisions is a frozen copy of the original Collider ray
+// traversal, which restarts the search from the root of the tree after every
+// branch change. It is only kept as a baseline for benchmarks.
+func baselineRayCollisions(tree *SolidTree, r *model3d.Ray) (count int) {
+	curPoint := r.Origin
+	prevValue := tree.Predict(curPoint)
+	for {
+		point, _, changeT := baselineNextBranchChange(tree, curPoint, r.Direction)
+		if math.IsInf(changeT, 0) {
+			return
+		}
+		curPoint = point
+		if newValue := tree.Predict(point); newValue != prevValue {
+			prevValue = newValue
+			count++
+		}
+	}
+}
+
+func baselineNextBranchChange(t *SolidTree, origin, direction model3d.Coord3D) (point,
+	normal model3d.Coord3D, changeT float64) {
+	if t.IsLeaf() {
+		return model3d.Coord3D{}, model3d.Coord3D{}, math.Inf(1)
+	}
+	dirDot := t.Axis.Dot(direction)
+	if math.Abs(dirDot) < t.Axis.Norm()*direction.Norm()*1e-8 {
+		return model3d.Coord3D{}, model3d.Coord3D{}, math.Inf(1)
+	}
+
+	curDot := t.Axis.Dot(origin)
+	child := t.LessThan
+	if curDot >= t.Threshold {
+		child = t.GreaterEqual
+	}
+	normal = t.Axis
+	if child == t.LessThan {
+		normal = normal.Scale(-1)
+	}
+	thisT := (t.Threshold - curDot) / dirDot
+
+	if t.Threshold == curDot {
+		maxT := 1e8
+		maxDot := t.Axis.Dot(origin.Add(direction.Scale(maxT)))
+		if (curDot >= t.Threshold) != (maxDot >= t.Threshold) {
+			changeT := baselineChangeT(t, origin, direction, thisT, maxT)
+			return origin.Add(direction.Scale(changeT)), normal, changeT
+		}
+	}
+
+	if thisT <= 0 {
+		return baselineNextBranchChange(child, origin, direction)
+	}
+	childPoint, childNormal, childT := baselineNextBranchChange(child, origin, direction)
+	if thisT > childT {
+		return childPoint, childNormal, childT
+	}
+	maxT := math.Max(thisT*2, 1e-4)
+	changeT = baselineChangeT(t, origin, direction, thisT, maxT)
+	return origin.Add(direction.Scale(changeT)), normal, changeT
+}
+
+func baselineChangeT(t *SolidTree, origin, direction model3d.Coord3D, minT, maxT float64) float64 {
+	orig := t.Axis.Dot(origin) < t.Threshold
+	if t.Axis.Dot(origin.Add(direction.Scale(minT))) < t.Threshold != orig {
+		return minT
+	}
+	for i := 0; i < 32; i++ {
+		midT := (minT + maxT) / 2
+		if t.Axis.Dot(origin.Add(direction.Scale(midT))) < t.Threshold != orig {
+			maxT = midT
+		} else {
+			minT = midT
+		}
+	}
+	return maxT
+}
+
+// transformTree applies the transformation x -> scale*rotation*x + offset to
+// the coordinate space of a tree.
+func transformTree(t *SolidTree, rotation *model3d.Matrix3, scale float64,
+	offset model3d.Coord3D) *SolidTree {
+	if t.IsLeaf() {
+		return t
+	}
+	axis := rotation.MulColumn(t.Axis)
+	return &SolidTree{
+		Axis:         axis,
+		Threshold:    t.Threshold*scale + axis.Dot(offset),
+		LessThan:     transformTree(t.LessThan, rotation, scale, offset),
+		GreaterEqual: transformTree(t.GreaterEqual, rotation, scale, offset),
+	}
+}
@@ -0,0 +1,149 @@
+package treed
+
+import (
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// A LeafComponent is a connected set of leaves with the same prediction.
+type LeafComponent struct {
+	// Value is the prediction of every leaf in the component.
+	Value bool
+
+	// Leaves are the indices of the leaves in the component, corresponding
+	// to the order of Tree.Leaves().
+	Leaves []int
+
+	// Volume is the total volume of the leaves.
+	Volume float64
+
+	// Boundary is true if the component touches the bounds of the tree.
+	//
+	// Empty components which do not touch the bounds are cavities, since
+	// they cannot be reached from outside of the object.
+	Boundary bool
+}
+
+// Cavity checks if the component is an internal void.
+func (l *LeafComponent) Cavity() bool {
+	return !l.Value && !l.Boundary
+}
+
+// ComponentAnalysis describes the connected components of the occupied and
+// empty regions of a solid tree.
+type ComponentAnalysis struct {
+	Tree  *BoundedSolidTree
+	Graph *LeafGraph[bool]
+
+	// Components contains every occupied and empty component.
+	Components []*LeafComponent
+
+	// LeafComponents maps each leaf index to its index in Components.
+	//
+	// Leaves with empty polytopes are not part of any component, and are
+	// mapped to -1.
+	LeafComponents []int
+}
+
+// AnalyzeComponents computes the connected components of the leaves of a
+// tree using the face adjacency from a LeafGraph.
+//
+// Leaves which only touch along an edge or a point may be treated as
+// connected, so cavities are detected conservatively.
+func AnalyzeComponents(b *BoundedSolidTree) *ComponentAnalysis {
+	graph := NewLeafGraph(b)
+	polytopes := LeafPolytopes(b)
+	center := b.Min.Mid(b.Max)
+	scale := b.Min.Dist(b.Max)
+	eps := scale * 1e-8
+
+	shapes := make([]LeafShape, len(graph.Leaves))
+	boundary := make([]bool, len(graph.Leaves))
+	bounds := model3d.NewConvexPolytopeRect(b.Min, b.Max)
+	essentials.ConcurrentMap(0, len(graph.Leaves), func(i int) {
+		shapes[i] = NewLeafShape(polytopes[i], center, scale)
+		if shapes[i].Inradius == 0 {
+			return
+		}
+		for _, face := range bounds {
+			poly := boundedPlanePolygon(b.Min, b.Max, face.Normal, face.Max)
+			for _, l := range polytopes[i] {
+				poly = clipPolygon(poly, l.Normal, l.Max, eps)
+			}
+			if len(poly) > 0 {
+				boundary[i] = true
+				break
+			}
+		}
+	})
+
+	res := &ComponentAnalysis{
+		Tree:           b,
+		Graph:          graph,
+		LeafComponents: make([]int, len(graph.Leaves)),
+	}
+	for i := range res.LeafComponents {
+		res.LeafComponents[i] = -1
+	}
+	for start, leaf := range graph.Leaves {
+		if res.LeafComponents[start] != -1 || shapes[start].Inradius == 0 {
+			continue
+		}
+		idx := len(res.Components)
+		component := &LeafComponent{Value: leaf.Leaf, Leaves: []int{start}}
+		res.LeafComponents[start] = idx
+		for j := 0; j < len(component.Leaves); j++ {
+			i := component.Leaves[j]
+			component.Volume += shapes[i].Volume
+			component.Boundary = component.Boundary || boundary[i]
+			for _, face := range graph.Faces[i] {
+				for _, neighbor := range face.Neighbors {
+					if res.LeafComponents[neighbor] == -1 && shapes[neighbor].Inradius > 0 &&
+						graph.Leaves[neighbor].Leaf == leaf.Leaf {
+						res.LeafComponents[neighbor] = idx
+						component.Leaves = append(component.Leaves, neighbor)
+					}
+				}
+			}
+		}
+		res.Components = append(res.Components, component)
+	}
+	return res
+}
+
+// Cavities returns the empty components which do not touch the bounds.
+func (c *ComponentAnalysis) Cavities() []*LeafComponent {
+	var res []*LeafComponent
+	for _, component := range c.Components {
+		if component.Cavity() {
+			res = append(res, component)
+		}
+	}
+	return res
+}
+
+// FillCavities creates a new tree where the cavities are occupied.
+//
+// If maxVolume is non-zero, only cavities with at most this volume are
+// filled. The number of filled cavities is returned along with the tree.
+func (c *ComponentAnalysis) FillCavities(maxVolume float64) (*BoundedSolidTree, int) {
+	fill := map[*SolidTree]bool{}
+	var count int
+	for _, component := range c.Cavities() {
+		if maxVolume != 0 && component.Volume > maxVolume {
+			continue
+		}
+		count++
+		for _, i := range component.Leaves {
+			fill[c.Graph.Leaves[i]] = true
+		}
+	}
+	if count == 0 {
+		return c.Tree, 0
+	}
+	return &BoundedSolidTree{
+		Min:  c.Tree.Min,
+		Max:  c.Tree.Max,
+		Tree: repairLeaves(c.Tree.Tree, fill, true),
+	}, count
+}
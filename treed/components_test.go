@@ -0,0 +1,82 @@
+package treed
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestAnalyzeComponents(t *testing.T) {
+	axes := []model3d.Coord3D{model3d.X(1), model3d.Y(1), model3d.Z(1)}
+	cavityTree := &BoundedSolidTree{
+		Min:  model3d.XYZ(-0.25, -0.25, -0.25),
+		Max:  model3d.XYZ(0.25, 0.25, 0.25),
+		Tree: &SolidTree{Leaf: false},
+	}
+	shellTree := &BoundedSolidTree{
+		Min:  model3d.XYZ(-0.5, -0.5, -0.5),
+		Max:  model3d.XYZ(0.5, 0.5, 0.5),
+		Tree: cavityTree.AsTree(true, axes...),
+	}
+	rotation := model3d.NewMatrix3Rotation(model3d.XYZ(1, 2, 3).Normalize(), 0.3)
+	tree := &BoundedSolidTree{
+		Min:  model3d.XYZ(-1, -1, -1),
+		Max:  model3d.XYZ(1, 1, 1),
+		Tree: transformTree(shellTree.AsTree(false, axes...), rotation, 1, model3d.Origin),
+	}
+
+	analysis := AnalyzeComponents(tree)
+	if len(analysis.Components) != 3 {
+		t.Errorf("expected 3 components but got %d", len(analysis.Components))
+	}
+	var totalVolume float64
+	var numLeaves int
+	for i, component := range analysis.Components {
+		totalVolume += component.Volume
+		numLeaves += len(component.Leaves)
+		for _, leaf := range component.Leaves {
+			if analysis.LeafComponents[leaf] != i {
+				t.Fatalf("leaf %d should be in component %d", leaf, i)
+			}
+			if analysis.Graph.Leaves[leaf].Leaf != component.Value {
+				t.Fatalf("leaf %d has wrong value", leaf)
+			}
+		}
+	}
+	if numLeaves != tree.Tree.NumLeaves() {
+		t.Errorf("expected %d leaves but got %d", tree.Tree.NumLeaves(), numLeaves)
+	}
+	if math.Abs(totalVolume-8) > 1e-3 {
+		t.Errorf("expected total volume 8 but got %f", totalVolume)
+	}
+
+	cavities := analysis.Cavities()
+	if len(cavities) != 1 {
+		t.Fatalf("expected one cavity but got %d", len(cavities))
+	}
+	cavity := cavities[0]
+	if cavity != analysis.Components[analysis.LeafComponents[tree.Tree.LeafIndex(model3d.Origin)]] {
+		t.Error("cavity should contain the origin")
+	}
+	if math.Abs(cavity.Volume-0.125) > 1e-5 {
+		t.Errorf("expected cavity volume 0.125 but got %f", cavity.Volume)
+	}
+
+	if _, count := analysis.FillCavities(cavity.Volume / 2); count != 0 {
+		t.Errorf("expected no filled cavities but got %d", count)
+	}
+	filled, count := analysis.FillCavities(0)
+	if count != 1 {
+		t.Errorf("expected one filled cavity but got %d", count)
+	}
+	if !filled.Tree.Predict(model3d.Origin) {
+		t.Error("cavity was not filled")
+	}
+	if filled.Tree.Predict(model3d.XYZ(0.95, 0.95, 0.95)) {
+		t.Error("exterior was filled")
+	}
+	if len(AnalyzeComponents(filled).Cavities()) != 0 {
+		t.Error("filled tree still has cavities")
+	}
+}
@@ -0,0 +1,165 @@
+package treed
+
+import (
+	"math"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// PolytopeClosestPoint finds the point in a closed convex polytope that is
+// closest to c, along with the distance to this point.
+//
+// The polytope may be unbounded. If the polytope is empty, the final return
+// value is false.
+//
+// This enumerates the faces, edges, and vertices of the polytope, keeping
+// only candidates which satisfy the KKT conditions. As a result, it runs in
+// O(n^4) time for n constraints, and is intended for the small polytopes
+// found at the leaves of a tree.
+func PolytopeClosestPoint(
+	p model3d.ConvexPolytope,
+	c model3d.Coord3D,
+) (point model3d.Coord3D, dist float64, ok bool) {
+	normals, maxes, ok := normalizedConstraints(p)
+	if !ok {
+		return
+	}
+	eps := polytopeEpsilon(maxes, c)
+
+	violations := make([]float64, len(normals))
+	inside := true
+	for i, n := range normals {
+		violations[i] = n.Dot(c) - maxes[i]
+		if violations[i] > eps {
+			inside = false
+		}
+	}
+	if inside {
+		return c, 0, true
+	}
+	ok = false
+
+	feasible := func(x model3d.Coord3D, skip1, skip2, skip3 int) bool {
+		for i, n := range normals {
+			if i == skip1 || i == skip2 || i == skip3 {
+				continue
+			}
+			if n.Dot(x) > maxes[i]+eps {
+				return false
+			}
+		}
+		return true
+	}
+
+	bestDist := math.Inf(1)
+	consider := func(x model3d.Coord3D, i, j, k int) {
+		d := x.Dist(c)
+		if d < bestDist && feasible(x, i, j, k) {
+			bestDist = d
+			point = x
+			ok = true
+		}
+	}
+
+	// Projections onto single faces.
+	for i, n := range normals {
+		if violations[i] > 0 {
+			consider(c.Sub(n.Scale(violations[i])), i, -1, -1)
+		}
+	}
+
+	// Projections onto edges between pairs of faces.
+	for i := 0; i < len(normals); i++ {
+		for j := i + 1; j < len(normals); j++ {
+			g := normals[i].Dot(normals[j])
+			det := 1 - g*g
+			if det < 1e-12 {
+				continue
+			}
+			alpha := (violations[i] - g*violations[j]) / det
+			beta := (violations[j] - g*violations[i]) / det
+			if alpha < -eps || beta < -eps {
+				continue
+			}
+			x := c.Sub(normals[i].Scale(alpha)).Sub(normals[j].Scale(beta))
+			consider(x, i, j, -1)
+		}
+	}
+
+	// Vertices at the intersection of three faces.
+	for i := 0; i < len(normals); i++ {
+		for j := i + 1; j < len(normals); j++ {
+			for k := j + 1; k < len(normals); k++ {
+				n1, n2, n3 := normals[i], normals[j], normals[k]
+				matrix := model3d.Matrix3{
+					n1.X, n1.Y, n1.Z,
+					n2.X, n2.Y, n2.Z,
+					n3.X, n3.Y, n3.Z,
+				}
+				det := matrix.Det()
+				if math.Abs(det) < 1e-8 {
+					continue
+				}
+				x := matrix.MulColumnInv(model3d.XYZ(maxes[i], maxes[j], maxes[k]), det)
+				if x.Dist(c) >= bestDist {
+					continue
+				}
+				lambdas := matrix.Transpose().MulColumnInv(c.Sub(x), det)
+				if lambdas.X < -eps || lambdas.Y < -eps || lambdas.Z < -eps {
+					continue
+				}
+				consider(x, i, j, k)
+			}
+		}
+	}
+
+	dist = bestDist
+	return
+}
+
+// PolytopeNonEmpty checks if a closed convex polytope contains any points.
+func PolytopeNonEmpty(p model3d.ConvexPolytope) bool {
+	_, _, ok := PolytopeClosestPoint(p, polytopeCenterGuess(p))
+	return ok
+}
+
+// polytopeCenterGuess finds an arbitrary point which may be near a polytope,
+// to serve as a well-conditioned query point.
+func polytopeCenterGuess(p model3d.ConvexPolytope) model3d.Coord3D {
+	var sum model3d.Coord3D
+	for _, l := range p {
+		norm := l.Normal.Norm()
+		if norm != 0 {
+			sum = sum.Add(l.Normal.Scale(l.Max / (norm * norm)))
+		}
+	}
+	if len(p) == 0 {
+		return sum
+	}
+	return sum.Scale(1 / float64(len(p)))
+}
+
+func normalizedConstraints(p model3d.ConvexPolytope) ([]model3d.Coord3D, []float64, bool) {
+	normals := make([]model3d.Coord3D, 0, len(p))
+	maxes := make([]float64, 0, len(p))
+	for _, l := range p {
+		norm := l.Normal.Norm()
+		if norm == 0 {
+			if l.Max < 0 {
+				return nil, nil, false
+			}
+			continue
+		}
+		normals = append(normals, l.Normal.Scale(1/norm))
+		maxes = append(maxes, l.Max/norm)
+	}
+	return normals, maxes, true
+}
+
+func polytopeEpsilon(maxes []float64, c model3d.Coord3D) float64 {
+	scale := c.Abs().MaxCoord()
+	for _, m := range maxes {
+		scale = math.Max(scale, math.Abs(m))
+	}
+	return math.Max(scale, 1e-8) * 1e-8
+}
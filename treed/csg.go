@@ -0,0 +1,83 @@
+package treed
+
+import (
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// SubtractTrees creates a tree for the region occupied by a but not by b,
+// within the bounds of a.
+//
+// A negated copy of b is grafted into every occupied leaf of a. Branches of
+// b which do not cross the bounding box of a leaf are skipped, so the result
+// is usually much smaller than the product of the tree sizes.
+func SubtractTrees(a, b *BoundedSolidTree) *BoundedSolidTree {
+	boxes := NewBoxTree(a)
+	var graft func(box *BoxTree[bool], t *SolidTree) *SolidTree
+	graft = func(box *BoxTree[bool], t *SolidTree) *SolidTree {
+		if t.IsLeaf() {
+			return &SolidTree{Leaf: !t.Leaf}
+		}
+		minDot, maxDot := boxDotRange(box.Min, box.Max, t.Axis)
+		if maxDot < t.Threshold {
+			return graft(box, t.LessThan)
+		} else if minDot >= t.Threshold {
+			return graft(box, t.GreaterEqual)
+		}
+		return &SolidTree{
+			Axis:         t.Axis,
+			Threshold:    t.Threshold,
+			LessThan:     graft(box, t.LessThan),
+			GreaterEqual: graft(box, t.GreaterEqual),
+		}
+	}
+	var subtract func(box *BoxTree[bool]) *SolidTree
+	subtract = func(box *BoxTree[bool]) *SolidTree {
+		t := box.Tree
+		if box.IsLeaf() {
+			if !t.Leaf || box.Empty() {
+				return t
+			}
+			return graft(box, b.AsTree(false, model3d.X(1), model3d.Y(1), model3d.Z(1)))
+		}
+		return &SolidTree{
+			Axis:         t.Axis,
+			Threshold:    t.Threshold,
+			LessThan:     subtract(box.LessThan),
+			GreaterEqual: subtract(box.GreaterEqual),
+		}
+	}
+	return &BoundedSolidTree{
+		Min:  a.Min,
+		Max:  a.Max,
+		Tree: subtract(boxes),
+	}
+}
+
+// ConvexPolytopeTree creates a tree which is true inside a convex polytope
+// and false everywhere else.
+func ConvexPolytopeTree(p model3d.ConvexPolytope) *SolidTree {
+	res := &SolidTree{Leaf: true}
+	for i := len(p) - 1; i >= 0; i-- {
+		res = &SolidTree{
+			Axis:         p[i].Normal,
+			Threshold:    p[i].Max,
+			LessThan:     res,
+			GreaterEqual: &SolidTree{Leaf: false},
+		}
+	}
+	return res
+}
+
+// boxDotRange computes the range of dot products between an axis and the
+// points in a box.
+func boxDotRange(min, max, axis model3d.Coord3D) (minDot, maxDot float64) {
+	for i, a := range axis.Array() {
+		lo, hi := min.Array()[i]*a, max.Array()[i]*a
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		minDot += lo
+		maxDot += hi
+	}
+	return
+}
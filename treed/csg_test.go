@@ -0,0 +1,62 @@
+package treed
+
+import (
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestSubtractTrees(t *testing.T) {
+	fitSphere := func(center model3d.Coord3D, radius float64) *BoundedSolidTree {
+		xs := make([]model3d.Coord3D, 20000)
+		ys := make([]bool, len(xs))
+		for i := range xs {
+			xs[i] = model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+			ys[i] = xs[i].Dist(center) < radius
+		}
+		axes := NewConstantAxisScheduleIcosphere(1).Init()
+		return &BoundedSolidTree{
+			Min:  model3d.XYZ(-1, -1, -1),
+			Max:  model3d.XYZ(1, 1, 1),
+			Tree: GreedyTree[float64, model3d.Coord3D, bool](axes, xs, ys, EntropySplitLoss[float64]{}, 0, 8),
+		}
+	}
+	a := fitSphere(model3d.Origin, 0.7)
+	b := fitSphere(model3d.XYZ(0.3, 0.2, 0.1), 0.5)
+	b.Min = model3d.XYZ(-1, -1, -0.5)
+
+	res := SubtractTrees(a, b)
+	for i := 0; i < 10000; i++ {
+		c := model3d.NewCoord3DRandBounds(a.Min, a.Max)
+		expected := a.Tree.Predict(c)
+		if c.Z >= b.Min.Z && b.Tree.Predict(c) {
+			expected = false
+		}
+		if actual := res.Tree.Predict(c); actual != expected {
+			t.Fatalf("point %v: expected %v but got %v", c, expected, actual)
+		}
+	}
+	if res.Tree.NumLeaves() >= a.Tree.NumLeaves()*(b.Tree.NumLeaves()+6) {
+		t.Errorf("expected branches to be pruned, but got %d leaves", res.Tree.NumLeaves())
+	}
+}
+
+func TestConvexPolytopeTree(t *testing.T) {
+	hole := &DrainHole{Origin: model3d.XYZ(0.1, 0.2, 0.3), Direction: model3d.XYZ(1, 2, -1), Radius: 0.2}
+	p := hole.Polytope()
+	tree := ConvexPolytopeTree(p)
+	var numInside int
+	for i := 0; i < 10000; i++ {
+		c := model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		expected := p.Contains(c)
+		if expected {
+			numInside++
+		}
+		if actual := tree.Predict(c); actual != expected {
+			t.Fatalf("point %v: expected %v but got %v", c, expected, actual)
+		}
+	}
+	if numInside == 0 {
+		t.Error("no points inside polytope")
+	}
+}
@@ -4,12 +4,10 @@ import (
 	"math"
 	"math/rand"
 	"runtime"
-	"sync"
-	"sync/atomic"
+	"sort"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/model3d/model3d"
-	"github.com/unixpickle/model3d/render3d"
 )
 
 // SampleDecisionBoundaryCast samples points near the surface defined by a
@@ -18,20 +16,26 @@ import (
 // This may have an infinite runtime if the space is empty, since rays will
 // never find points on the surface.
 // To avoid this issue, specify maxQueries to limit the number of ray queries.
+//
+// Rays are cast concurrently, but the result only depends on the state of
+// rng.
 func SampleDecisionBoundaryCast(
+	rng *rand.Rand,
 	b *BoundedSolidTree,
 	numPoints int,
 	maxQueries int,
 ) []model3d.Coord3D {
 	return sampleWithRays(
+		rng,
 		b,
 		numPoints,
 		maxQueries,
-		func(collider *Collider, ray *model3d.Ray, cb func(model3d.Coord3D)) {
+		func(collider *Collider, ray *model3d.Ray, cb func(model3d.Coord3D)) error {
 			collider.RayCollisions(ray, func(rc model3d.RayCollision) {
 				point := ray.Origin.Add(ray.Direction.Scale(rc.Scale))
 				cb(point)
 			})
+			return nil
 		},
 	)
 }
@@ -42,19 +46,24 @@ func SampleDecisionBoundaryCast(
 // This may have an infinite runtime if the space is empty, since rays will
 // never find points on the surface.
 // To avoid this issue, specify maxQueries to limit the number of ray queries.
+//
+// Rays are cast concurrently, but the result only depends on the state of
+// rng.
 func SampleBranchChanges(
+	rng *rand.Rand,
 	b *BoundedSolidTree,
 	numPoints int,
 	maxQueries int,
 ) []model3d.Coord3D {
 	return sampleWithRays(
+		rng,
 		b,
 		numPoints,
 		maxQueries,
-		func(collider *Collider, ray *model3d.Ray, cb func(model3d.Coord3D)) {
+		func(collider *Collider, ray *model3d.Ray, cb func(model3d.Coord3D)) error {
 			var lastPoint model3d.Coord3D
 			var hasLast bool
-			collider.tree.RayChangePoints(
+			return collider.tree.RayChangePoints(
 				ray.Origin,
 				ray.Direction,
 				func(_ float64, c, _ model3d.Coord3D) bool {
@@ -72,61 +81,96 @@ func SampleBranchChanges(
 	)
 }
 
+const (
+	// maxSkippedRays is the number of degenerate rays after which
+	// sampleWithRays stops sampling.
+	maxSkippedRays = 1000
+
+	// raysPerBatch is the number of rays that sampleWithRays casts with each
+	// random number generator.
+	raysPerBatch = 64
+)
+
+// sampleWithRays casts rays in batches, where each batch has its own random
+// number generator seeded from rng. Batches are cast concurrently, but their
+// results are merged in order, so the result only depends on rng.
 func sampleWithRays(
+	rng *rand.Rand,
 	b *BoundedSolidTree,
 	numPoints int,
 	maxQueries int,
-	f func(*Collider, *model3d.Ray, func(model3d.Coord3D)),
+	f func(*Collider, *model3d.Ray, func(model3d.Coord3D)) error,
 ) []model3d.Coord3D {
-	remainingQueries := int64(maxQueries)
-
-	resChan := make(chan model3d.Coord3D, numPoints)
-	var wg sync.WaitGroup
-
-	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			collider := NewCollider(b)
-			min, max := collider.Min(), collider.Max()
-			gen := rand.New(rand.NewSource(rand.Int63()))
-			done := false
-			for !done {
-				if maxQueries != 0 {
-					if atomic.AddInt64(&remainingQueries, -1) < 0 {
-						return
-					}
-				}
-				ray := &model3d.Ray{
-					Origin: model3d.XYZ(
-						gen.Float64(),
-						gen.Float64(),
-						gen.Float64(),
-					).Mul(max.Sub(min)).Add(min),
-					Direction: model3d.XYZ(
-						gen.NormFloat64(),
-						gen.NormFloat64(),
-						gen.NormFloat64(),
-					).Normalize(),
-				}
-				f(collider, ray, func(c model3d.Coord3D) {
-					select {
-					case resChan <- c:
-					default:
-						done = true
-					}
-				})
+	collider := NewCollider(b)
+	min, max := collider.Min(), collider.Max()
+	seed := rng.Int63()
+
+	type batchResult struct {
+		Points  []model3d.Coord3D
+		Skipped int
+	}
+	castBatch := func(idx int) *batchResult {
+		gen := rand.New(rand.NewSource(seed + int64(idx)))
+		numRays := raysPerBatch
+		if maxQueries != 0 {
+			numRays = essentials.MinInt(numRays, maxQueries-idx*raysPerBatch)
+		}
+		res := &batchResult{}
+		for i := 0; i < numRays && len(res.Points) < numPoints; i++ {
+			ray := &model3d.Ray{
+				Origin: model3d.XYZ(
+					gen.Float64(),
+					gen.Float64(),
+					gen.Float64(),
+				).Mul(max.Sub(min)).Add(min),
+				Direction: model3d.XYZ(
+					gen.NormFloat64(),
+					gen.NormFloat64(),
+					gen.NormFloat64(),
+				).Normalize(),
+			}
+			err := f(collider, ray, func(c model3d.Coord3D) {
+				res.Points = append(res.Points, c)
+			})
+			if err != nil {
+				res.Skipped++
 			}
-		}()
+		}
+		return res
 	}
-	wg.Wait()
-	close(resChan)
 
-	res := make([]model3d.Coord3D, 0, numPoints)
-	for x := range resChan {
-		res = append(res, x)
+	numBatches := -1
+	if maxQueries != 0 {
+		numBatches = (maxQueries + raysPerBatch - 1) / raysPerBatch
 	}
+	concurrency := runtime.GOMAXPROCS(0)
 
+	res := make([]model3d.Coord3D, 0, numPoints)
+	var skipped int
+	for start := 0; numBatches < 0 || start < numBatches; start += concurrency {
+		n := concurrency
+		if numBatches >= 0 {
+			n = essentials.MinInt(n, numBatches-start)
+		}
+		results := make([]*batchResult, n)
+		essentials.ConcurrentMap(n, n, func(i int) {
+			results[i] = castBatch(start + i)
+		})
+		for _, r := range results {
+			for _, p := range r.Points {
+				if len(res) < numPoints {
+					res = append(res, p)
+				}
+			}
+			skipped += r.Skipped
+			// Degenerate rays (e.g. from infinite bounds) produce no points,
+			// so we give up if there are too many of them rather than
+			// looping forever.
+			if len(res) >= numPoints || skipped >= maxSkippedRays {
+				return res
+			}
+		}
+	}
 	return res
 }
 
@@ -135,34 +179,89 @@ func sampleWithRays(
 //
 // This may miss thin parts of the decision surface, unlike
 // SampleDecisionBoundaryCast().
+//
+// The result only depends on the state of rng. If no surface is found, the
+// result is empty.
 func SampleDecisionBoundaryMesh(
+	rng *rand.Rand,
 	b *BoundedSolidTree,
 	numPoints int,
 	gridSize int,
 ) []model3d.Coord3D {
-	rotation := model3d.Rotation(model3d.NewCoord3DRandUnit(), rand.Float64()*math.Pi*2)
+	axis := model3d.XYZ(rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()).Normalize()
+	rotation := model3d.Rotation(axis, rng.Float64()*math.Pi*2)
 	rotatedSolid := model3d.TransformSolid(rotation, TreeSolid(b))
 
 	maxSize := rotatedSolid.Max().Sub(rotatedSolid.Min()).MaxCoord()
 	mesh := model3d.MarchingCubesSearch(rotatedSolid, maxSize/float64(gridSize), 8)
 	mesh = mesh.Transform(rotation.Inverse())
+	if mesh.NumTriangles() == 0 {
+		return nil
+	}
 
+	sampler := NewMeshSurfaceSampler(mesh)
 	res := make([]model3d.Coord3D, numPoints)
-	essentials.StatefulConcurrentMap(0, numPoints, func() func(int) {
-		sampler := MeshPointSampler(mesh)
-		return func(i int) {
-			res[i] = sampler()
-		}
-	})
-
+	for i := range res {
+		res[i] = sampler.Sample(rng)
+	}
 	return res
 }
 
+// MeshPointSampler creates a function which samples points uniformly on the
+// surface of a mesh, using a random number generator seeded from the global
+// one.
 func MeshPointSampler(mesh *model3d.Mesh) func() model3d.Coord3D {
 	gen := rand.New(rand.NewSource(rand.Int63()))
-	light := render3d.NewMeshAreaLight(mesh, render3d.NewColor(1))
+	sampler := NewMeshSurfaceSampler(mesh)
 	return func() model3d.Coord3D {
-		point, _, _ := light.SampleLight(gen)
-		return point
+		return sampler.Sample(gen)
+	}
+}
+
+// A MeshSurfaceSampler samples points uniformly on the surface of a mesh.
+//
+// The triangles are sorted, so that samples only depend on the random number
+// generator and not on the order in which the mesh stores its triangles.
+type MeshSurfaceSampler struct {
+	triangles [][3]model3d.Coord3D
+	cumAreas  []float64
+}
+
+// NewMeshSurfaceSampler creates a sampler for a non-empty mesh.
+func NewMeshSurfaceSampler(mesh *model3d.Mesh) *MeshSurfaceSampler {
+	res := &MeshSurfaceSampler{}
+	mesh.Iterate(func(t *model3d.Triangle) {
+		res.triangles = append(res.triangles, triangleKey(t))
+	})
+	sort.Slice(res.triangles, func(i, j int) bool {
+		t1, t2 := res.triangles[i], res.triangles[j]
+		for k := 0; k < 3; k++ {
+			if t1[k] != t2[k] {
+				return coordLess(t1[k], t2[k])
+			}
+		}
+		return false
+	})
+	var total float64
+	res.cumAreas = make([]float64, len(res.triangles))
+	for i, t := range res.triangles {
+		total += t[1].Sub(t[0]).Cross(t[2].Sub(t[0])).Norm() / 2
+		res.cumAreas[i] = total
+	}
+	return res
+}
+
+// Sample draws a point on the surface.
+func (m *MeshSurfaceSampler) Sample(r *rand.Rand) model3d.Coord3D {
+	total := m.cumAreas[len(m.cumAreas)-1]
+	idx := sort.SearchFloat64s(m.cumAreas, r.Float64()*total)
+	if idx == len(m.triangles) {
+		idx--
+	}
+	t := m.triangles[idx]
+	u, v := r.Float64(), r.Float64()
+	if u+v > 1 {
+		u, v = 1-u, 1-v
 	}
+	return t[0].Add(t[1].Sub(t[0]).Scale(u)).Add(t[2].Sub(t[0]).Scale(v))
 }
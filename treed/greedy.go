@@ -40,6 +40,41 @@ func GreedyTree[F constraints.Float, C Coord[F, C], T any](
 	).Build(maxDepth)
 }
 
+// GrowGreedyTree extends an existing tree by replacing each of its leaves
+// with a greedy subtree, fit to the coordinates that reach the leaf.
+//
+// Subtrees are limited so that the resulting tree has a depth of at most
+// maxDepth. Leaves which are already at maxDepth, or which are not reached by
+// any coordinates, are left as-is.
+func GrowGreedyTree[F constraints.Float, C Coord[F, C], T any](
+	t *Tree[F, C, T],
+	axes []C,
+	coords []C,
+	labels []T,
+	loss SplitLoss[F, T],
+	concurrency int,
+	maxDepth int,
+) *Tree[F, C, T] {
+	data := groupByLeaf(t, coords, labels, nil)
+
+	replacements := map[*Tree[F, C, T]]*Tree[F, C, T]{}
+	var findLeaves func(t *Tree[F, C, T], depth int)
+	findLeaves = func(t *Tree[F, C, T], depth int) {
+		if !t.IsLeaf() {
+			findLeaves(t.LessThan, depth+1)
+			findLeaves(t.GreaterEqual, depth+1)
+			return
+		}
+		if d, ok := data[t]; ok && depth < maxDepth {
+			replacements[t] = GreedyTree(axes, d.Coords, d.Labels, loss, concurrency,
+				maxDepth-depth)
+		}
+	}
+	findLeaves(t, 0)
+
+	return replaceLeaves(t, replacements)
+}
+
 type greedySearchState[F constraints.Float, C Coord[F, C], T any] struct {
 	Axes        []C
 	Sorted      [][]*greedySearchNode[F, C, T]
@@ -87,3 +87,115 @@ func testPoints() []model3d.Coord3D {
 		model3d.XYZ(0.23007, 0.87637, 0.21424),
 	}
 }
+
+func TestGrowGreedyTree(t *testing.T) {
+	points := testPoints()
+	labels := make([]bool, len(points))
+	for i, x := range points {
+		if x.X < 0.5 {
+			labels[i] = x.Y > 0.4
+		} else {
+			labels[i] = true
+		}
+	}
+	axes := []model3d.Coord3D{
+		model3d.X(1),
+		model3d.Y(1),
+		model3d.Z(1),
+	}
+
+	// A stump which only splits on the first axis.
+	stump := GreedyTree[float64, model3d.Coord3D, bool](
+		axes,
+		points,
+		labels,
+		EntropySplitLoss[float64]{},
+		0,
+		1,
+	)
+	if stump.IsLeaf() {
+		t.Fatal("expected a split")
+	}
+
+	var loss SplitLoss[float64, bool] = EntropySplitLoss[float64]{}
+	unchanged := GrowGreedyTree(stump, axes, points, labels, loss, 0, 1)
+	if unchanged.NumLeaves() != stump.NumLeaves() {
+		t.Error("tree should not grow beyond the maximum depth")
+	}
+
+	tree := GrowGreedyTree(stump, axes, points, labels, loss, 0, 2)
+	if tree.Axis != stump.Axis || tree.Threshold != stump.Threshold {
+		t.Error("root split should be preserved")
+	}
+	if stump.NumLeaves() != 2 {
+		t.Error("original tree should not be modified")
+	}
+	for i, x := range points {
+		if pred := tree.Predict(x); pred != labels[i] {
+			t.Errorf("point %v got %v but should be %v", x, pred, labels[i])
+		}
+	}
+}
+
+func TestGrowAdaptiveGreedyTree(t *testing.T) {
+	oracle := func(c model3d.Coord3D) bool {
+		if c.X < 0.5 {
+			return c.Y > 0.4
+		}
+		return true
+	}
+	points := testPoints()
+	labels := make([]bool, len(points))
+	for i, x := range points {
+		labels[i] = oracle(x)
+	}
+	axes := []model3d.Coord3D{
+		model3d.X(1),
+		model3d.Y(1),
+		model3d.Z(1),
+	}
+	schedule := ConstantAxisSchedule[float64, model3d.Coord3D](axes)
+	bounds := NewPolytopeBounds(model3d.XYZ(0, 0, 0), model3d.XYZ(1, 1, 1))
+	sampler := &HitAndRunSampler[float64, model3d.Coord3D]{Iterations: 10}
+
+	stump := GreedyTree[float64, model3d.Coord3D, bool](
+		axes,
+		points,
+		labels,
+		EntropySplitLoss[float64]{},
+		0,
+		1,
+	)
+	if stump.IsLeaf() {
+		t.Fatal("expected a split")
+	}
+
+	loss := EntropySplitLoss[float64]{}
+	unchanged := GrowAdaptiveGreedyTree[float64, model3d.Coord3D, bool](stump, schedule, bounds,
+		points, labels, oracle, loss, sampler, 1000, 0, 1)
+	if unchanged.NumLeaves() != stump.NumLeaves() {
+		t.Error("tree should not grow beyond the maximum depth")
+	}
+
+	tree := GrowAdaptiveGreedyTree[float64, model3d.Coord3D, bool](stump, schedule, bounds,
+		points, labels, oracle, loss, sampler, 1000, 0, 2)
+	if tree.Axis != stump.Axis || tree.Threshold != stump.Threshold {
+		t.Error("root split should be preserved")
+	}
+	if stump.NumLeaves() != 2 {
+		t.Error("original tree should not be modified")
+	}
+
+	// New samples should allow the boundary to be found more precisely than
+	// the original points alone.
+	var numErrors int
+	for i := 0; i < 10000; i++ {
+		x := model3d.NewCoord3DRandUniform()
+		if tree.Predict(x) != oracle(x) {
+			numErrors++
+		}
+	}
+	if numErrors > 200 {
+		t.Errorf("too many errors: %d/10000", numErrors)
+	}
+}
@@ -0,0 +1,143 @@
+package treed
+
+import "golang.org/x/exp/constraints"
+
+// RepairHull relabels leaves of a boolean tree so that every coordinate is
+// predicted to be value.
+//
+// For an outer hull, the coordinates should be sampled on and inside the
+// surface of the true shape, and value should be true. This expands the
+// occupied region until it covers every sample. For an inner hull, the
+// coordinates should be sampled on and outside the surface, and value should
+// be false.
+//
+// The hull is only guaranteed at the provided coordinates, so denser samples
+// give a stronger guarantee. The returned count is the number of leaves that
+// were relabeled.
+func RepairHull[F constraints.Float, C Coord[F, C]](
+	t *Tree[F, C, bool],
+	coords []C,
+	value bool,
+) (*Tree[F, C, bool], int) {
+	bad := map[*Tree[F, C, bool]]bool{}
+	for _, c := range coords {
+		leaf := t.FindLeaf(c)
+		if leaf.Leaf != value {
+			bad[leaf] = true
+		}
+	}
+	if len(bad) == 0 {
+		return t, 0
+	}
+	return repairLeaves(t, bad, value), len(bad)
+}
+
+// RefineHull is like RepairHull, except that leaves which mispredict any of
+// the required coordinates are first split further, so that less volume is
+// relabeled.
+//
+// Each such leaf is replaced by a greedy subtree of at most maxDepth levels,
+// fit to the required coordinates in the leaf (labeled as value) along with
+// the labeled coordinates in the leaf. Finally, RepairHull is applied to the
+// refined tree, relabeling any leaves of the subtrees which still mispredict
+// required coordinates.
+func RefineHull[F constraints.Float, C Coord[F, C]](
+	t *Tree[F, C, bool],
+	axes []C,
+	coords []C,
+	labels []bool,
+	required []C,
+	value bool,
+	loss SplitLoss[F, bool],
+	maxDepth int,
+) (*Tree[F, C, bool], int) {
+	requiredLabels := make([]bool, len(required))
+	for i := range requiredLabels {
+		requiredLabels[i] = value
+	}
+	data := groupByLeaf(t, required, requiredLabels, func(leaf *Tree[F, C, bool]) bool {
+		return leaf.Leaf != value
+	})
+	if len(data) == 0 {
+		return t, 0
+	}
+	extra := groupByLeaf(t, coords, labels, func(leaf *Tree[F, C, bool]) bool {
+		_, ok := data[leaf]
+		return ok
+	})
+	for leaf, e := range extra {
+		d := data[leaf]
+		d.Coords = append(d.Coords, e.Coords...)
+		d.Labels = append(d.Labels, e.Labels...)
+	}
+	replacements := map[*Tree[F, C, bool]]*Tree[F, C, bool]{}
+	for leaf, d := range data {
+		replacements[leaf] = GreedyTree(axes, d.Coords, d.Labels, loss, 0, maxDepth)
+	}
+	return RepairHull(replaceLeaves(t, replacements), required, value)
+}
+
+func repairLeaves[F constraints.Float, C Coord[F, C]](
+	t *Tree[F, C, bool],
+	bad map[*Tree[F, C, bool]]bool,
+	value bool,
+) *Tree[F, C, bool] {
+	replacements := make(map[*Tree[F, C, bool]]*Tree[F, C, bool], len(bad))
+	for leaf := range bad {
+		replacements[leaf] = &Tree[F, C, bool]{Leaf: value}
+	}
+	return replaceLeaves(t, replacements)
+}
+
+// leafData is a subset of a dataset which reaches a single leaf.
+type leafData[C, T any] struct {
+	Coords []C
+	Labels []T
+}
+
+// groupByLeaf groups coordinates and their labels by the leaf of t that they
+// reach, preserving their order.
+//
+// If keep is non-nil, only leaves for which it returns true are included.
+func groupByLeaf[F constraints.Float, C Coord[F, C], T any](
+	t *Tree[F, C, T],
+	coords []C,
+	labels []T,
+	keep func(leaf *Tree[F, C, T]) bool,
+) map[*Tree[F, C, T]]*leafData[C, T] {
+	res := map[*Tree[F, C, T]]*leafData[C, T]{}
+	for i, c := range coords {
+		leaf := t.FindLeaf(c)
+		d, ok := res[leaf]
+		if !ok {
+			if keep != nil && !keep(leaf) {
+				continue
+			}
+			d = &leafData[C, T]{}
+			res[leaf] = d
+		}
+		d.Coords = append(d.Coords, c)
+		d.Labels = append(d.Labels, labels[i])
+	}
+	return res
+}
+
+// replaceLeaves creates a copy of a tree where some leaves are replaced by
+// different subtrees.
+func replaceLeaves[F constraints.Float, C Coord[F, C], T any](
+	t *Tree[F, C, T],
+	replacements map[*Tree[F, C, T]]*Tree[F, C, T],
+) *Tree[F, C, T] {
+	if t.IsLeaf() {
+		if r, ok := replacements[t]; ok {
+			return r
+		}
+		return t
+	}
+	return &Tree[F, C, T]{
+		Axis:         t.Axis,
+		Threshold:    t.Threshold,
+		LessThan:     replaceLeaves(t.LessThan, replacements),
+		GreaterEqual: replaceLeaves(t.GreaterEqual, replacements),
+	}
+}
@@ -0,0 +1,96 @@
+package treed
+
+import (
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestRepairHull(t *testing.T) {
+	xs := make([]model3d.Coord3D, 20000)
+	ys := make([]bool, len(xs))
+	for i := range xs {
+		x := model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		xs[i] = x
+		ys[i] = x.Norm() < 0.7
+	}
+	axes := NewConstantAxisScheduleIcosphere(1).Init()
+	tree := GreedyTree[float64, model3d.Coord3D, bool](
+		axes, xs, ys, EntropySplitLoss[float64]{}, 0, 4,
+	)
+
+	for _, value := range []bool{true, false} {
+		var samples []model3d.Coord3D
+		badLeaves := map[*SolidTree]bool{}
+		for i, x := range xs {
+			if ys[i] == value {
+				samples = append(samples, x)
+				if leaf := tree.FindLeaf(x); leaf.Leaf != value {
+					badLeaves[leaf] = true
+				}
+			}
+		}
+		repaired, count := RepairHull(tree, samples, value)
+		if count != len(badLeaves) {
+			t.Fatalf("expected %d relabeled leaves but got %d", len(badLeaves), count)
+		}
+		if repaired.NumLeaves() != tree.NumLeaves() {
+			t.Fatalf("leaf count changed from %d to %d", tree.NumLeaves(), repaired.NumLeaves())
+		}
+		for _, x := range samples {
+			if repaired.Predict(x) != value {
+				t.Fatalf("sample %v not predicted as %v", x, value)
+			}
+		}
+		for i, x := range xs {
+			if old := tree.Predict(x); old == value && repaired.Predict(x) != old {
+				t.Fatalf("prediction at sample %d changed away from %v", i, value)
+			}
+		}
+		if _, count := RepairHull(repaired, samples, value); count != 0 {
+			t.Errorf("expected no further repairs, but got %d", count)
+		}
+	}
+}
+
+func TestRefineHull(t *testing.T) {
+	xs := make([]model3d.Coord3D, 20000)
+	ys := make([]bool, len(xs))
+	for i := range xs {
+		x := model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		xs[i] = x
+		ys[i] = x.Norm() < 0.8
+	}
+	axes := NewConstantAxisScheduleIcosphere(1).Init()
+	tree := GreedyTree[float64, model3d.Coord3D, bool](
+		axes, xs, ys, EntropySplitLoss[float64]{}, 0, 6,
+	)
+
+	// Require the tree to be inside of the sphere.
+	surface := make([]model3d.Coord3D, 5000)
+	for i := range surface {
+		surface[i] = model3d.NewCoord3DRandUnit().Scale(0.8)
+	}
+	loss := EntropySplitLoss[float64]{}
+	refined, _ := RefineHull[float64, model3d.Coord3D](tree, axes, xs, ys, surface, false, loss, 10)
+	repaired, _ := RepairHull(tree, surface, false)
+	for _, c := range surface {
+		if refined.Predict(c) {
+			t.Fatalf("surface point %v is inside the refined tree", c)
+		}
+	}
+
+	var refinedCount, repairedCount int
+	for _, x := range xs {
+		if refined.Predict(x) {
+			refinedCount++
+		}
+		if repaired.Predict(x) {
+			repairedCount++
+		}
+	}
+	if refinedCount <= repairedCount {
+		t.Errorf("expected refined tree to keep more volume, but got %d vs %d", refinedCount,
+			repairedCount)
+	}
+}
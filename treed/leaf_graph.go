@@ -0,0 +1,219 @@
+package treed
+
+import (
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"golang.org/x/exp/constraints"
+)
+
+// A LeafFace is a face of a leaf polytope, created by a split in one of the
+// leaf's ancestors.
+type LeafFace struct {
+	Axis      model3d.Coord3D
+	Threshold float64
+
+	// GreaterEqual is true if the leaf is on the GreaterEqual side of the
+	// split, and false if it is on the LessThan side.
+	GreaterEqual bool
+
+	// Neighbors contains the indices of the leaves on the other side of the
+	// face which touch this leaf.
+	Neighbors []int
+}
+
+// A LeafGraph stores the faces of every leaf polytope in a bounded tree,
+// along with the neighboring leaves across each face.
+//
+// Faces created by the bounds of the tree are not included.
+type LeafGraph[T any] struct {
+	Min model3d.Coord3D
+	Max model3d.Coord3D
+
+	// Leaves are the leaves of the tree, in the order of Tree.Leaves().
+	Leaves []*Tree[float64, model3d.Coord3D, T]
+
+	// Faces[i] stores the faces of Leaves[i], ordered by the depth of the
+	// corresponding split, starting at the root.
+	Faces [][]LeafFace
+}
+
+// NewLeafGraph computes the adjacency graph of the leaves of a tree.
+//
+// For every branch, the leaves on either side of the split are paired up by
+// descending both subtrees at once while clipping the splitting plane to the
+// region of each pair. Neighbors may be included if they only touch along an
+// edge or a point.
+func NewLeafGraph[T any](b *BoundedTree[float64, model3d.Coord3D, T]) *LeafGraph[T] {
+	res := &LeafGraph[T]{
+		Min:    b.Min,
+		Max:    b.Max,
+		Leaves: b.Tree.Leaves(),
+	}
+	leafIndices := make(map[*Tree[float64, model3d.Coord3D, T]]int, len(res.Leaves))
+	for i, leaf := range res.Leaves {
+		leafIndices[leaf] = i
+	}
+	res.Faces = make([][]LeafFace, len(res.Leaves))
+
+	type branch struct {
+		Tree   *Tree[float64, model3d.Coord3D, T]
+		Region model3d.ConvexPolytope
+		Depth  int
+	}
+	var branches []branch
+	var faces []LeafFace
+	var region model3d.ConvexPolytope
+	var iterate func(t *Tree[float64, model3d.Coord3D, T])
+	iterate = func(t *Tree[float64, model3d.Coord3D, T]) {
+		if t.IsLeaf() {
+			res.Faces[leafIndices[t]] = append([]LeafFace{}, faces...)
+			return
+		}
+		branches = append(branches, branch{
+			Tree:   t,
+			Region: append(model3d.ConvexPolytope{}, region...),
+			Depth:  len(faces),
+		})
+		for _, greaterEqual := range []bool{false, true} {
+			face := LeafFace{Axis: t.Axis, Threshold: t.Threshold, GreaterEqual: greaterEqual}
+			constraint := &model3d.LinearConstraint{Normal: t.Axis, Max: t.Threshold}
+			child := t.LessThan
+			if greaterEqual {
+				constraint = &model3d.LinearConstraint{
+					Normal: t.Axis.Scale(-1),
+					Max:    -t.Threshold,
+				}
+				child = t.GreaterEqual
+			}
+			faces = append(faces, face)
+			region = append(region, constraint)
+			iterate(child)
+			faces = faces[:len(faces)-1]
+			region = region[:len(region)-1]
+		}
+	}
+	iterate(b.Tree)
+
+	eps := b.Max.Sub(b.Min).Norm() * 1e-8
+	bounds := model3d.NewConvexPolytopeRect(b.Min, b.Max)
+	essentials.ConcurrentMap(0, len(branches), func(i int) {
+		br := branches[i]
+		poly := boundedPlanePolygon(b.Min, b.Max, br.Tree.Axis, br.Tree.Threshold)
+		for _, constraints := range []model3d.ConvexPolytope{bounds, br.Region} {
+			for _, l := range constraints {
+				poly = clipPolygon(poly, l.Normal, l.Max, eps)
+			}
+		}
+		if len(poly) == 0 {
+			return
+		}
+		var connect func(lessThan, greaterEqual *Tree[float64, model3d.Coord3D, T],
+			poly []model3d.Coord3D)
+		connect = func(lessThan, greaterEqual *Tree[float64, model3d.Coord3D, T],
+			poly []model3d.Coord3D) {
+			if len(poly) == 0 {
+				return
+			}
+			if !lessThan.IsLeaf() {
+				connect(lessThan.LessThan, greaterEqual,
+					clipPolygon(poly, lessThan.Axis, lessThan.Threshold, eps))
+				connect(lessThan.GreaterEqual, greaterEqual,
+					clipPolygon(poly, lessThan.Axis.Scale(-1), -lessThan.Threshold, eps))
+			} else if !greaterEqual.IsLeaf() {
+				connect(lessThan, greaterEqual.LessThan,
+					clipPolygon(poly, greaterEqual.Axis, greaterEqual.Threshold, eps))
+				connect(lessThan, greaterEqual.GreaterEqual,
+					clipPolygon(poly, greaterEqual.Axis.Scale(-1), -greaterEqual.Threshold, eps))
+			} else {
+				// Each (leaf, depth) pair is only written by the branch at
+				// this depth, so this is safe to do concurrently.
+				idx1, idx2 := leafIndices[lessThan], leafIndices[greaterEqual]
+				face1 := &res.Faces[idx1][br.Depth]
+				face2 := &res.Faces[idx2][br.Depth]
+				face1.Neighbors = append(face1.Neighbors, idx2)
+				face2.Neighbors = append(face2.Neighbors, idx1)
+			}
+		}
+		connect(br.Tree.LessThan, br.Tree.GreaterEqual, poly)
+	})
+
+	return res
+}
+
+// rayInterval computes the range of scales where a ray is inside of a leaf,
+// restricted to the range [minT, maxT]. It also returns the axis of the
+// face through which the ray enters the leaf, which is minAxis if the ray
+// enters the leaf at minT.
+//
+// The computation matches Collider.rayLeaves() exactly, so that the results
+// can be compared directly to the results of a tree traversal.
+func (l *LeafGraph[T]) rayInterval(
+	leaf int,
+	r *model3d.Ray,
+	minT, maxT float64,
+	minAxis model3d.Coord3D,
+) (enterT, exitT float64, axis model3d.Coord3D, ok bool) {
+	enterT, exitT, axis = minT, maxT, minAxis
+	for _, face := range l.Faces[leaf] {
+		dirDot := face.Axis.Dot(r.Direction)
+		curDot := face.Axis.Dot(r.Origin)
+		if dirDot == 0 {
+			if (curDot >= face.Threshold) != face.GreaterEqual {
+				return
+			}
+			continue
+		}
+		splitT := (face.Threshold - curDot) / dirDot
+		if (dirDot > 0) == face.GreaterEqual {
+			// The ray enters the leaf through this face.
+			if splitT >= enterT {
+				enterT = splitT
+				axis = face.Axis
+			}
+		} else if splitT < exitT {
+			exitT = splitT
+		}
+	}
+	ok = enterT < exitT
+	return
+}
+
+// boundedPlanePolygon creates a square on a plane which covers the entire
+// intersection of the plane with a bounding box.
+func boundedPlanePolygon(min, max, axis model3d.Coord3D, threshold float64) []model3d.Coord3D {
+	norm := axis.Norm()
+	normal := axis.Scale(1 / norm)
+	center := min.Mid(max)
+	center = center.Add(normal.Scale(threshold/norm - normal.Dot(center)))
+	size := max.Sub(min).Norm()
+	u, v := normal.OrthoBasis()
+	u, v = u.Scale(size), v.Scale(size)
+	return []model3d.Coord3D{
+		center.Sub(u).Sub(v),
+		center.Add(u).Sub(v),
+		center.Add(u).Add(v),
+		center.Sub(u).Add(v),
+	}
+}
+
+// clipPolygon clips a convex polygon to the half-space normal*x <= max, with
+// some epsilon of slack.
+//
+// If the resulting polygon is empty, an empty slice is returned.
+func clipPolygon[F constraints.Float, C Coord[F, C]](poly []C, normal C, max, eps F) []C {
+	max += eps * normal.Norm()
+	var res []C
+	for i, p1 := range poly {
+		p2 := poly[(i+1)%len(poly)]
+		d1 := normal.Dot(p1) - max
+		d2 := normal.Dot(p2) - max
+		if d1 <= 0 {
+			res = append(res, p1)
+		}
+		if (d1 <= 0) != (d2 <= 0) {
+			frac := d1 / (d1 - d2)
+			res = append(res, p1.Add(p2.Sub(p1).Scale(frac)))
+		}
+	}
+	return res
+}
@@ -0,0 +1,356 @@
+package treed
+
+import (
+	"log"
+
+	"github.com/unixpickle/model3d/model3d"
+	"golang.org/x/exp/constraints"
+)
+
+// MeshChangedRegion finds the region of space where the occupancy of two
+// meshes may differ.
+//
+// Triangles which appear in only one of the meshes are grouped into patches,
+// and the region is a union of RectQuery boxes around these patches, each
+// expanded by margin on every side. Boxes which overlap are merged, so that a
+// region enclosed by changed triangles is always covered by a single box.
+//
+// If the meshes are identical, the result is empty.
+func MeshChangedRegion(
+	oldMesh, newMesh *model3d.Mesh,
+	margin float64,
+) UnionQuery[float64, model3d.Coord3D] {
+	counts := map[[3]model3d.Coord3D]int{}
+	oldMesh.Iterate(func(t *model3d.Triangle) {
+		counts[triangleKey(t)]++
+	})
+	newMesh.Iterate(func(t *model3d.Triangle) {
+		counts[triangleKey(t)]--
+	})
+
+	// Group changed triangles which share vertices.
+	var boxes []*RectQuery
+	vertexBox := map[model3d.Coord3D]int{}
+	parents := []int{}
+	var find func(i int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+	for key, count := range counts {
+		if count == 0 {
+			continue
+		}
+		idx := len(boxes)
+		boxes = append(boxes, &RectQuery{
+			Min: key[0].Min(key[1]).Min(key[2]).AddScalar(-margin),
+			Max: key[0].Max(key[1]).Max(key[2]).AddScalar(margin),
+		})
+		parents = append(parents, idx)
+		for _, c := range key {
+			if other, ok := vertexBox[c]; ok {
+				parents[find(idx)] = find(other)
+			} else {
+				vertexBox[c] = idx
+			}
+		}
+	}
+	patches := map[int]*RectQuery{}
+	for i, box := range boxes {
+		root := find(i)
+		if patch, ok := patches[root]; ok {
+			patch.Min = patch.Min.Min(box.Min)
+			patch.Max = patch.Max.Max(box.Max)
+		} else {
+			patches[root] = &RectQuery{Min: box.Min, Max: box.Max}
+		}
+	}
+
+	var merged []*RectQuery
+	for _, patch := range patches {
+		merged = append(merged, patch)
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(merged); i++ {
+			for j := i + 1; j < len(merged); j++ {
+				if rectsOverlap(merged[i], merged[j]) {
+					merged[i].Min = merged[i].Min.Min(merged[j].Min)
+					merged[i].Max = merged[i].Max.Max(merged[j].Max)
+					merged[j] = merged[len(merged)-1]
+					merged = merged[:len(merged)-1]
+					changed = true
+					j--
+				}
+			}
+		}
+	}
+
+	res := make(UnionQuery[float64, model3d.Coord3D], len(merged))
+	for i, r := range merged {
+		res[i] = r
+	}
+	return res
+}
+
+// triangleKey creates a key for a triangle which does not depend on which
+// vertex comes first, but does depend on the orientation.
+func triangleKey(t *model3d.Triangle) [3]model3d.Coord3D {
+	first := 0
+	for i := 1; i < 3; i++ {
+		if coordLess(t[i], t[first]) {
+			first = i
+		}
+	}
+	return [3]model3d.Coord3D{t[first], t[(first+1)%3], t[(first+2)%3]}
+}
+
+func coordLess(c1, c2 model3d.Coord3D) bool {
+	if c1.X != c2.X {
+		return c1.X < c2.X
+	} else if c1.Y != c2.Y {
+		return c1.Y < c2.Y
+	}
+	return c1.Z < c2.Z
+}
+
+func rectsOverlap(r1, r2 *RectQuery) bool {
+	return r1.Min.X <= r2.Max.X && r2.Min.X <= r1.Max.X &&
+		r1.Min.Y <= r2.Max.Y && r2.Min.Y <= r1.Max.Y &&
+		r1.Min.Z <= r2.Max.Z && r2.Min.Z <= r1.Max.Z
+}
+
+// A LocalUpdater retrains the parts of a tree that intersect a region of
+// space, for example after an edit to part of a mesh.
+//
+// Leaves whose polytopes intersect the region are found, and the subtree
+// which is Levels levels above each such leaf is rebuilt from scratch using
+// points sampled within the subtree's polytope. The rebuilt subtrees are then
+// refined with TAO. All other nodes of the tree are reused as-is.
+type LocalUpdater struct {
+	// AxisSchedule, Loss, and Sampler are used to build new subtrees.
+	AxisSchedule AxisSchedule[float64, model3d.Coord3D]
+	Loss         SplitLoss[float64, bool]
+	Sampler      PolytopeSampler[float64, model3d.Coord3D]
+
+	// MinSamples is the minimum number of samples to use in each region of
+	// space when building and refining subtrees.
+	MinSamples int
+
+	// Levels is the number of levels above each affected leaf to rebuild.
+	// If this is 0, only the affected leaves themselves are rebuilt.
+	Levels int
+
+	// MaxDepth is the maximum depth of the updated tree.
+	MaxDepth int
+
+	// Concurrency, if non-zero, limits the number of Goroutines to use for
+	// building subtrees.
+	Concurrency int
+
+	// TAO is used to refine each subtree for at most TAOIters iterations.
+	//
+	// The adaptive resampling fields of TAO are filled in automatically.
+	TAO      TAO[float64, model3d.Coord3D, bool]
+	TAOIters int
+
+	// Verbose, if true, enables logging of progress.
+	Verbose bool
+}
+
+// LocalUpdateResult summarizes a call to LocalUpdater.Update().
+type LocalUpdateResult struct {
+	// Tree is the updated tree.
+	Tree *BoundedSolidTree
+
+	// AffectedLeaves is the number of leaves in the original tree that
+	// intersect the region.
+	AffectedLeaves int
+
+	// Subtrees is the number of subtrees which were rebuilt.
+	Subtrees int
+
+	// OldLeaves and NewLeaves are the total number of leaves in the rebuilt
+	// subtrees before and after the update.
+	OldLeaves int
+	NewLeaves int
+}
+
+// Update retrains the parts of b which intersect region, using an oracle to
+// label new points.
+//
+// The bounds of b are not changed, so the updated tree ignores any part of
+// the region or the occupied space that lies outside of b.Min and b.Max.
+func (l *LocalUpdater) Update(
+	b *BoundedSolidTree,
+	region RegionQuery[float64, model3d.Coord3D],
+	oracle func(c model3d.Coord3D) bool,
+) *LocalUpdateResult {
+	axes := []model3d.Coord3D{model3d.X(1), model3d.Y(1), model3d.Z(1)}
+	bounds := b.BoundsPolytope(axes...)
+
+	affected := map[*SolidTree]bool{}
+	b.Tree.QueryLeaves(
+		bounds,
+		region,
+		func(leaf *SolidTree, _ Polytope[float64, model3d.Coord3D]) bool {
+			affected[leaf] = true
+			return true
+		},
+	)
+	res := &LocalUpdateResult{Tree: b, AffectedLeaves: len(affected)}
+	if len(affected) == 0 {
+		return res
+	}
+
+	// Find the ancestors to rebuild for every affected leaf.
+	roots := map[*SolidTree]bool{}
+	var findRoots func(t *SolidTree, path []*SolidTree)
+	findRoots = func(t *SolidTree, path []*SolidTree) {
+		path = append(path, t)
+		if t.IsLeaf() {
+			if affected[t] {
+				idx := len(path) - 1 - l.Levels
+				if idx < 0 {
+					idx = 0
+				}
+				roots[path[idx]] = true
+			}
+			return
+		}
+		findRoots(t.LessThan, path)
+		findRoots(t.GreaterEqual, path)
+	}
+	findRoots(b.Tree, nil)
+
+	// Only keep the top-most roots, along with their polytopes and depths.
+	type subtree struct {
+		Tree     *SolidTree
+		Polytope Polytope[float64, model3d.Coord3D]
+		Depth    int
+	}
+	var subtrees []subtree
+	var findSubtrees func(t *SolidTree, p Polytope[float64, model3d.Coord3D], depth int)
+	findSubtrees = func(t *SolidTree, p Polytope[float64, model3d.Coord3D], depth int) {
+		if roots[t] {
+			subtrees = append(subtrees, subtree{Tree: t, Polytope: p, Depth: depth})
+			return
+		}
+		if t.IsLeaf() {
+			return
+		}
+		findSubtrees(t.LessThan, p.Constrain(t.Axis, t.Threshold), depth+1)
+		findSubtrees(t.GreaterEqual, p.Constrain(t.Axis.Scale(-1), -t.Threshold), depth+1)
+	}
+	findSubtrees(b.Tree, bounds, 0)
+
+	replacements := map[*SolidTree]*SolidTree{}
+	for i, s := range subtrees {
+		if l.Verbose {
+			log.Printf("Rebuilding subtree %d/%d at depth %d with %d leaves...", i+1,
+				len(subtrees), s.Depth, s.Tree.NumLeaves())
+		}
+		newTree := l.rebuild(s.Polytope, s.Depth, oracle)
+		if newTree == nil {
+			// The polytope is degenerate, so there is nothing to fit.
+			continue
+		}
+		replacements[s.Tree] = newTree
+		res.Subtrees++
+		res.OldLeaves += s.Tree.NumLeaves()
+		res.NewLeaves += newTree.NumLeaves()
+	}
+
+	res.Tree = &BoundedSolidTree{
+		Min:  b.Min,
+		Max:  b.Max,
+		Tree: replaceSubtrees(b.Tree, replacements),
+	}
+	return res
+}
+
+func (l *LocalUpdater) rebuild(
+	p Polytope[float64, model3d.Coord3D],
+	depth int,
+	oracle func(c model3d.Coord3D) bool,
+) *SolidTree {
+	mesh := ConvexPolytope(p).Mesh()
+	if mesh.NumTriangles() == 0 {
+		return nil
+	}
+	var center model3d.Coord3D
+	vertices := mesh.VertexSlice()
+	for _, v := range vertices {
+		center = center.Add(v)
+	}
+	center = center.Scale(1 / float64(len(vertices)))
+
+	coords, labels := adaptiveResample(
+		p,
+		[]model3d.Coord3D{center},
+		[]bool{oracle(center)},
+		oracle,
+		l.Sampler,
+		l.MinSamples,
+		l.Concurrency,
+	)
+
+	maxDepth := l.MaxDepth - depth
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+	tree := AdaptiveGreedyTree(
+		l.AxisSchedule,
+		p,
+		coords,
+		labels,
+		oracle,
+		l.Loss,
+		l.Sampler,
+		l.MinSamples,
+		l.Concurrency,
+		maxDepth,
+	)
+
+	tao := l.TAO
+	tao.MinSamples = l.MinSamples
+	tao.Sampler = l.Sampler
+	tao.Bounds = p
+	tao.Oracle = oracle
+	refiner := &TAORefiner[float64, model3d.Coord3D, bool]{TAO: &tao, Iters: l.TAOIters}
+	if l.Verbose {
+		refiner.Logf = func(format string, args ...any) {
+			log.Printf(" => "+format, args...)
+		}
+	}
+	return refiner.Refine(tree, coords, labels, nil, nil)
+}
+
+// replaceSubtrees is like replaceLeaves, except that branches may also be
+// replaced.
+//
+// Subtrees which do not contain any replaced nodes are reused, so that they
+// are identical to the original tree.
+func replaceSubtrees[F constraints.Float, C Coord[F, C], T any](
+	t *Tree[F, C, T],
+	replacements map[*Tree[F, C, T]]*Tree[F, C, T],
+) *Tree[F, C, T] {
+	if r, ok := replacements[t]; ok {
+		return r
+	} else if t.IsLeaf() {
+		return t
+	}
+	lessThan := replaceSubtrees(t.LessThan, replacements)
+	greaterEqual := replaceSubtrees(t.GreaterEqual, replacements)
+	if lessThan == t.LessThan && greaterEqual == t.GreaterEqual {
+		return t
+	}
+	return &Tree[F, C, T]{
+		Axis:         t.Axis,
+		Threshold:    t.Threshold,
+		LessThan:     lessThan,
+		GreaterEqual: greaterEqual,
+	}
+}
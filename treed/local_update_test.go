@@ -0,0 +1,127 @@
+package treed
+
+import (
+	"testing"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestMeshChangedRegion(t *testing.T) {
+	sphere := model3d.NewMeshIcosphere(model3d.XYZ(-0.5, 0, 0), 0.3, 3)
+	oldMesh := sphere.Copy()
+	oldMesh.AddMesh(model3d.NewMeshRect(model3d.XYZ(0.5, 0, 0), model3d.XYZ(0.6, 0.1, 0.1)))
+	newMesh := sphere.Copy()
+	newMesh.AddMesh(model3d.NewMeshRect(model3d.XYZ(0.5, 0, 0), model3d.XYZ(0.6, 0.1, 0.3)))
+
+	if region := MeshChangedRegion(oldMesh, oldMesh.Copy(), 0.01); len(region) != 0 {
+		t.Errorf("identical meshes should not have a changed region: %v", region)
+	}
+
+	region := MeshChangedRegion(oldMesh, newMesh, 0.01)
+	if len(region) != 1 {
+		t.Fatalf("expected one box but got %d", len(region))
+	}
+	touches := func(min, max model3d.Coord3D) bool {
+		return region.TouchesPolytope(NewPolytopeBounds(min, max))
+	}
+	if !touches(model3d.XYZ(0.54, 0.04, 0.2), model3d.XYZ(0.56, 0.06, 0.22)) {
+		t.Error("region should contain the added volume")
+	}
+	if touches(model3d.XYZ(-0.6, -0.1, -0.1), model3d.XYZ(-0.4, 0.1, 0.1)) {
+		t.Error("region should not contain the unchanged sphere")
+	}
+}
+
+func TestLocalUpdater(t *testing.T) {
+	oldSolid := &model3d.Sphere{Radius: 0.5}
+	newSolid := model3d.JoinedSolid{
+		oldSolid,
+		&model3d.Rect{MinVal: model3d.XYZ(0.4, 0.4, 0.4), MaxVal: model3d.XYZ(0.8, 0.8, 0.8)},
+	}
+	min, max := model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1)
+	coords, labels := sampleOracle(min, max, oldSolid.Contains, 20000)
+	var loss SplitLoss[float64, bool] = EntropySplitLoss[float64]{MinCount: 5}
+	oldTree := &BoundedSolidTree{
+		Min: min,
+		Max: max,
+		Tree: GreedyTree[float64, model3d.Coord3D, bool](
+			NewConstantAxisScheduleIcosphere(1).Init(),
+			coords,
+			labels,
+			loss,
+			0,
+			10,
+		),
+	}
+	region := &RectQuery{Min: model3d.XYZ(0.35, 0.35, 0.35), Max: model3d.XYZ(0.85, 0.85, 0.85)}
+
+	updater := &LocalUpdater{
+		AxisSchedule: NewConstantAxisScheduleIcosphere(1),
+		Loss:         loss,
+		Sampler:      &HitAndRunSampler[float64, model3d.Coord3D]{Iterations: 10},
+		MinSamples:   500,
+		MaxDepth:     14,
+		TAO: TAO[float64, model3d.Coord3D, bool]{
+			Loss:  EqualityTAOLoss[bool]{},
+			LR:    0.1,
+			Iters: 100,
+		},
+		TAOIters: 2,
+	}
+	result := updater.Update(oldTree, region, newSolid.Contains)
+	if result.AffectedLeaves == 0 || result.Subtrees == 0 {
+		t.Fatalf("expected some leaves to be rebuilt: %+v", result)
+	}
+
+	// With Levels=0, every unaffected leaf should be kept as-is.
+	affected := map[*SolidTree]bool{}
+	oldTree.Tree.QueryLeaves(
+		oldTree.BoundsPolytope(model3d.X(1), model3d.Y(1), model3d.Z(1)),
+		region,
+		func(leaf *SolidTree, _ Polytope[float64, model3d.Coord3D]) bool {
+			affected[leaf] = true
+			return true
+		},
+	)
+	newLeaves := map[*SolidTree]bool{}
+	for _, leaf := range result.Tree.Tree.Leaves() {
+		newLeaves[leaf] = true
+	}
+	for _, leaf := range oldTree.Tree.Leaves() {
+		if !affected[leaf] && !newLeaves[leaf] {
+			t.Fatal("unaffected leaf was not preserved")
+		}
+	}
+
+	var oldCorrect, newCorrect, numSamples int
+	for i := 0; i < 5000; i++ {
+		c := model3d.NewCoord3DRandBounds(region.Min, region.Max)
+		expected := newSolid.Contains(c)
+		if oldTree.Tree.Predict(c) == expected {
+			oldCorrect++
+		}
+		if result.Tree.Tree.Predict(c) == expected {
+			newCorrect++
+		}
+		numSamples++
+	}
+	if acc := float64(newCorrect) / float64(numSamples); acc < 0.85 {
+		t.Errorf("accuracy in region should be high, but is %f (was %f)", acc,
+			float64(oldCorrect)/float64(numSamples))
+	}
+}
+
+func sampleOracle(
+	min, max model3d.Coord3D,
+	oracle func(model3d.Coord3D) bool,
+	numPoints int,
+) ([]model3d.Coord3D, []bool) {
+	points := make([]model3d.Coord3D, numPoints)
+	labels := make([]bool, numPoints)
+	essentials.ConcurrentMap(0, numPoints, func(i int) {
+		points[i] = model3d.NewCoord3DRandBounds(min, max)
+		labels[i] = oracle(points[i])
+	})
+	return points, labels
+}
@@ -0,0 +1,93 @@
+package treed
+
+import (
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// MeshDiagnostics summarizes defects in a mesh which make inside/outside
+// queries ambiguous.
+//
+// Meshes with any of these defects should typically be labeled with a
+// WindingNumberSolid instead of a collider, since ray casting can give
+// inconsistent answers for them.
+type MeshDiagnostics struct {
+	NumTriangles int
+
+	// BoundaryEdges is the number of edges touching only one triangle.
+	BoundaryEdges int
+
+	// Holes is the number of connected loops of boundary edges.
+	Holes int
+
+	// NonManifoldEdges is the number of edges touching more than two
+	// triangles.
+	NonManifoldEdges int
+
+	// InconsistentEdges is the number of edges which are ordered the same
+	// way in two triangles, indicating flipped normals.
+	InconsistentEdges int
+
+	// SelfIntersections is the number of pairs of triangles which intersect
+	// each other, counted twice.
+	SelfIntersections int
+}
+
+// DiagnoseMesh computes a MeshDiagnostics for a mesh.
+func DiagnoseMesh(mesh *model3d.Mesh) *MeshDiagnostics {
+	res := &MeshDiagnostics{
+		NumTriangles:      mesh.NumTriangles(),
+		InconsistentEdges: len(mesh.InconsistentEdges()),
+		SelfIntersections: mesh.SelfIntersections(),
+	}
+
+	counts := model3d.NewEdgeToNumber[int]()
+	mesh.Iterate(func(t *model3d.Triangle) {
+		for i := 0; i < 3; i++ {
+			counts.Add(model3d.NewSegment(t[i], t[(i+1)%3]), 1)
+		}
+	})
+
+	// Union boundary edges by their vertices to find the holes.
+	parents := model3d.NewCoordMap[model3d.Coord3D]()
+	var find func(c model3d.Coord3D) model3d.Coord3D
+	find = func(c model3d.Coord3D) model3d.Coord3D {
+		p, ok := parents.Load(c)
+		if !ok || p == c {
+			return c
+		}
+		root := find(p)
+		parents.Store(c, root)
+		return root
+	}
+	var boundaryVertices []model3d.Coord3D
+	counts.Range(func(edge [2]model3d.Coord3D, count int) bool {
+		if count == 1 {
+			res.BoundaryEdges++
+			for _, c := range edge {
+				if _, ok := parents.Load(c); !ok {
+					parents.Store(c, c)
+					boundaryVertices = append(boundaryVertices, c)
+				}
+			}
+			r1, r2 := find(edge[0]), find(edge[1])
+			if r1 != r2 {
+				parents.Store(r1, r2)
+			}
+		} else if count > 2 {
+			res.NonManifoldEdges++
+		}
+		return true
+	})
+	for _, c := range boundaryVertices {
+		if find(c) == c {
+			res.Holes++
+		}
+	}
+	return res
+}
+
+// Watertight returns true if the mesh has no defects.
+func (m *MeshDiagnostics) Watertight() bool {
+	return m.BoundaryEdges == 0 && m.NonManifoldEdges == 0 && m.InconsistentEdges == 0 &&
+		m.SelfIntersections == 0
+}
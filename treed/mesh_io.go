@@ -0,0 +1,226 @@
+package treed
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unixpickle/model3d/fileformats"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// LoadMesh reads the triangles of a mesh file, choosing the format based on
+// the file extension.
+//
+// Supported extensions are .stl, .obj, .ply (ASCII or binary), and .off.
+func LoadMesh(path string) ([]*model3d.Triangle, error) {
+	var reader func(io.Reader) ([]*model3d.Triangle, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".stl":
+		reader = model3d.ReadSTL
+	case ".obj":
+		reader = ReadOBJ
+	case ".ply":
+		reader = ReadPLY
+	case ".off":
+		reader = model3d.ReadOFF
+	default:
+		return nil, errors.Errorf("load mesh: unsupported file extension: %s", filepath.Ext(path))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "load mesh")
+	}
+	defer f.Close()
+	tris, err := reader(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "load mesh")
+	}
+	return tris, nil
+}
+
+// PrepareMesh creates a mesh from triangles, removing any degenerate
+// triangles with zero area or non-finite vertices.
+//
+// If center is true, the mesh is translated so that the center of its
+// bounding box is at the origin. Afterwards, the mesh is multiplied by
+// scale.
+//
+// Returns the mesh and the number of degenerate triangles that were removed.
+func PrepareMesh(
+	tris []*model3d.Triangle,
+	scale float64,
+	center bool,
+) (mesh *model3d.Mesh, numDegenerate int) {
+	mesh = model3d.NewMesh()
+	for _, t := range tris {
+		if t.Area() == 0 || !triangleFinite(t) {
+			numDegenerate++
+		} else {
+			mesh.Add(t)
+		}
+	}
+	if center && mesh.NumTriangles() > 0 {
+		mesh = mesh.Translate(mesh.Min().Mid(mesh.Max()).Scale(-1))
+	}
+	if scale != 1 {
+		mesh = mesh.Scale(scale)
+	}
+	return mesh, numDegenerate
+}
+
+func triangleFinite(t *model3d.Triangle) bool {
+	for _, c := range t {
+		for _, x := range c.Array() {
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ReadOBJ reads the faces of a Wavefront OBJ file as triangles.
+//
+// Texture coordinates, normals, and materials are ignored, and polygonal
+// faces are triangulated.
+func ReadOBJ(r io.Reader) ([]*model3d.Triangle, error) {
+	var vertices []model3d.Coord3D
+	var tris []*model3d.Triangle
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, errors.Errorf("read OBJ: line %d: invalid vertex", lineNum)
+			}
+			var c [3]float64
+			for i := range c {
+				x, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, errors.Wrapf(err, "read OBJ: line %d", lineNum)
+				}
+				c[i] = x
+			}
+			vertices = append(vertices, model3d.NewCoord3DArray(c))
+		case "f":
+			if len(fields) < 4 {
+				return nil, errors.Errorf("read OBJ: line %d: face has fewer than 3 vertices",
+					lineNum)
+			}
+			poly := make([]model3d.Coord3D, len(fields)-1)
+			for i, field := range fields[1:] {
+				idx, err := strconv.Atoi(strings.Split(field, "/")[0])
+				if err != nil {
+					return nil, errors.Wrapf(err, "read OBJ: line %d", lineNum)
+				}
+				if idx < 0 {
+					// Negative indices are relative to the end of the list.
+					idx += len(vertices)
+				} else {
+					idx--
+				}
+				if idx < 0 || idx >= len(vertices) {
+					return nil, errors.Errorf("read OBJ: line %d: vertex index out of range",
+						lineNum)
+				}
+				poly[i] = vertices[idx]
+			}
+			tris = append(tris, model3d.TriangulateFace(poly)...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read OBJ")
+	}
+	return tris, nil
+}
+
+// ReadPLY reads the faces of an ASCII or binary PLY file as triangles.
+//
+// The vertex element must come before the face element, as is the case for
+// virtually all PLY files. Other elements and properties are ignored.
+func ReadPLY(r io.Reader) ([]*model3d.Triangle, error) {
+	reader, err := fileformats.NewPLYReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read PLY")
+	}
+	var vertices []model3d.Coord3D
+	var tris []*model3d.Triangle
+	for {
+		values, elem, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "read PLY")
+		}
+		switch elem.Name {
+		case "vertex":
+			var c model3d.Coord3D
+			for i, prop := range elem.Properties {
+				var dst *float64
+				switch prop.Name {
+				case "x":
+					dst = &c.X
+				case "y":
+					dst = &c.Y
+				case "z":
+					dst = &c.Z
+				default:
+					continue
+				}
+				*dst, err = plyFloat(values[i])
+				if err != nil {
+					return nil, errors.Wrap(err, "read PLY")
+				}
+			}
+			vertices = append(vertices, c)
+		case "face":
+			for i, prop := range elem.Properties {
+				if prop.Name != "vertex_index" && prop.Name != "vertex_indices" {
+					continue
+				}
+				list, ok := values[i].(fileformats.PLYValueList)
+				if !ok {
+					return nil, errors.New("read PLY: vertex indices are not a list")
+				}
+				if len(list.Values) < 3 {
+					return nil, errors.New("read PLY: face has fewer than 3 vertices")
+				}
+				poly := make([]model3d.Coord3D, len(list.Values))
+				for j, v := range list.Values {
+					idx, err := v.LengthValue()
+					if err != nil {
+						return nil, errors.Wrap(err, "read PLY")
+					}
+					if idx < 0 || idx >= len(vertices) {
+						return nil, errors.New("read PLY: vertex index out of range")
+					}
+					poly[j] = vertices[idx]
+				}
+				tris = append(tris, model3d.TriangulateFace(poly)...)
+			}
+		}
+	}
+	return tris, nil
+}
+
+func plyFloat(v fileformats.PLYValue) (float64, error) {
+	switch v := v.(type) {
+	case fileformats.PLYValueFloat32:
+		return float64(v.Value), nil
+	case fileformats.PLYValueFloat64:
+		return v.Value, nil
+	}
+	x, err := v.LengthValue()
+	return float64(x), err
+}
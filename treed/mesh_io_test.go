@@ -0,0 +1,167 @@
+package treed
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/unixpickle/model3d/fileformats"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestReadMeshFormats(t *testing.T) {
+	mesh := model3d.NewMeshRect(model3d.XYZ(-1, -2, -3), model3d.XYZ(2, 1, 0))
+	expectedVolume := mesh.Volume()
+	vertices := mesh.VertexSlice()
+	indices := model3d.NewCoordMap[int]()
+	for i, v := range vertices {
+		indices.Store(v, i)
+	}
+
+	var objData bytes.Buffer
+	for _, v := range vertices {
+		fmt.Fprintf(&objData, "v %f %f %f\n", v.X, v.Y, v.Z)
+	}
+	fmt.Fprintln(&objData, "vn 0 0 1")
+	for _, tri := range mesh.TriangleSlice() {
+		fmt.Fprintf(
+			&objData,
+			"f %d//1 %d//1 %d//1\n",
+			indices.Value(tri[0])+1,
+			indices.Value(tri[1])+1,
+			indices.Value(tri[2])+1,
+		)
+	}
+
+	var offData bytes.Buffer
+	fmt.Fprintf(&offData, "OFF\n%d %d 0\n", len(vertices), mesh.NumTriangles())
+	for _, v := range vertices {
+		fmt.Fprintf(&offData, "%f %f %f\n", v.X, v.Y, v.Z)
+	}
+	for _, tri := range mesh.TriangleSlice() {
+		fmt.Fprintf(
+			&offData,
+			"3 %d %d %d\n",
+			indices.Value(tri[0]),
+			indices.Value(tri[1]),
+			indices.Value(tri[2]),
+		)
+	}
+
+	var asciiPLY bytes.Buffer
+	model3d.WritePLY(&asciiPLY, mesh.TriangleSlice(), func(model3d.Coord3D) [3]uint8 {
+		return [3]uint8{}
+	})
+
+	var binaryPLY bytes.Buffer
+	writer, err := fileformats.NewPLYWriter(&binaryPLY, &fileformats.PLYHeader{
+		Format: fileformats.PLYFormatBinaryLittle,
+		Elements: []*fileformats.PLYElement{
+			{
+				Name:  "vertex",
+				Count: int64(len(vertices)),
+				Properties: []*fileformats.PLYProperty{
+					{Name: "x", ElemType: fileformats.PLYPropertyTypeDouble},
+					{Name: "y", ElemType: fileformats.PLYPropertyTypeDouble},
+					{Name: "z", ElemType: fileformats.PLYPropertyTypeDouble},
+				},
+			},
+			fileformats.NewPLYElementFace(int64(mesh.NumTriangles())),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vertices {
+		writer.Write([]fileformats.PLYValue{
+			fileformats.PLYValueFloat64{Value: v.X},
+			fileformats.PLYValueFloat64{Value: v.Y},
+			fileformats.PLYValueFloat64{Value: v.Z},
+		})
+	}
+	for _, tri := range mesh.TriangleSlice() {
+		var values []fileformats.PLYValue
+		for _, c := range tri {
+			values = append(values, fileformats.PLYValueInt32{Value: int32(indices.Value(c))})
+		}
+		writer.Write([]fileformats.PLYValue{
+			fileformats.PLYValueList{
+				Length: fileformats.PLYValueUint8{Value: 3},
+				Values: values,
+			},
+		})
+	}
+
+	for _, format := range []struct {
+		name   string
+		data   []byte
+		reader func(*bytes.Reader) ([]*model3d.Triangle, error)
+	}{
+		{"obj", objData.Bytes(), func(r *bytes.Reader) ([]*model3d.Triangle, error) {
+			return ReadOBJ(r)
+		}},
+		{"off", offData.Bytes(), func(r *bytes.Reader) ([]*model3d.Triangle, error) {
+			return model3d.ReadOFF(r)
+		}},
+		{"ascii_ply", asciiPLY.Bytes(), func(r *bytes.Reader) ([]*model3d.Triangle, error) {
+			return ReadPLY(r)
+		}},
+		{"binary_ply", binaryPLY.Bytes(), func(r *bytes.Reader) ([]*model3d.Triangle, error) {
+			return ReadPLY(r)
+		}},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			tris, err := format.reader(bytes.NewReader(format.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := model3d.NewMeshTriangles(tris)
+			if actual.NumTriangles() != mesh.NumTriangles() {
+				t.Errorf("expected %d triangles but got %d", mesh.NumTriangles(),
+					actual.NumTriangles())
+			}
+			if math.Abs(actual.Volume()-expectedVolume) > 1e-5 {
+				t.Errorf("expected volume %f but got %f", expectedVolume, actual.Volume())
+			}
+		})
+	}
+}
+
+func TestReadOBJPolygons(t *testing.T) {
+	data := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf 1/1/1 2/2/1 3/3/1 4/4/1\nf -4 -3 -1\n"
+	tris, err := ReadOBJ(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tris) != 3 {
+		t.Fatalf("expected 3 triangles but got %d", len(tris))
+	}
+	var area float64
+	for _, tri := range tris {
+		area += tri.Area()
+	}
+	if math.Abs(area-1.5) > 1e-8 {
+		t.Errorf("expected area 1.5 but got %f", area)
+	}
+}
+
+func TestPrepareMesh(t *testing.T) {
+	mesh := model3d.NewMeshRect(model3d.XYZ(1, 2, 3), model3d.XYZ(3, 4, 7))
+	tris := append(mesh.TriangleSlice(), &model3d.Triangle{
+		model3d.XYZ(0, 0, 0),
+		model3d.XYZ(1, 1, 1),
+		model3d.XYZ(2, 2, 2),
+	})
+	prepared, numDegenerate := PrepareMesh(tris, 0.5, true)
+	if numDegenerate != 1 {
+		t.Errorf("expected 1 degenerate triangle but got %d", numDegenerate)
+	}
+	if prepared.NumTriangles() != mesh.NumTriangles() {
+		t.Errorf("expected %d triangles but got %d", mesh.NumTriangles(), prepared.NumTriangles())
+	}
+	expectedMin, expectedMax := model3d.XYZ(-0.5, -0.5, -1), model3d.XYZ(0.5, 0.5, 1)
+	if prepared.Min().Dist(expectedMin) > 1e-8 || prepared.Max().Dist(expectedMax) > 1e-8 {
+		t.Errorf("unexpected bounds: %v, %v", prepared.Min(), prepared.Max())
+	}
+}
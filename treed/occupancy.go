@@ -0,0 +1,72 @@
+package treed
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// OccupancyMetrics compares a tree to a ground truth occupancy function.
+type OccupancyMetrics struct {
+	// Accuracy is the fraction of points where the tree and the ground truth
+	// agree.
+	Accuracy float64
+
+	// IoU is the intersection over union of the occupied regions.
+	IoU float64
+
+	// TreeVolume and TrueVolume are the estimated volumes of the tree and
+	// the ground truth, respectively.
+	TreeVolume float64
+	TrueVolume float64
+}
+
+// EvaluateOccupancy estimates OccupancyMetrics by uniformly sampling points
+// within the bounds of a tree.
+func EvaluateOccupancy(
+	b *BoundedSolidTree,
+	oracle func(model3d.Coord3D) bool,
+	numSamples int,
+) *OccupancyMetrics {
+	var lock sync.Mutex
+	var agree, intersection, union, treeCount, trueCount int
+	essentials.StatefulConcurrentMap(0, numSamples, func() func(int) {
+		gen := rand.New(rand.NewSource(rand.Int63()))
+		return func(int) {
+			c := model3d.XYZ(gen.Float64(), gen.Float64(), gen.Float64())
+			c = c.Mul(b.Max.Sub(b.Min)).Add(b.Min)
+			actual, expected := b.Tree.Predict(c), oracle(c)
+			lock.Lock()
+			defer lock.Unlock()
+			if actual == expected {
+				agree++
+			}
+			if actual && expected {
+				intersection++
+			}
+			if actual || expected {
+				union++
+			}
+			if actual {
+				treeCount++
+			}
+			if expected {
+				trueCount++
+			}
+		}
+	})
+	size := b.Max.Sub(b.Min)
+	volume := size.X * size.Y * size.Z
+	res := &OccupancyMetrics{
+		Accuracy:   float64(agree) / float64(numSamples),
+		IoU:        1,
+		TreeVolume: volume * float64(treeCount) / float64(numSamples),
+		TrueVolume: volume * float64(trueCount) / float64(numSamples),
+	}
+	if union > 0 {
+		res.IoU = float64(intersection) / float64(union)
+	}
+	return res
+}
@@ -0,0 +1,46 @@
+package treed
+
+import (
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestEvaluateOccupancy(t *testing.T) {
+	solid := &model3d.Capsule{
+		P1:     model3d.XYZ(-0.5, -0.3, -0.4),
+		P2:     model3d.XYZ(0.5, 0.4, 0.3),
+		Radius: 0.3,
+	}
+	min, max := solid.Min(), solid.Max()
+	coords, labels := sampleOracle(min, max, solid.Contains, 20000)
+	tree := &BoundedSolidTree{
+		Min: min,
+		Max: max,
+		Tree: GreedyTree[float64, model3d.Coord3D, bool](
+			NewConstantAxisScheduleIcosphere(2).Init(),
+			coords,
+			labels,
+			EntropySplitLoss[float64]{MinCount: 5},
+			0,
+			12,
+		),
+	}
+	metrics := EvaluateOccupancy(tree, solid.Contains, 100000)
+	if metrics.Accuracy < 0.95 {
+		t.Errorf("accuracy is too low: %f", metrics.Accuracy)
+	}
+	if metrics.IoU < 0.85 {
+		t.Errorf("IoU is too low: %f", metrics.IoU)
+	}
+	if metrics.TreeVolume <= 0 || metrics.TrueVolume <= 0 {
+		t.Errorf("unexpected volumes: %f, %f", metrics.TreeVolume, metrics.TrueVolume)
+	}
+
+	// A tree which is always empty has no intersection with the solid.
+	empty := &BoundedSolidTree{Min: min, Max: max, Tree: &SolidTree{Leaf: false}}
+	metrics = EvaluateOccupancy(empty, solid.Contains, 10000)
+	if metrics.IoU != 0 || metrics.TreeVolume != 0 {
+		t.Errorf("unexpected metrics for empty tree: %+v", metrics)
+	}
+}
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"math/rand"
+
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+// ActiveLearning expands the dataset of an occupancy tree with points near
+// its decision boundary and around points that it misclassifies.
+type ActiveLearning struct {
+	// Min and Max bound the region where the tree is evaluated.
+	Min model3d.Coord3D
+	Max model3d.Coord3D
+
+	// Oracle labels new points.
+	Oracle func(c model3d.Coord3D) bool
+
+	// NumPoints is the number of points to add in each call to Augment().
+	NumPoints int
+
+	// GridSize is the resolution of the mesh used to sample the decision
+	// boundary when ray casting does not find enough points.
+	GridSize int
+
+	// Epsilon is the scale of noise added to new points, relative to the
+	// diagonal of the bounds.
+	Epsilon float64
+
+	// Logf, if non-nil, is used to log the accuracy of the tree on the new
+	// points.
+	Logf func(format string, args ...any)
+}
+
+// Augment returns an expanded dataset, appending new samples to coords and
+// labels.
+//
+// All random numbers are drawn from rng, so the result only depends on the
+// state of rng.
+func (a *ActiveLearning) Augment(
+	rng *rand.Rand,
+	tree *treed.SolidTree,
+	coords []model3d.Coord3D,
+	labels []bool,
+) ([]model3d.Coord3D, []bool) {
+	if a.NumPoints == 0 {
+		return coords, labels
+	}
+
+	a.logf("Creating %d active learning samples...", a.NumPoints)
+	epsilon := a.Min.Dist(a.Max) * a.Epsilon
+
+	boundedTree := &treed.BoundedSolidTree{Tree: tree, Min: a.Min, Max: a.Max}
+	activeSamples := treed.SampleDecisionBoundaryCast(rng, boundedTree, a.NumPoints/2,
+		a.NumPoints*128)
+	if len(activeSamples) < a.NumPoints/2 {
+		extra := treed.SampleDecisionBoundaryMesh(
+			rng,
+			boundedTree,
+			a.NumPoints/2-len(activeSamples),
+			a.GridSize,
+		)
+		activeSamples = append(activeSamples, extra...)
+	}
+
+	// Sample some points slightly outside the decision boundary
+	// to allow faster growth/shrinking.
+	for i := 0; i < len(activeSamples); i += 2 {
+		activeSamples[i] = activeSamples[i].Add(randNorm(rng).Scale(epsilon))
+	}
+
+	// Sample around points that are misclassified.
+	var badPoints []model3d.Coord3D
+	for i, c := range coords {
+		if tree.Predict(c) != labels[i] {
+			badPoints = append(badPoints, c)
+		}
+	}
+	if len(badPoints) > 0 {
+		for i := 0; i < a.NumPoints/2; i++ {
+			point := badPoints[rng.Intn(len(badPoints))]
+			point = point.Add(randNorm(rng).Scale(epsilon))
+			activeSamples = append(activeSamples, point)
+		}
+	}
+
+	newLabels := Label(activeSamples, a.Oracle)
+	var numCorrect int
+	for i, c := range activeSamples {
+		if tree.Predict(c) == newLabels[i] {
+			numCorrect++
+		}
+	}
+	if len(activeSamples) > 0 {
+		a.logf("=> active accuracy is %f", float64(numCorrect)/float64(len(activeSamples)))
+	}
+
+	return append(coords, activeSamples...), append(labels, newLabels...)
+}
+
+func (a *ActiveLearning) logf(format string, args ...any) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+// A Builder creates a tree from a labeled dataset.
+type Builder[T any] interface {
+	Build(coords []model3d.Coord3D, labels []T) *treed.Tree[float64, model3d.Coord3D, T]
+}
+
+// BuilderFunc is a Builder implemented by a function.
+type BuilderFunc[T any] func(
+	coords []model3d.Coord3D,
+	labels []T,
+) *treed.Tree[float64, model3d.Coord3D, T]
+
+// Build calls f(coords, labels).
+func (f BuilderFunc[T]) Build(
+	coords []model3d.Coord3D,
+	labels []T,
+) *treed.Tree[float64, model3d.Coord3D, T] {
+	return f(coords, labels)
+}
+
+// GreedyBuilder builds trees with treed.GreedyTree().
+type GreedyBuilder[T any] struct {
+	Axes        []model3d.Coord3D
+	Loss        treed.SplitLoss[float64, T]
+	Concurrency int
+	MaxDepth    int
+}
+
+// Build creates a greedy tree from the dataset.
+func (g *GreedyBuilder[T]) Build(
+	coords []model3d.Coord3D,
+	labels []T,
+) *treed.Tree[float64, model3d.Coord3D, T] {
+	return treed.GreedyTree[float64, model3d.Coord3D, T](
+		g.Axes,
+		coords,
+		labels,
+		g.Loss,
+		g.Concurrency,
+		g.MaxDepth,
+	)
+}
+
+// AdaptiveBuilder builds trees with treed.AdaptiveGreedyTree(), sampling new
+// points from Oracle in regions of space without enough data.
+type AdaptiveBuilder[T any] struct {
+	AxisSchedule treed.AxisSchedule[float64, model3d.Coord3D]
+	Bounds       treed.Polytope[float64, model3d.Coord3D]
+	Oracle       func(c model3d.Coord3D) T
+	Loss         treed.SplitLoss[float64, T]
+	Sampler      treed.PolytopeSampler[float64, model3d.Coord3D]
+	MinSamples   int
+	Concurrency  int
+	MaxDepth     int
+}
+
+// Build creates an adaptive greedy tree from the dataset.
+func (a *AdaptiveBuilder[T]) Build(
+	coords []model3d.Coord3D,
+	labels []T,
+) *treed.Tree[float64, model3d.Coord3D, T] {
+	return treed.AdaptiveGreedyTree(
+		a.AxisSchedule,
+		a.Bounds,
+		coords,
+		labels,
+		a.Oracle,
+		a.Loss,
+		a.Sampler,
+		a.MinSamples,
+		a.Concurrency,
+		a.MaxDepth,
+	)
+}
+
+// GreedyGrower extends trees with treed.GrowGreedyTree().
+type GreedyGrower[T any] struct {
+	Axes        []model3d.Coord3D
+	Loss        treed.SplitLoss[float64, T]
+	Concurrency int
+	MaxDepth    int
+}
+
+// Grow replaces the leaves of t with greedy subtrees fit to the dataset.
+func (g *GreedyGrower[T]) Grow(
+	t *treed.Tree[float64, model3d.Coord3D, T],
+	coords []model3d.Coord3D,
+	labels []T,
+) *treed.Tree[float64, model3d.Coord3D, T] {
+	return treed.GrowGreedyTree(t, g.Axes, coords, labels, g.Loss, g.Concurrency, g.MaxDepth)
+}
+
+// AdaptiveGrower extends trees with treed.GrowAdaptiveGreedyTree(), sampling
+// new points from Oracle in leaves without enough data.
+//
+// Bounds is the polytope of the root of the trees to grow.
+type AdaptiveGrower[T any] struct {
+	AxisSchedule treed.AxisSchedule[float64, model3d.Coord3D]
+	Bounds       treed.Polytope[float64, model3d.Coord3D]
+	Oracle       func(c model3d.Coord3D) T
+	Loss         treed.SplitLoss[float64, T]
+	Sampler      treed.PolytopeSampler[float64, model3d.Coord3D]
+	MinSamples   int
+	Concurrency  int
+	MaxDepth     int
+}
+
+// Grow replaces the leaves of t with adaptive greedy subtrees.
+func (a *AdaptiveGrower[T]) Grow(
+	t *treed.Tree[float64, model3d.Coord3D, T],
+	coords []model3d.Coord3D,
+	labels []T,
+) *treed.Tree[float64, model3d.Coord3D, T] {
+	return treed.GrowAdaptiveGreedyTree(
+		t,
+		a.AxisSchedule,
+		a.Bounds,
+		coords,
+		labels,
+		a.Oracle,
+		a.Loss,
+		a.Sampler,
+		a.MinSamples,
+		a.Concurrency,
+		a.MaxDepth,
+	)
+}
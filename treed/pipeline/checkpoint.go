@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+const (
+	checkpointCurrent = "current"
+	checkpointNext    = "next"
+
+	checkpointMeta  = "state.json"
+	checkpointTree  = "tree.gob"
+	checkpointTrain = "train.gob"
+	checkpointTest  = "test.gob"
+)
+
+type checkpointMetadata struct {
+	Stage           Stage   `json:"stage"`
+	Iteration       int     `json:"iteration"`
+	WarmStart       bool    `json:"warm_start"`
+	TestLoss        float64 `json:"test_loss"`
+	BestTestLoss    float64 `json:"best_test_loss"`
+	StaleIterations int     `json:"stale_iterations"`
+	Seed            int64   `json:"seed"`
+}
+
+type checkpointDataset[T any] struct {
+	Coords []model3d.Coord3D
+	Labels []T
+}
+
+// SaveCheckpoint writes the full state of a training run to a directory,
+// replacing any checkpoint that is already there.
+//
+// The new checkpoint is written completely before the old one is removed, so
+// a checkpoint can always be loaded if the process is killed while saving.
+func SaveCheckpoint[T any](dir string, s *State[T]) error {
+	if err := saveCheckpoint(dir, s); err != nil {
+		return errors.Wrap(err, "save checkpoint")
+	}
+	return nil
+}
+
+func saveCheckpoint[T any](dir string, s *State[T]) error {
+	nextDir := filepath.Join(dir, checkpointNext)
+	if err := os.RemoveAll(nextDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(nextDir, 0755); err != nil {
+		return err
+	}
+
+	metadata := &checkpointMetadata{
+		Stage:           s.Stage,
+		Iteration:       s.Iteration,
+		WarmStart:       s.WarmStart,
+		TestLoss:        s.TestLoss,
+		BestTestLoss:    s.BestTestLoss,
+		StaleIterations: s.StaleIterations,
+		Seed:            s.Seed,
+	}
+	if err := writeCheckpointFile(nextDir, checkpointMeta, func(f *os.File) error {
+		return json.NewEncoder(f).Encode(metadata)
+	}); err != nil {
+		return err
+	}
+	files := map[string]any{
+		checkpointTree:  s.Tree,
+		checkpointTrain: &checkpointDataset[T]{Coords: s.Coords, Labels: s.Labels},
+		checkpointTest:  &checkpointDataset[T]{Coords: s.TestCoords, Labels: s.TestLabels},
+	}
+	for name, obj := range files {
+		if err := writeCheckpointFile(nextDir, name, func(f *os.File) error {
+			return gob.NewEncoder(f).Encode(obj)
+		}); err != nil {
+			return err
+		}
+	}
+
+	currentDir := filepath.Join(dir, checkpointCurrent)
+	if err := os.RemoveAll(currentDir); err != nil {
+		return err
+	}
+	return os.Rename(nextDir, currentDir)
+}
+
+func writeCheckpointFile(dir, name string, fn func(f *os.File) error) error {
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadCheckpoint reads a State written by SaveCheckpoint.
+//
+// Running a Pipeline on the loaded State continues the original run without
+// saving the same checkpoint again.
+func LoadCheckpoint[T any](dir string) (*State[T], error) {
+	res, err := loadCheckpoint[T](dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "load checkpoint")
+	}
+	return res, nil
+}
+
+func loadCheckpoint[T any](dir string) (*State[T], error) {
+	checkpointDir := filepath.Join(dir, checkpointCurrent)
+	if _, err := os.Stat(checkpointDir); os.IsNotExist(err) {
+		// The process may have stopped after removing the old checkpoint but
+		// before renaming the new one.
+		nextDir := filepath.Join(dir, checkpointNext)
+		if _, err := os.Stat(nextDir); err == nil {
+			checkpointDir = nextDir
+		}
+	}
+
+	var metadata checkpointMetadata
+	var tree *treed.Tree[float64, model3d.Coord3D, T]
+	var train, test checkpointDataset[T]
+	if err := readCheckpointFile(checkpointDir, checkpointMeta, func(f *os.File) error {
+		return json.NewDecoder(f).Decode(&metadata)
+	}); err != nil {
+		return nil, err
+	}
+	files := map[string]any{
+		checkpointTree:  &tree,
+		checkpointTrain: &train,
+		checkpointTest:  &test,
+	}
+	for name, obj := range files {
+		if err := readCheckpointFile(checkpointDir, name, func(f *os.File) error {
+			return gob.NewDecoder(f).Decode(obj)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &State[T]{
+		Stage:           metadata.Stage,
+		Iteration:       metadata.Iteration,
+		Tree:            tree,
+		WarmStart:       metadata.WarmStart,
+		Coords:          train.Coords,
+		Labels:          train.Labels,
+		TestCoords:      test.Coords,
+		TestLabels:      test.Labels,
+		TestLoss:        metadata.TestLoss,
+		BestTestLoss:    metadata.BestTestLoss,
+		StaleIterations: metadata.StaleIterations,
+		Seed:            metadata.Seed,
+		resumed:         true,
+	}, nil
+}
+
+func readCheckpointFile(dir, name string, fn func(f *os.File) error) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return fn(f)
+}
+
+// CheckpointExists checks if a directory contains a checkpoint written by
+// SaveCheckpoint.
+func CheckpointExists(dir string) bool {
+	for _, name := range []string{checkpointCurrent, checkpointNext} {
+		_, err := os.Stat(filepath.Join(dir, name, checkpointMeta))
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
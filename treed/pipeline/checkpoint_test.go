@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func TestCheckpoint(t *testing.T) {
+	solid := &model3d.Sphere{Radius: 0.5}
+	rng := rand.New(rand.NewSource(1337))
+	coords, labels := UniformDataset(rng, solid.Min(), solid.Max(), solid.Contains, 5000)
+	testCoords, testLabels := UniformDataset(rng, solid.Min(), solid.Max(), solid.Contains, 1000)
+	tree := treed.GreedyTree[float64, model3d.Coord3D, bool](
+		treed.NewConstantAxisScheduleIcosphere(1).Init(),
+		coords,
+		labels,
+		treed.EntropySplitLoss[float64]{MinCount: 5},
+		0,
+		6,
+	)
+	state := &State[bool]{
+		Stage:           StageRefine,
+		Iteration:       3,
+		Tree:            tree,
+		WarmStart:       true,
+		Coords:          coords,
+		Labels:          labels,
+		TestCoords:      testCoords,
+		TestLabels:      testLabels,
+		TestLoss:        0.125,
+		BestTestLoss:    0.1,
+		StaleIterations: 2,
+		Seed:            42,
+	}
+
+	dir := t.TempDir()
+	if CheckpointExists(dir) {
+		t.Fatal("checkpoint should not exist yet")
+	}
+	// Save twice to make sure old checkpoints are replaced.
+	for i := 0; i < 2; i++ {
+		if err := SaveCheckpoint(dir, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !CheckpointExists(dir) {
+		t.Fatal("checkpoint should exist")
+	}
+
+	loaded, err := LoadCheckpoint[bool](dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Stage != state.Stage || loaded.Iteration != state.Iteration ||
+		loaded.WarmStart != state.WarmStart ||
+		loaded.TestLoss != state.TestLoss || loaded.BestTestLoss != state.BestTestLoss ||
+		loaded.StaleIterations != state.StaleIterations || loaded.Seed != state.Seed {
+		t.Errorf("unexpected loaded state: %v", loaded)
+	}
+	if len(loaded.Coords) != len(coords) || len(loaded.TestCoords) != len(testCoords) {
+		t.Fatal("unexpected dataset sizes")
+	}
+	for i, c := range coords {
+		if loaded.Coords[i] != c || loaded.Labels[i] != labels[i] {
+			t.Fatalf("training point %d differs", i)
+		}
+	}
+	for i, c := range testCoords {
+		if loaded.TestCoords[i] != c || loaded.TestLabels[i] != testLabels[i] {
+			t.Fatalf("test point %d differs", i)
+		}
+		if loaded.Tree.Predict(c) != tree.Predict(c) {
+			t.Fatalf("tree prediction differs at %v", c)
+		}
+	}
+	if loaded.Tree.NumLeaves() != tree.NumLeaves() {
+		t.Errorf("expected %d leaves but got %d", tree.NumLeaves(), loaded.Tree.NumLeaves())
+	}
+
+	// Simulate a process which stopped before renaming the new checkpoint.
+	current := filepath.Join(dir, checkpointCurrent)
+	if err := os.Rename(current, filepath.Join(dir, checkpointNext)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCheckpoint[bool](dir); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	// Mimic the setup of mesh_to_tree, with a mesh-based dataset and
+	// decision boundary active learning.
+	mesh := model3d.MarchingCubesSearch(
+		&model3d.Capsule{P1: model3d.XYZ(-0.5, 0, 0), P2: model3d.XYZ(0.5, 0, 0), Radius: 0.3},
+		0.05,
+		8,
+	)
+	solid := model3d.NewColliderSolid(model3d.MeshToCollider(mesh))
+	min, max := PaddedBounds(solid.Min(), solid.Max(), 0.1)
+	active := &ActiveLearning{
+		Min:       min,
+		Max:       max,
+		Oracle:    solid.Contains,
+		NumPoints: 500,
+		GridSize:  16,
+		Epsilon:   0.01,
+	}
+	newPipeline := func(checkpoint func(s *State[bool]) error) *Pipeline[bool] {
+		return &Pipeline[bool]{
+			Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+				return Dataset(rng, min, max, mesh, solid.Contains, n, n/2, 0.01)
+			},
+			TestDataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+				return UniformDataset(rng, min, max, solid.Contains, n)
+			},
+			DatasetSize:     2000,
+			TestDatasetSize: 2000,
+			TAODatasetSize:  4000,
+			Builder: &GreedyBuilder[bool]{
+				Axes:     treed.NewConstantAxisScheduleIcosphere(1).Init(),
+				Loss:     treed.EntropySplitLoss[float64]{MinCount: 5},
+				MaxDepth: 8,
+			},
+			ActiveLearning: active.Augment,
+			Rebuilds:       2,
+			ActiveTAO:      true,
+			TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+				Loss:     treed.EqualityTAOLoss[bool]{},
+				LR:       0.1,
+				Momentum: 0.9,
+				Iters:    20,
+			},
+			TAOIters:   3,
+			Simplify:   true,
+			Checkpoint: checkpoint,
+		}
+	}
+
+	var totalCheckpoints int
+	expected := &State[bool]{Seed: 1234}
+	err := newPipeline(func(s *State[bool]) error {
+		totalCheckpoints++
+		return nil
+	}).Run(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Kill the run right after every possible checkpoint.
+	errKilled := errors.New("killed")
+	for k := 0; k < totalCheckpoints; k++ {
+		dir := t.TempDir()
+		var numSaved int
+		err := newPipeline(func(s *State[bool]) error {
+			if err := SaveCheckpoint(dir, s); err != nil {
+				return err
+			}
+			numSaved++
+			if numSaved > k {
+				return errKilled
+			}
+			return nil
+		}).Run(&State[bool]{Seed: 1234})
+		if errors.Cause(err) != errKilled {
+			t.Fatalf("checkpoint %d: unexpected error: %v", k, err)
+		}
+
+		state, err := LoadCheckpoint[bool](dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var numResumed int
+		err = newPipeline(func(s *State[bool]) error {
+			numResumed++
+			return nil
+		}).Run(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if numSaved+numResumed != totalCheckpoints {
+			t.Errorf("checkpoint %d: expected %d more checkpoints but got %d", k,
+				totalCheckpoints-numSaved, numResumed)
+		}
+		if !reflect.DeepEqual(state.Coords, expected.Coords) ||
+			!reflect.DeepEqual(state.TestCoords, expected.TestCoords) {
+			t.Errorf("checkpoint %d: resumed dataset differs", k)
+		}
+		if !reflect.DeepEqual(state.Tree, expected.Tree) {
+			t.Errorf("checkpoint %d: resumed tree differs", k)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"math/rand"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+// Dataset samples numPoints points for a mesh, where numSurface of the points
+// are sampled near the surface of the mesh and the rest are sampled uniformly
+// within the bounds.
+//
+// Surface points are perturbed by Gaussian noise with standard deviation
+// noise.
+//
+// All of the points are drawn from rng, so the dataset only depends on the
+// state of rng and not on the global random number generator.
+func Dataset[T any](
+	rng *rand.Rand,
+	min, max model3d.Coord3D,
+	mesh *model3d.Mesh,
+	oracle func(c model3d.Coord3D) T,
+	numPoints int,
+	numSurface int,
+	noise float64,
+) ([]model3d.Coord3D, []T) {
+	coords, labels := UniformDataset(rng, min, max, oracle, numPoints-numSurface)
+	if numSurface > 0 {
+		meshCoords, meshLabels := SurfaceDataset(rng, mesh, oracle, numSurface, noise)
+		coords = append(coords, meshCoords...)
+		labels = append(labels, meshLabels...)
+	}
+	return coords, labels
+}
+
+// UniformDataset samples points uniformly within a bounding box and labels
+// them with an oracle.
+func UniformDataset[T any](
+	rng *rand.Rand,
+	min, max model3d.Coord3D,
+	oracle func(c model3d.Coord3D) T,
+	numPoints int,
+) ([]model3d.Coord3D, []T) {
+	coords := UniformPoints(rng, min, max, numPoints)
+	return coords, Label(coords, oracle)
+}
+
+// UniformPoints samples points uniformly within a bounding box.
+func UniformPoints(rng *rand.Rand, min, max model3d.Coord3D, numPoints int) []model3d.Coord3D {
+	size := max.Sub(min)
+	coords := make([]model3d.Coord3D, numPoints)
+	for i := range coords {
+		c := model3d.XYZ(rng.Float64(), rng.Float64(), rng.Float64())
+		coords[i] = c.Mul(size).Add(min)
+	}
+	return coords
+}
+
+// SurfaceDataset samples points on the surface of a mesh, adds Gaussian noise
+// with standard deviation noise, and labels the results with an oracle.
+func SurfaceDataset[T any](
+	rng *rand.Rand,
+	mesh *model3d.Mesh,
+	oracle func(c model3d.Coord3D) T,
+	numPoints int,
+	noise float64,
+) ([]model3d.Coord3D, []T) {
+	coords := SurfacePoints(rng, mesh, numPoints)
+	for i, c := range coords {
+		coords[i] = c.Add(randNorm(rng).Scale(noise))
+	}
+	return coords, Label(coords, oracle)
+}
+
+// SurfacePoints samples points uniformly on the surface of a mesh.
+func SurfacePoints(rng *rand.Rand, mesh *model3d.Mesh, numPoints int) []model3d.Coord3D {
+	sampler := treed.NewMeshSurfaceSampler(mesh)
+	points := make([]model3d.Coord3D, numPoints)
+	for i := range points {
+		points[i] = sampler.Sample(rng)
+	}
+	return points
+}
+
+// Label concurrently applies an oracle to every point.
+func Label[T any](coords []model3d.Coord3D, oracle func(c model3d.Coord3D) T) []T {
+	labels := make([]T, len(coords))
+	essentials.ConcurrentMap(0, len(coords), func(i int) {
+		labels[i] = oracle(coords[i])
+	})
+	return labels
+}
+
+func randNorm(rng *rand.Rand) model3d.Coord3D {
+	return model3d.XYZ(rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64())
+}
+
+// PaddedBounds expands a bounding box on every side by a fraction of the
+// length of its diagonal.
+func PaddedBounds(min, max model3d.Coord3D, frac float64) (model3d.Coord3D, model3d.Coord3D) {
+	size := min.Dist(max)
+	return min.AddScalar(-size * frac), max.AddScalar(size * frac)
+}
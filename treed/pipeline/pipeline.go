@@ -0,0 +1,307 @@
+// Package pipeline implements reusable stages for training trees, such as
+// dataset sampling, active learning, greedy building, TAO refinement, and
+// simplification.
+package pipeline
+
+import (
+	"math/rand"
+
+	"github.com/pkg/errors"
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+// A Stage identifies the next step of a Pipeline to run.
+type Stage int
+
+const (
+	StageBuild Stage = iota
+	StageRebuild
+	StageRefine
+	StageSimplify
+	StageDone
+)
+
+// State is the full state of a training run.
+//
+// A State is updated in place by Pipeline.Run(), and may be inspected or
+// saved by a checkpoint function in between iterations.
+type State[T any] struct {
+	// Stage is the next stage to run, and Iteration is the number of
+	// iterations of this stage that have already completed.
+	Stage     Stage
+	Iteration int
+
+	// Tree is the current tree, or nil before the build stage.
+	Tree *treed.Tree[float64, model3d.Coord3D, T]
+
+	// WarmStart is true if the run started from an existing tree, in which
+	// case the rebuild stage expands the dataset without rebuilding the tree.
+	WarmStart bool
+
+	// Coords and Labels are the training dataset.
+	Coords []model3d.Coord3D
+	Labels []T
+
+	// TestCoords and TestLabels are the test dataset.
+	TestCoords []model3d.Coord3D
+	TestLabels []T
+
+	// TestLoss is the test loss of Tree during refinement, and BestTestLoss
+	// is the lowest test loss seen so far. StaleIterations is the number of
+	// refinement iterations since BestTestLoss last improved.
+	TestLoss        float64
+	BestTestLoss    float64
+	StaleIterations int
+
+	// Seed determines the random numbers used by the run.
+	//
+	// Rand is reseeded from Seed, Stage, and Iteration at the start of the
+	// run and of every iteration, and is passed to the Dataset and
+	// ActiveLearning functions. This way, a run which is resumed from a
+	// checkpoint draws the same random numbers as the original run.
+	Seed int64
+	Rand *rand.Rand
+
+	// resumed is true if the State was loaded from a checkpoint and has not
+	// been checkpointed again since.
+	resumed bool
+}
+
+func (s *State[T]) reseed() {
+	x := uint64(s.Seed) ^ uint64(s.Stage)<<56 ^ uint64(s.Iteration)*0x9e3779b97f4a7c15
+	s.Rand = rand.New(rand.NewSource(int64(x)))
+}
+
+// A Pipeline trains a tree in a sequence of stages:
+//
+//  1. Sample a dataset with Dataset, unless the State already has one.
+//  2. Build an initial tree with Builder. If the State already has a tree,
+//     it is extended with Grow instead.
+//  3. Rebuild the tree Rebuilds times, expanding the dataset with
+//     ActiveLearning before each rebuild. When starting from an existing
+//     tree, the dataset is expanded the same way, but the tree is kept.
+//  4. Refine the tree with TAO for at most TAOIters iterations, stopping
+//     early if the training loss stops decreasing or if the test loss does
+//     not improve for Patience iterations.
+//  5. Simplify the tree, if Simplify is true.
+type Pipeline[T any] struct {
+	// Dataset samples a labeled dataset of a given size.
+	//
+	// It is used for the training set, for the test set if TestDataset is
+	// nil, and to extend the training set before refinement.
+	Dataset func(rng *rand.Rand, numPoints int) ([]model3d.Coord3D, []T)
+
+	// TestDataset, if non-nil, samples the test set instead of Dataset.
+	TestDataset func(rng *rand.Rand, numPoints int) ([]model3d.Coord3D, []T)
+
+	DatasetSize     int
+	TestDatasetSize int
+
+	// TAODatasetSize is the minimum size of the training set for refinement.
+	// If the training set is smaller, more points are sampled before
+	// refinement begins.
+	//
+	// TAOTopUpSize is the number of points to sample in this case. If it is
+	// 0, just enough points are sampled to reach TAODatasetSize.
+	TAODatasetSize int
+	TAOTopUpSize   int
+
+	// Builder creates the initial tree and any rebuilt trees.
+	Builder Builder[T]
+
+	// Grow, if non-nil, extends an initial tree, such as a tree from a
+	// previous training run. If nil, initial trees are used as-is.
+	Grow func(
+		tree *treed.Tree[float64, model3d.Coord3D, T],
+		coords []model3d.Coord3D,
+		labels []T,
+	) *treed.Tree[float64, model3d.Coord3D, T]
+
+	// ActiveLearning, if non-nil, returns an expanded dataset for a tree.
+	ActiveLearning func(
+		rng *rand.Rand,
+		tree *treed.Tree[float64, model3d.Coord3D, T],
+		coords []model3d.Coord3D,
+		labels []T,
+	) ([]model3d.Coord3D, []T)
+
+	// Rebuilds is the number of active learning rebuilds.
+	Rebuilds int
+
+	// ActiveTAO, if true, applies ActiveLearning before every TAO iteration.
+	ActiveTAO bool
+
+	TAO      treed.TAO[float64, model3d.Coord3D, T]
+	TAOIters int
+
+	// Patience, if non-zero, is the number of TAO iterations to allow without
+	// an improvement in test loss before stopping.
+	Patience int
+
+	// Simplify, if true, simplifies the tree after refinement.
+	Simplify bool
+
+	// Checkpoint, if non-nil, is called at the start of every rebuild and
+	// every TAO iteration, except for the first iteration after resuming from
+	// a checkpoint.
+	Checkpoint func(s *State[T]) error
+
+	// Logf, if non-nil, is used to log progress.
+	Logf func(format string, args ...any)
+}
+
+// Run trains a tree, starting from the stage and iteration in s.
+//
+// When Run returns without an error, s.Stage is StageDone and s.Tree is the
+// final tree.
+//
+// A resumed run produces the same tree as an uninterrupted run, as long as
+// the Dataset and ActiveLearning functions only draw random numbers from the
+// generator they are passed, and the Builder, Grow, and TAO stages are
+// deterministic.
+func (p *Pipeline[T]) Run(s *State[T]) error {
+	s.reseed()
+	if s.Stage == StageBuild {
+		if s.Coords == nil {
+			p.logf("Sampling dataset...")
+			s.Coords, s.Labels = p.Dataset(s.Rand, p.DatasetSize)
+		}
+		if s.Tree == nil {
+			p.logf("Building initial tree...")
+			s.Tree = p.Builder.Build(s.Coords, s.Labels)
+			s.Stage, s.Iteration = StageRebuild, 0
+		} else {
+			if p.Grow != nil {
+				p.logf("Growing initial tree...")
+				oldCount := s.Tree.NumLeaves()
+				s.Tree = p.Grow(s.Tree, s.Coords, s.Labels)
+				p.logf(" => went from %d to %d leaves", oldCount, s.Tree.NumLeaves())
+			}
+			// Rebuilding would discard the initial tree.
+			s.WarmStart = true
+			s.Stage, s.Iteration = StageRebuild, 0
+		}
+	}
+
+	for s.Stage == StageRebuild && s.Iteration < p.Rebuilds && p.ActiveLearning != nil {
+		if err := p.checkpoint(s); err != nil {
+			return err
+		}
+		if s.WarmStart {
+			p.logf("Apply active learning %d/%d...", s.Iteration+1, p.Rebuilds)
+		} else {
+			p.logf("Apply active learning rebuild %d/%d...", s.Iteration+1, p.Rebuilds)
+		}
+		s.Coords, s.Labels = p.ActiveLearning(s.Rand, s.Tree, s.Coords, s.Labels)
+		if !s.WarmStart {
+			s.Tree = p.Builder.Build(s.Coords, s.Labels)
+		}
+		s.Iteration++
+	}
+
+	if s.Stage == StageRebuild {
+		s.reseed()
+		if len(s.Coords) < p.TAODatasetSize && p.Dataset != nil {
+			p.logf("Sampling TAO dataset...")
+			topUpSize := p.TAOTopUpSize
+			if topUpSize == 0 {
+				topUpSize = p.TAODatasetSize - len(s.Coords)
+			}
+			coords, labels := p.Dataset(s.Rand, topUpSize)
+			s.Coords = append(s.Coords, coords...)
+			s.Labels = append(s.Labels, labels...)
+		}
+		if s.TestCoords == nil {
+			p.logf("Sampling test dataset...")
+			testDataset := p.TestDataset
+			if testDataset == nil {
+				testDataset = p.Dataset
+			}
+			s.TestCoords, s.TestLabels = testDataset(s.Rand, p.TestDatasetSize)
+		}
+		progress := p.refiner().Start(s.Tree, s.TestCoords, s.TestLabels)
+		s.TestLoss, s.BestTestLoss = progress.TestLoss, progress.BestTestLoss
+		s.StaleIterations = 0
+		s.Stage, s.Iteration = StageRefine, 0
+		p.logf("Refining tree with TAO...")
+	}
+
+	if s.Stage == StageRefine {
+		refiner := p.refiner()
+		progress := &treed.TAOProgress{
+			Iteration:       s.Iteration,
+			TestLoss:        s.TestLoss,
+			BestTestLoss:    s.BestTestLoss,
+			StaleIterations: s.StaleIterations,
+			Done:            s.Iteration >= p.TAOIters,
+		}
+		for !progress.Done {
+			if err := p.checkpoint(s); err != nil {
+				return err
+			}
+			if p.ActiveTAO && p.ActiveLearning != nil {
+				s.Coords, s.Labels = p.ActiveLearning(s.Rand, s.Tree, s.Coords, s.Labels)
+			}
+			s.Tree = refiner.Step(s.Tree, s.Coords, s.Labels, s.TestCoords, s.TestLabels,
+				progress)
+			s.Iteration = progress.Iteration
+			s.TestLoss = progress.TestLoss
+			s.BestTestLoss = progress.BestTestLoss
+			s.StaleIterations = progress.StaleIterations
+		}
+		s.Stage, s.Iteration = StageSimplify, 0
+	}
+
+	if s.Stage == StageSimplify {
+		if p.Simplify {
+			p.logf("Simplifying tree...")
+			oldCount := s.Tree.NumLeaves()
+			s.Tree = s.Tree.Simplify(s.Coords, s.Labels, p.TAO.Loss)
+			p.logf(" => went from %d to %d leaves", oldCount, s.Tree.NumLeaves())
+		}
+		s.Stage, s.Iteration = StageDone, 0
+	}
+
+	return nil
+}
+
+func (p *Pipeline[T]) refiner() *treed.TAORefiner[float64, model3d.Coord3D, T] {
+	return &treed.TAORefiner[float64, model3d.Coord3D, T]{
+		TAO:      &p.TAO,
+		Iters:    p.TAOIters,
+		Patience: p.Patience,
+		Logf:     p.Logf,
+	}
+}
+
+// checkpoint starts an iteration by saving a checkpoint and reseeding
+// s.Rand.
+//
+// The checkpoint is skipped right after resuming, since it would be identical
+// to the one that was loaded.
+func (p *Pipeline[T]) checkpoint(s *State[T]) error {
+	if p.Checkpoint != nil && !s.resumed {
+		if err := p.Checkpoint(s); err != nil {
+			return errors.Wrap(err, "checkpoint")
+		}
+	}
+	s.resumed = false
+	s.reseed()
+	return nil
+}
+
+func (p *Pipeline[T]) logf(format string, args ...any) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
+
+// SaveTree creates a checkpoint function which saves the current tree of a
+// State as a treed.BoundedSolidTree.
+func SaveTree(path string, min, max model3d.Coord3D) func(s *State[bool]) error {
+	return func(s *State[bool]) error {
+		boundedTree := &treed.BoundedSolidTree{Min: min, Max: max, Tree: s.Tree}
+		return treed.Save(path, boundedTree, treed.WriteBoundedSolidTree)
+	}
+}
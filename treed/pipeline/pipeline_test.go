@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/tree-d/treed"
+)
+
+func TestPipeline(t *testing.T) {
+	solid := &model3d.Capsule{P1: model3d.XYZ(-0.5, 0, 0), P2: model3d.XYZ(0.5, 0, 0), Radius: 0.3}
+	min, max := PaddedBounds(solid.Min(), solid.Max(), 0.1)
+	active := &ActiveLearning{
+		Min:       min,
+		Max:       max,
+		Oracle:    solid.Contains,
+		NumPoints: 2000,
+		GridSize:  16,
+		Epsilon:   0.01,
+	}
+	var numCheckpoints int
+	p := &Pipeline[bool]{
+		Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			return UniformDataset(rng, min, max, solid.Contains, n)
+		},
+		DatasetSize:     10000,
+		TestDatasetSize: 10000,
+		TAODatasetSize:  20000,
+		Builder: &GreedyBuilder[bool]{
+			Axes:     treed.NewConstantAxisScheduleIcosphere(1).Init(),
+			Loss:     treed.EntropySplitLoss[float64]{MinCount: 5},
+			MaxDepth: 12,
+		},
+		ActiveLearning: active.Augment,
+		Rebuilds:       2,
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:        treed.EqualityTAOLoss[bool]{},
+			LR:          0.1,
+			WeightDecay: 1e-4,
+			Momentum:    0.9,
+			Iters:       100,
+		},
+		TAOIters: 2,
+		Simplify: true,
+		Checkpoint: func(s *State[bool]) error {
+			numCheckpoints++
+			if s.Tree == nil {
+				t.Error("checkpoint without a tree")
+			}
+			return nil
+		},
+	}
+	state := &State[bool]{}
+	if err := p.Run(state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Stage != StageDone {
+		t.Errorf("unexpected final stage: %d", state.Stage)
+	}
+	if len(state.Coords) < p.TAODatasetSize {
+		t.Errorf("expected at least %d training points but got %d", p.TAODatasetSize,
+			len(state.Coords))
+	}
+	if len(state.TestCoords) != p.TestDatasetSize {
+		t.Errorf("expected %d test points but got %d", p.TestDatasetSize, len(state.TestCoords))
+	}
+	if numCheckpoints < p.Rebuilds+1 {
+		t.Errorf("expected at least %d checkpoints but got %d", p.Rebuilds+1, numCheckpoints)
+	}
+
+	var numCorrect int
+	for i, c := range state.TestCoords {
+		if state.Tree.Predict(c) == state.TestLabels[i] {
+			numCorrect++
+		}
+	}
+	if acc := float64(numCorrect) / float64(len(state.TestCoords)); acc < 0.95 {
+		t.Errorf("unexpectedly low accuracy: %f", acc)
+	}
+}
+
+func TestPipelineExistingDataset(t *testing.T) {
+	coords, labels := UniformDataset(
+		rand.New(rand.NewSource(1337)),
+		model3d.XYZ(-1, -1, -1),
+		model3d.XYZ(1, 1, 1),
+		func(c model3d.Coord3D) bool { return c.X > 0.2 },
+		1000,
+	)
+	p := &Pipeline[bool]{
+		Builder: &GreedyBuilder[bool]{
+			Axes:     []model3d.Coord3D{model3d.X(1), model3d.Y(1), model3d.Z(1)},
+			Loss:     treed.EntropySplitLoss[float64]{MinCount: 1},
+			MaxDepth: 4,
+		},
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:  treed.EqualityTAOLoss[bool]{},
+			LR:    0.1,
+			Iters: 10,
+		},
+	}
+	state := &State[bool]{
+		Coords:     coords,
+		Labels:     labels,
+		TestCoords: coords,
+		TestLabels: labels,
+	}
+	if err := p.Run(state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Coords) != len(coords) {
+		t.Errorf("dataset should not change, but has size %d", len(state.Coords))
+	}
+	if state.TestLoss != 0 {
+		t.Errorf("unexpected test loss: %f", state.TestLoss)
+	}
+}
+
+func TestPipelineInitialTree(t *testing.T) {
+	oracle := func(c model3d.Coord3D) bool { return c.X > 0.2 && c.Y < 0.5 }
+	min, max := model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1)
+	axes := []model3d.Coord3D{model3d.X(1), model3d.Y(1), model3d.Z(1)}
+	initTree := &treed.SolidTree{
+		Axis:         model3d.X(1),
+		Threshold:    0.2,
+		LessThan:     &treed.SolidTree{Leaf: false},
+		GreaterEqual: &treed.SolidTree{Leaf: true},
+	}
+
+	var numBuilds, numActive int
+	p := &Pipeline[bool]{
+		Dataset: func(rng *rand.Rand, n int) ([]model3d.Coord3D, []bool) {
+			return UniformDataset(rng, min, max, oracle, n)
+		},
+		DatasetSize:     2000,
+		TestDatasetSize: 2000,
+		Builder: BuilderFunc[bool](func(coords []model3d.Coord3D, labels []bool) *treed.SolidTree {
+			numBuilds++
+			return &treed.SolidTree{}
+		}),
+		Grow: (&GreedyGrower[bool]{
+			Axes:     axes,
+			Loss:     treed.EntropySplitLoss[float64]{MinCount: 1},
+			MaxDepth: 2,
+		}).Grow,
+		ActiveLearning: func(
+			rng *rand.Rand,
+			tree *treed.SolidTree,
+			coords []model3d.Coord3D,
+			labels []bool,
+		) ([]model3d.Coord3D, []bool) {
+			numActive++
+			return coords, labels
+		},
+		Rebuilds: 3,
+		TAO: treed.TAO[float64, model3d.Coord3D, bool]{
+			Loss:  treed.EqualityTAOLoss[bool]{},
+			LR:    0.1,
+			Iters: 10,
+		},
+	}
+	state := &State[bool]{Tree: initTree}
+	if err := p.Run(state); err != nil {
+		t.Fatal(err)
+	}
+	if numBuilds != 0 {
+		t.Errorf("initial tree should not be rebuilt, but got %d builds", numBuilds)
+	}
+	if numActive != p.Rebuilds {
+		t.Errorf("expected %d active learning steps but got %d", p.Rebuilds, numActive)
+	}
+	if state.Tree.Axis != initTree.Axis || state.Tree.Threshold != initTree.Threshold {
+		t.Error("root of initial tree should be preserved")
+	}
+	// Test points may fall between the training points nearest to a boundary.
+	if state.TestLoss > 20 {
+		t.Errorf("expected grown tree to be nearly perfect, but test loss is %f", state.TestLoss)
+	}
+}
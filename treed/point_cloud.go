@@ -0,0 +1,280 @@
+package treed
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/fileformats"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// PointCloudNeighbors is the number of nearest neighbors used to estimate the
+// local sample spacing of a point cloud.
+const PointCloudNeighbors = 10
+
+// An OrientedPointCloud is a set of points sampled from a surface, along
+// with outward-facing unit normals at each point.
+type OrientedPointCloud struct {
+	Points  []model3d.Coord3D
+	Normals []model3d.Coord3D
+}
+
+// LoadPointCloud reads an oriented point cloud, choosing the format based on
+// the file extension.
+//
+// Supported extensions are .ply, where vertices must have nx, ny, and nz
+// properties, and .xyz or .xyzn, where each line contains a point followed by
+// its normal.
+func LoadPointCloud(path string) (*OrientedPointCloud, error) {
+	var reader func(io.Reader) (*OrientedPointCloud, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ply":
+		reader = ReadPointCloudPLY
+	case ".xyz", ".xyzn":
+		reader = ReadPointCloudXYZ
+	default:
+		return nil, errors.Errorf("load point cloud: unsupported file extension: %s",
+			filepath.Ext(path))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "load point cloud")
+	}
+	defer f.Close()
+	res, err := reader(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "load point cloud")
+	}
+	if len(res.Points) == 0 {
+		return nil, errors.New("load point cloud: no points found")
+	}
+	return res, nil
+}
+
+// ReadPointCloudXYZ reads an oriented point cloud from a text file where each
+// line contains six numbers: a point and its normal.
+//
+// Blank lines and lines starting with '#' are ignored.
+func ReadPointCloudXYZ(r io.Reader) (*OrientedPointCloud, error) {
+	res := &OrientedPointCloud{}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.ReplaceAll(line, ",", " "))
+		if len(fields) < 6 {
+			return nil, errors.Errorf("read XYZ point cloud: line %d: expected 6 values", lineNum)
+		}
+		var values [6]float64
+		for i := range values {
+			x, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read XYZ point cloud: line %d", lineNum)
+			}
+			values[i] = x
+		}
+		res.Points = append(res.Points, model3d.XYZ(values[0], values[1], values[2]))
+		res.Normals = append(res.Normals, model3d.XYZ(values[3], values[4], values[5]).Normalize())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read XYZ point cloud")
+	}
+	return res, nil
+}
+
+// ReadPointCloudPLY reads the vertices and vertex normals of a PLY file.
+//
+// Faces and other elements are ignored.
+func ReadPointCloudPLY(r io.Reader) (*OrientedPointCloud, error) {
+	reader, err := fileformats.NewPLYReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read PLY point cloud")
+	}
+	res := &OrientedPointCloud{}
+	for {
+		values, elem, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "read PLY point cloud")
+		}
+		if elem.Name != "vertex" {
+			continue
+		}
+		var point, normal model3d.Coord3D
+		var numNormals int
+		for i, prop := range elem.Properties {
+			var dst *float64
+			switch prop.Name {
+			case "x":
+				dst = &point.X
+			case "y":
+				dst = &point.Y
+			case "z":
+				dst = &point.Z
+			case "nx":
+				dst = &normal.X
+			case "ny":
+				dst = &normal.Y
+			case "nz":
+				dst = &normal.Z
+			default:
+				continue
+			}
+			if strings.HasPrefix(prop.Name, "n") {
+				numNormals++
+			}
+			*dst, err = plyFloat(values[i])
+			if err != nil {
+				return nil, errors.Wrap(err, "read PLY point cloud")
+			}
+		}
+		if numNormals != 3 {
+			return nil, errors.New("read PLY point cloud: vertices are missing normals")
+		}
+		res.Points = append(res.Points, point)
+		res.Normals = append(res.Normals, normal.Normalize())
+	}
+	return res, nil
+}
+
+// Min gets the minimum of the bounding box of the points.
+//
+// The point cloud must not be empty.
+func (o *OrientedPointCloud) Min() model3d.Coord3D {
+	res := o.Points[0]
+	for _, p := range o.Points[1:] {
+		res = res.Min(p)
+	}
+	return res
+}
+
+// Max gets the maximum of the bounding box of the points.
+//
+// The point cloud must not be empty.
+func (o *OrientedPointCloud) Max() model3d.Coord3D {
+	res := o.Points[0]
+	for _, p := range o.Points[1:] {
+		res = res.Max(p)
+	}
+	return res
+}
+
+// A PointCloudSolid is a model3d.Solid for the region enclosed by an
+// oriented point cloud.
+//
+// Near the surface, points are classified by their offset from the nearest
+// sample along its normal. Farther away, they are classified using a
+// generalized winding number, where each sample is treated as a small patch
+// of surface whose area is estimated from the distances to its neighbors.
+type PointCloudSolid struct {
+	cloud   *OrientedPointCloud
+	min     model3d.Coord3D
+	max     model3d.Coord3D
+	beta    float64
+	tree    *model3d.CoordTree
+	indices *model3d.CoordMap[int]
+	radii   []float64
+	root    *windingNode
+}
+
+// NewPointCloudSolid creates a PointCloudSolid from a point cloud.
+//
+// The beta argument controls the accuracy of the winding number, as in
+// NewWindingNumberSolid().
+//
+// An error is returned if the point cloud is empty, or if it does not have
+// exactly one normal per point.
+func NewPointCloudSolid(cloud *OrientedPointCloud, beta float64) (*PointCloudSolid, error) {
+	if len(cloud.Points) == 0 {
+		return nil, errors.New("new point cloud solid: point cloud is empty")
+	} else if len(cloud.Normals) != len(cloud.Points) {
+		return nil, errors.New("new point cloud solid: mismatched number of normals")
+	}
+	res := &PointCloudSolid{
+		cloud:   cloud,
+		min:     cloud.Min(),
+		max:     cloud.Max(),
+		beta:    beta,
+		tree:    model3d.NewCoordTree(cloud.Points),
+		indices: model3d.NewCoordMap[int](),
+		radii:   make([]float64, len(cloud.Points)),
+	}
+	for i, p := range cloud.Points {
+		if _, ok := res.indices.Load(p); !ok {
+			res.indices.Store(p, i)
+		}
+	}
+
+	elements := make([]windingElement, len(cloud.Points))
+	k := essentials.MinInt(PointCloudNeighbors, len(cloud.Points)-1)
+	essentials.ConcurrentMap(0, len(cloud.Points), func(i int) {
+		p := cloud.Points[i]
+		var radius float64
+		if k > 0 {
+			// The nearest neighbor is the point itself.
+			neighbors := res.tree.KNN(k+1, p)
+			radius = neighbors[len(neighbors)-1].Dist(p)
+		}
+		res.radii[i] = radius
+		elements[i] = windingDipole{
+			Point:  p,
+			Normal: cloud.Normals[i],
+			Weight: math.Pi * radius * radius / float64(essentials.MaxInt(k, 1)),
+		}
+	})
+	res.root = newWindingNode(elements)
+	return res, nil
+}
+
+// Min gets the minimum of the point cloud's bounding box.
+func (p *PointCloudSolid) Min() model3d.Coord3D {
+	return p.min
+}
+
+// Max gets the maximum of the point cloud's bounding box.
+func (p *PointCloudSolid) Max() model3d.Coord3D {
+	return p.max
+}
+
+// Contains checks if c is inside the surface.
+//
+// Points outside of the bounding box are never contained.
+func (p *PointCloudSolid) Contains(c model3d.Coord3D) bool {
+	if !model3d.InBounds(p, c) {
+		return false
+	}
+	idx := p.nearest(c)
+	point := p.cloud.Points[idx]
+	if point.Dist(c) < p.radii[idx] {
+		return c.Sub(point).Dot(p.cloud.Normals[idx]) < 0
+	}
+	return p.WindingNumber(c) >= 0.5
+}
+
+// WindingNumber computes the (approximate) generalized winding number of the
+// point cloud at c.
+//
+// This is inaccurate very close to the samples, where Contains() uses the
+// nearest normal instead.
+func (p *PointCloudSolid) WindingNumber(c model3d.Coord3D) float64 {
+	return p.root.SolidAngle(c, p.beta) / (4 * math.Pi)
+}
+
+// Normal gets the normal of the sample nearest to c.
+func (p *PointCloudSolid) Normal(c model3d.Coord3D) model3d.Coord3D {
+	return p.cloud.Normals[p.nearest(c)]
+}
+
+func (p *PointCloudSolid) nearest(c model3d.Coord3D) int {
+	return p.indices.Value(p.tree.NearestNeighbor(c))
+}
@@ -0,0 +1,85 @@
+package treed
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestPointCloudSolid(t *testing.T) {
+	mesh := model3d.NewMeshIcosphere(model3d.Origin, 1.0, 8).Scale(0.5)
+	mesh.AddMesh(model3d.NewMeshRect(model3d.XYZ(0.7, -0.2, -0.2), model3d.XYZ(1, 0.2, 0.2)))
+	collider := model3d.NewColliderSolid(model3d.MeshToCollider(mesh))
+	sdf := model3d.MeshToSDF(mesh)
+	sampler := MeshPointSampler(mesh)
+
+	cloud := &OrientedPointCloud{}
+	for i := 0; i < 20000; i++ {
+		p := sampler()
+		normal, _ := sdf.NormalSDF(p)
+		cloud.Points = append(cloud.Points, p)
+		cloud.Normals = append(cloud.Normals, normal)
+	}
+	solid, err := NewPointCloudSolid(cloud, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var numErrors, numChecked int
+	for i := 0; i < 2000; i++ {
+		c := model3d.NewCoord3DRandBounds(solid.Min(), solid.Max())
+		if math.Abs(sdf.SDF(c)) < 0.02 {
+			continue
+		}
+		numChecked++
+		if solid.Contains(c) != collider.Contains(c) {
+			numErrors++
+		}
+	}
+	if frac := float64(numErrors) / float64(numChecked); frac > 0.005 {
+		t.Errorf("too many errors: %d/%d", numErrors, numChecked)
+	}
+
+	for i := 0; i < 100; i++ {
+		c := model3d.NewCoord3DRandNorm().Normalize().Scale(0.5)
+		if n := solid.Normal(c); n.Dot(c.Normalize()) < 0.9 && c.X < 0.1 {
+			t.Errorf("unexpected normal %v at %v", n, c)
+		}
+	}
+}
+
+func TestReadPointCloudXYZ(t *testing.T) {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# comment")
+	fmt.Fprintln(&buf, "1 2 3 0 0 2")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "4,5,6,3,0,0")
+	cloud, err := ReadPointCloudXYZ(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPoints := []model3d.Coord3D{model3d.XYZ(1, 2, 3), model3d.XYZ(4, 5, 6)}
+	expectedNormals := []model3d.Coord3D{model3d.Z(1), model3d.X(1)}
+	if len(cloud.Points) != 2 {
+		t.Fatalf("expected 2 points but got %d", len(cloud.Points))
+	}
+	for i, p := range cloud.Points {
+		if p != expectedPoints[i] || cloud.Normals[i] != expectedNormals[i] {
+			t.Errorf("point %d: expected %v, %v but got %v, %v", i, expectedPoints[i],
+				expectedNormals[i], p, cloud.Normals[i])
+		}
+	}
+}
+
+func TestPointCloudSolidEmpty(t *testing.T) {
+	if _, err := NewPointCloudSolid(&OrientedPointCloud{}, 2); err == nil {
+		t.Error("expected error for empty point cloud")
+	}
+	cloud := &OrientedPointCloud{Points: []model3d.Coord3D{model3d.X(1)}}
+	if _, err := NewPointCloudSolid(cloud, 2); err == nil {
+		t.Error("expected error for missing normals")
+	}
+}
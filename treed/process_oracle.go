@@ -0,0 +1,294 @@
+package treed
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// A ProcessOracle is a model3d.Solid which labels points by querying one or
+// more external processes.
+//
+// Each process communicates over stdin and stdout using a binary protocol,
+// where all numbers are little-endian:
+//
+//  1. On startup, the process writes its bounding box to stdout as six
+//     float64 values: min x, min y, min z, max x, max y, max z.
+//  2. The oracle then repeatedly writes a query to the process's stdin,
+//     consisting of a uint32 count N followed by N points, each encoded as
+//     three float64 values (x, y, z).
+//  3. For each query, the process writes N bytes to stdout, where each byte
+//     is 1 if the corresponding point is inside and 0 otherwise.
+//  4. When the oracle is closed, stdin is closed and the process should exit.
+//
+// Concurrent calls to Contains() are gathered into batches, so that many
+// points can be labeled with a single query. However, each call to Contains()
+// only provides one point, so these batches are limited by the number of
+// concurrent callers (typically GOMAXPROCS). Use ContainsBatch() to label
+// large datasets with full batches.
+//
+// Since model3d.Solid cannot report errors, Contains() panics if a process
+// fails. Use ContainsBatch() to handle errors.
+type ProcessOracle struct {
+	min model3d.Coord3D
+	max model3d.Coord3D
+
+	batchSize int
+	requests  chan *processRequest
+	processes []*exec.Cmd
+	workers   sync.WaitGroup
+
+	errLock sync.Mutex
+	err     error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type processRequest struct {
+	Coords []model3d.Coord3D
+	Labels []bool
+	Done   chan error
+}
+
+// NewProcessOracle starts numProcesses copies of a command and waits for each
+// of them to report its bounds.
+//
+// Queries sent to a process contain at most batchSize points.
+func NewProcessOracle(command []string, numProcesses, batchSize int) (*ProcessOracle, error) {
+	if len(command) == 0 {
+		return nil, errors.New("new process oracle: empty command")
+	} else if numProcesses < 1 {
+		return nil, errors.New("new process oracle: number of processes must be positive")
+	} else if batchSize < 1 {
+		return nil, errors.New("new process oracle: batch size must be positive")
+	}
+	res := &ProcessOracle{
+		batchSize: batchSize,
+		requests:  make(chan *processRequest, numProcesses*batchSize),
+	}
+	for i := 0; i < numProcesses; i++ {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			res.Close()
+			return nil, errors.Wrap(err, "new process oracle")
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			res.Close()
+			return nil, errors.Wrap(err, "new process oracle")
+		}
+		if err := cmd.Start(); err != nil {
+			res.Close()
+			return nil, errors.Wrap(err, "new process oracle")
+		}
+		res.processes = append(res.processes, cmd)
+
+		reader := bufio.NewReader(stdout)
+		var bounds [6]float64
+		if err := binary.Read(reader, binary.LittleEndian, &bounds); err != nil {
+			stdin.Close()
+			res.Close()
+			return nil, errors.Wrap(err, "new process oracle: read bounds")
+		}
+		min := model3d.XYZ(bounds[0], bounds[1], bounds[2])
+		max := model3d.XYZ(bounds[3], bounds[4], bounds[5])
+		if i == 0 {
+			res.min, res.max = min, max
+		} else if min != res.min || max != res.max {
+			stdin.Close()
+			res.Close()
+			return nil, errors.New("new process oracle: processes reported different bounds")
+		}
+
+		res.workers.Add(1)
+		go func() {
+			defer res.workers.Done()
+			defer stdin.Close()
+			res.worker(stdin, reader)
+		}()
+	}
+	if res.min.X > res.max.X || res.min.Y > res.max.Y || res.min.Z > res.max.Z {
+		res.Close()
+		return nil, errors.New("new process oracle: invalid bounds")
+	}
+	return res, nil
+}
+
+// Min gets the minimum of the bounds reported by the process.
+func (p *ProcessOracle) Min() model3d.Coord3D {
+	return p.min
+}
+
+// Max gets the maximum of the bounds reported by the process.
+func (p *ProcessOracle) Max() model3d.Coord3D {
+	return p.max
+}
+
+// Contains queries the label of a single point.
+//
+// Points outside of the bounds are never contained.
+func (p *ProcessOracle) Contains(c model3d.Coord3D) bool {
+	if !model3d.InBounds(p, c) {
+		return false
+	}
+	labels, err := p.ContainsBatch([]model3d.Coord3D{c})
+	if err != nil {
+		panic(err)
+	}
+	return labels[0]
+}
+
+// ContainsBatch queries the labels of many points at once.
+//
+// Unlike Contains(), points are not checked against the bounds.
+func (p *ProcessOracle) ContainsBatch(coords []model3d.Coord3D) ([]bool, error) {
+	labels := make([]bool, len(coords))
+	var requests []*processRequest
+	for i := 0; i < len(coords); i += p.batchSize {
+		end := i + p.batchSize
+		if end > len(coords) {
+			end = len(coords)
+		}
+		req := &processRequest{
+			Coords: coords[i:end],
+			Labels: labels[i:end],
+			Done:   make(chan error, 1),
+		}
+		requests = append(requests, req)
+		p.requests <- req
+	}
+	for _, req := range requests {
+		if err := <-req.Done; err != nil {
+			return nil, errors.Wrap(err, "query process oracle")
+		}
+	}
+	return labels, nil
+}
+
+// Close stops all of the processes and waits for them to exit.
+//
+// No other methods should be called after Close().
+func (p *ProcessOracle) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.requests)
+		p.workers.Wait()
+		for _, cmd := range p.processes {
+			if err := cmd.Wait(); err != nil && p.closeErr == nil {
+				p.closeErr = errors.Wrap(err, "close process oracle")
+			}
+		}
+	})
+	return p.closeErr
+}
+
+func (p *ProcessOracle) worker(w io.Writer, r io.Reader) {
+	bw := bufio.NewWriter(w)
+
+	// A request which did not fit in the previous batch.
+	var pending *processRequest
+
+	for {
+		req := pending
+		pending = nil
+		if req == nil {
+			var ok bool
+			req, ok = <-p.requests
+			if !ok {
+				return
+			}
+		}
+		batch := []*processRequest{req}
+		size := len(req.Coords)
+	GatherLoop:
+		for size < p.batchSize {
+			select {
+			case req, ok := <-p.requests:
+				if !ok {
+					break GatherLoop
+				}
+				if size+len(req.Coords) > p.batchSize {
+					pending = req
+					break GatherLoop
+				}
+				batch = append(batch, req)
+				size += len(req.Coords)
+			default:
+				break GatherLoop
+			}
+		}
+
+		err := p.failure()
+		if err == nil {
+			err = p.query(bw, r, batch, size)
+			if err != nil {
+				p.fail(err)
+			}
+		}
+		for _, req := range batch {
+			req.Done <- err
+		}
+	}
+}
+
+func (p *ProcessOracle) query(w *bufio.Writer, r io.Reader, batch []*processRequest, size int) error {
+	buf := make([]byte, 4+size*24)
+	binary.LittleEndian.PutUint32(buf, uint32(size))
+	offset := 4
+	for _, req := range batch {
+		for _, c := range req.Coords {
+			for _, x := range c.Array() {
+				binary.LittleEndian.PutUint64(buf[offset:], math.Float64bits(x))
+				offset += 8
+			}
+		}
+	}
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	results := make([]byte, size)
+	if _, err := io.ReadFull(r, results); err != nil {
+		return err
+	}
+	offset = 0
+	for _, req := range batch {
+		for i := range req.Labels {
+			switch results[offset] {
+			case 0:
+				req.Labels[i] = false
+			case 1:
+				req.Labels[i] = true
+			default:
+				return errors.Errorf("unexpected label byte: %d", results[offset])
+			}
+			offset++
+		}
+	}
+	return nil
+}
+
+func (p *ProcessOracle) failure() error {
+	p.errLock.Lock()
+	defer p.errLock.Unlock()
+	return p.err
+}
+
+func (p *ProcessOracle) fail(err error) {
+	p.errLock.Lock()
+	defer p.errLock.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
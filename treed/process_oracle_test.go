@@ -0,0 +1,189 @@
+package treed
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestProcessOracle(t *testing.T) {
+	t.Setenv("TREED_TEST_PROCESS_ORACLE", "1")
+	command := []string{os.Args[0], "-test.run=TestProcessOracleHelper"}
+	oracle, err := NewProcessOracle(command, 2, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oracle.Close()
+
+	sphere := &model3d.Sphere{Radius: 0.8}
+	if oracle.Min() != model3d.XYZ(-1, -1, -1) || oracle.Max() != model3d.XYZ(1, 1, 1) {
+		t.Errorf("unexpected bounds: %v, %v", oracle.Min(), oracle.Max())
+	}
+
+	coords := make([]model3d.Coord3D, 1000)
+	for i := range coords {
+		coords[i] = model3d.NewCoord3DRandBounds(oracle.Min(), oracle.Max())
+	}
+	labels, err := oracle.ContainsBatch(coords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range coords {
+		if labels[i] != sphere.Contains(c) {
+			t.Errorf("unexpected batch label for %v", c)
+		}
+	}
+
+	var lock sync.Mutex
+	var numErrors int
+	essentials.ConcurrentMap(8, len(coords), func(i int) {
+		if oracle.Contains(coords[i]) != sphere.Contains(coords[i]) {
+			lock.Lock()
+			numErrors++
+			lock.Unlock()
+		}
+	})
+	if numErrors > 0 {
+		t.Errorf("got %d incorrect concurrent labels", numErrors)
+	}
+	if oracle.Contains(model3d.XYZ(2, 0, 0)) {
+		t.Error("points outside of the bounds should not be contained")
+	}
+
+	if err := oracle.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessOracleBatchSize(t *testing.T) {
+	logDir := t.TempDir()
+	t.Setenv("TREED_TEST_PROCESS_ORACLE", "1")
+	t.Setenv("TREED_TEST_PROCESS_ORACLE_LOG", logDir)
+	command := []string{os.Args[0], "-test.run=TestProcessOracleHelper"}
+	oracle, err := NewProcessOracle(command, 2, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oracle.Close()
+
+	// Concurrent requests of 10 points can only be combined by exceeding
+	// the batch size.
+	essentials.ConcurrentMap(8, 200, func(i int) {
+		coords := make([]model3d.Coord3D, 10)
+		for j := range coords {
+			coords[j] = model3d.NewCoord3DRandBounds(oracle.Min(), oracle.Max())
+		}
+		if _, err := oracle.ContainsBatch(coords); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := oracle.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 logs but got %d", len(entries))
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(logDir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if maxCount, err := strconv.Atoi(string(data)); err != nil {
+			t.Fatal(err)
+		} else if maxCount > 16 {
+			t.Errorf("process received a query of %d points", maxCount)
+		}
+	}
+}
+
+func TestProcessOracleFailure(t *testing.T) {
+	t.Setenv("TREED_TEST_PROCESS_ORACLE", "fail")
+	command := []string{os.Args[0], "-test.run=TestProcessOracleHelper"}
+	oracle, err := NewProcessOracle(command, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oracle.Close()
+	if _, err := oracle.ContainsBatch([]model3d.Coord3D{{}}); err == nil {
+		t.Error("expected an error from a failed process")
+	}
+	if _, err := oracle.ContainsBatch([]model3d.Coord3D{{}}); err == nil {
+		t.Error("expected an error after a process has failed")
+	}
+}
+
+func TestProcessOracleInvalidArgs(t *testing.T) {
+	command := []string{os.Args[0], "-test.run=TestProcessOracleHelper"}
+	for _, args := range [][2]int{{0, 16}, {-1, 16}, {1, 0}, {1, -1}} {
+		if _, err := NewProcessOracle(command, args[0], args[1]); err == nil {
+			t.Errorf("expected error for %d processes and batch size %d", args[0], args[1])
+		}
+	}
+}
+
+// TestProcessOracleHelper is run as a subprocess by the tests above, and
+// implements an oracle for a sphere of radius 0.8.
+//
+// If TREED_TEST_PROCESS_ORACLE_LOG is set, the process writes the size of the
+// largest query it received to a file in that directory before exiting.
+func TestProcessOracleHelper(t *testing.T) {
+	mode := os.Getenv("TREED_TEST_PROCESS_ORACLE")
+	if mode == "" {
+		t.Skip("only run as a subprocess")
+	}
+	defer os.Exit(0)
+
+	w := bufio.NewWriter(os.Stdout)
+	binary.Write(w, binary.LittleEndian, []float64{-1, -1, -1, 1, 1, 1})
+	w.Flush()
+	if mode == "fail" {
+		return
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	var maxCount uint32
+	for {
+		var count uint32
+		if err := binary.Read(r, binary.LittleEndian, &count); err == io.EOF {
+			if logDir := os.Getenv("TREED_TEST_PROCESS_ORACLE_LOG"); logDir != "" {
+				path := filepath.Join(logDir, strconv.Itoa(os.Getpid()))
+				if err := os.WriteFile(path, []byte(strconv.Itoa(int(maxCount))), 0644); err != nil {
+					panic(err)
+				}
+			}
+			return
+		} else if err != nil {
+			panic(err)
+		}
+		if count > maxCount {
+			maxCount = count
+		}
+		coords := make([]float64, count*3)
+		if err := binary.Read(r, binary.LittleEndian, coords); err != nil {
+			panic(err)
+		}
+		labels := make([]byte, count)
+		for i := range labels {
+			x, y, z := coords[i*3], coords[i*3+1], coords[i*3+2]
+			if math.Sqrt(x*x+y*y+z*z) < 0.8 {
+				labels[i] = 1
+			}
+		}
+		w.Write(labels)
+		w.Flush()
+	}
+}
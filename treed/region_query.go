@@ -0,0 +1,198 @@
+package treed
+
+import (
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/model3d/render3d"
+	"golang.org/x/exp/constraints"
+)
+
+// A RegionQuery is a region of space which can be tested against the
+// half-spaces and polytopes of a tree, for example to find the leaves that
+// overlap some part of space.
+type RegionQuery[F constraints.Float, C Coord[F, C]] interface {
+	// TouchesHalfSpace returns false if no point c in the region satisfies
+	// c.Dot(axis) <= max. It may conservatively return true.
+	TouchesHalfSpace(axis C, max F) bool
+
+	// TouchesPolytope returns true if the region intersects the closed
+	// polytope p.
+	TouchesPolytope(p Polytope[F, C]) bool
+}
+
+// QueryLeaves enumerates the leaves of the tree which intersect the region
+// described by q.
+//
+// The bounds polytope constrains the space of the tree, and may be empty for
+// an unbounded tree. For each leaf, f is called with the leaf and its
+// polytope, which is clipped to the bounds. If f returns false, iteration is
+// terminated early.
+//
+// Branches of the tree are pruned using the half-spaces of their ancestors,
+// and the final leaf polytopes are tested exactly against the region.
+func (t *Tree[F, C, T]) QueryLeaves(
+	bounds Polytope[F, C],
+	q RegionQuery[F, C],
+	f func(leaf *Tree[F, C, T], region Polytope[F, C]) bool,
+) {
+	t.queryLeaves(append(Polytope[F, C]{}, bounds...), q, f)
+}
+
+func (t *Tree[F, C, T]) queryLeaves(
+	region Polytope[F, C],
+	q RegionQuery[F, C],
+	f func(leaf *Tree[F, C, T], region Polytope[F, C]) bool,
+) bool {
+	if t.IsLeaf() {
+		if q.TouchesPolytope(region) {
+			return f(t, append(Polytope[F, C]{}, region...))
+		}
+		return true
+	}
+	constraints := [2]Inequality[F, C]{
+		{Axis: t.Axis, Max: t.Threshold},
+		{Axis: t.Axis.Scale(-1), Max: -t.Threshold},
+	}
+	for i, child := range [2]*Tree[F, C, T]{t.LessThan, t.GreaterEqual} {
+		ineq := constraints[i]
+		if !q.TouchesHalfSpace(ineq.Axis, ineq.Max) {
+			continue
+		}
+		if !child.queryLeaves(append(region, ineq), q, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// BoundsPolytope creates a polytope for the bounds of the tree.
+//
+// Requires that you pass every axis for the coordinate space, as for AsTree().
+func (b *BoundedTree[F, C, T]) BoundsPolytope(axes ...C) Polytope[F, C] {
+	var res Polytope[F, C]
+	for _, axis := range axes {
+		res = append(
+			res,
+			Inequality[F, C]{Axis: axis, Max: axis.Dot(b.Max)},
+			Inequality[F, C]{Axis: axis.Scale(-1), Max: -axis.Dot(b.Min)},
+		)
+	}
+	return res
+}
+
+// QueryLeaves is like Tree.QueryLeaves, but uses the bounds of b.
+//
+// Requires that you pass every axis for the coordinate space, as for AsTree().
+func (b *BoundedTree[F, C, T]) QueryLeaves(
+	q RegionQuery[F, C],
+	f func(leaf *Tree[F, C, T], region Polytope[F, C]) bool,
+	axes ...C,
+) {
+	b.Tree.QueryLeaves(b.BoundsPolytope(axes...), q, f)
+}
+
+// RectQuery is a RegionQuery for an axis-aligned box.
+type RectQuery struct {
+	Min model3d.Coord3D
+	Max model3d.Coord3D
+}
+
+func (r *RectQuery) TouchesHalfSpace(axis model3d.Coord3D, max float64) bool {
+	return axis.Mul(r.Min).Min(axis.Mul(r.Max)).Sum() <= max
+}
+
+func (r *RectQuery) TouchesPolytope(p Polytope[float64, model3d.Coord3D]) bool {
+	constraints := ConvexPolytope(p)
+	return PolytopeNonEmpty(append(constraints, model3d.NewConvexPolytopeRect(r.Min, r.Max)...))
+}
+
+// SphereQuery is a RegionQuery for a solid sphere.
+type SphereQuery struct {
+	Center model3d.Coord3D
+	Radius float64
+}
+
+func (s *SphereQuery) TouchesHalfSpace(axis model3d.Coord3D, max float64) bool {
+	return axis.Dot(s.Center)-max <= s.Radius*axis.Norm()
+}
+
+func (s *SphereQuery) TouchesPolytope(p Polytope[float64, model3d.Coord3D]) bool {
+	_, dist, ok := PolytopeClosestPoint(ConvexPolytope(p), s.Center)
+	return ok && dist <= s.Radius
+}
+
+// PolytopeQuery is a RegionQuery for a convex polytope.
+type PolytopeQuery Polytope[float64, model3d.Coord3D]
+
+// NewFrustumQuery creates a PolytopeQuery for the viewing frustum of a camera
+// rendering an image of the given dimensions, between a near and far distance
+// along the viewing direction.
+func NewFrustumQuery(
+	camera *render3d.Camera,
+	imageWidth, imageHeight float64,
+	near, far float64,
+) PolytopeQuery {
+	caster := camera.Caster(imageWidth, imageHeight)
+	corners := []model3d.Coord3D{
+		caster(0, 0),
+		caster(imageWidth, 0),
+		caster(imageWidth, imageHeight),
+		caster(0, imageHeight),
+	}
+	forward := caster(imageWidth/2, imageHeight/2).Normalize()
+
+	var res PolytopeQuery
+	for i, corner := range corners {
+		normal := corner.Cross(corners[(i+1)%len(corners)]).Normalize()
+		if normal.Dot(forward) > 0 {
+			normal = normal.Scale(-1)
+		}
+		res = append(res, Inequality[float64, model3d.Coord3D]{
+			Axis: normal,
+			Max:  normal.Dot(camera.Origin),
+		})
+	}
+	res = append(
+		res,
+		Inequality[float64, model3d.Coord3D]{
+			Axis: forward.Scale(-1),
+			Max:  -(forward.Dot(camera.Origin) + near),
+		},
+		Inequality[float64, model3d.Coord3D]{
+			Axis: forward,
+			Max:  forward.Dot(camera.Origin) + far,
+		},
+	)
+	return res
+}
+
+func (p PolytopeQuery) TouchesHalfSpace(axis model3d.Coord3D, max float64) bool {
+	return p.TouchesPolytope(Polytope[float64, model3d.Coord3D]{{Axis: axis, Max: max}})
+}
+
+func (p PolytopeQuery) TouchesPolytope(other Polytope[float64, model3d.Coord3D]) bool {
+	constraints := ConvexPolytope(Polytope[float64, model3d.Coord3D](p))
+	return PolytopeNonEmpty(append(constraints, ConvexPolytope(other)...))
+}
+
+// UnionQuery is a RegionQuery for the union of other regions.
+//
+// An empty UnionQuery does not touch any part of space.
+type UnionQuery[F constraints.Float, C Coord[F, C]] []RegionQuery[F, C]
+
+func (u UnionQuery[F, C]) TouchesHalfSpace(axis C, max F) bool {
+	for _, q := range u {
+		if q.TouchesHalfSpace(axis, max) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u UnionQuery[F, C]) TouchesPolytope(p Polytope[F, C]) bool {
+	for _, q := range u {
+		if q.TouchesPolytope(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package treed
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+	"github.com/unixpickle/model3d/render3d"
+)
+
+func TestQueryLeavesRect(t *testing.T) {
+	bounded := testTree()
+	allRegions := queryLeafRegions(bounded, &RectQuery{Min: bounded.Min, Max: bounded.Max})
+	if len(allRegions) != bounded.Tree.NumLeaves() {
+		t.Fatalf("expected %d leaves but got %d", bounded.Tree.NumLeaves(), len(allRegions))
+	}
+
+	for i := 0; i < 50; i++ {
+		center := model3d.NewCoord3DRandNorm()
+		size := model3d.NewCoord3DRandUniform().Scale(0.5)
+		query := &RectQuery{Min: center.Sub(size), Max: center.Add(size)}
+		actual := queryLeafRegions(bounded, query)
+		for leaf, region := range allRegions {
+			rect := model3d.NewConvexPolytopeRect(query.Min, query.Max)
+			expected := PolytopeNonEmpty(append(ConvexPolytope(region), rect...))
+			if _, ok := actual[leaf]; ok != expected {
+				t.Fatalf("leaf with region %v should have result %v", region, expected)
+			}
+		}
+	}
+}
+
+func TestQueryLeavesSphere(t *testing.T) {
+	bounded := testTree()
+	for i := 0; i < 50; i++ {
+		query := &SphereQuery{Center: model3d.NewCoord3DRandNorm(), Radius: rand.Float64()}
+		actual := queryLeafRegions(bounded, query)
+		for j := 0; j < 1000; j++ {
+			point := query.Center.Add(model3d.NewCoord3DRandUnit().Scale(query.Radius * rand.Float64()))
+			if point.Min(bounded.Min) != bounded.Min || point.Max(bounded.Max) != bounded.Max {
+				// Skip points outside the bounds.
+				continue
+			}
+			leaf := bounded.Tree.FindLeaf(point)
+			if _, ok := actual[leaf]; !ok {
+				t.Fatalf("missing leaf for point %v", point)
+			}
+		}
+	}
+}
+
+func TestNewFrustumQuery(t *testing.T) {
+	camera := render3d.NewCameraAt(model3d.XYZ(0, -3, 0), model3d.Origin, 0)
+	query := NewFrustumQuery(camera, 100, 50, 0.5, 10)
+	caster := camera.Caster(100, 50)
+	for i := 0; i < 1000; i++ {
+		x, y := rand.Float64()*100, rand.Float64()*50
+		dir := caster(x, y)
+		dist := rand.Float64()*20 - 5
+		point := camera.Origin.Add(dir.Scale(dist))
+		forwardDist := dist * dir.Dot(caster(50, 25).Normalize())
+		contains := ConvexPolytope(Polytope[float64, model3d.Coord3D](query)).Contains(point)
+		expected := forwardDist >= 0.5 && forwardDist <= 10
+		if contains != expected {
+			t.Fatalf("point at distance %f should have containment %v", forwardDist, expected)
+		}
+	}
+}
+
+func queryLeafRegions(
+	b *BoundedSolidTree,
+	q RegionQuery[float64, model3d.Coord3D],
+) map[*SolidTree]Polytope[float64, model3d.Coord3D] {
+	res := map[*SolidTree]Polytope[float64, model3d.Coord3D]{}
+	b.QueryLeaves(
+		q,
+		func(leaf *SolidTree, region Polytope[float64, model3d.Coord3D]) bool {
+			res[leaf] = region
+			return true
+		},
+		model3d.X(1), model3d.Y(1), model3d.Z(1),
+	)
+	return res
+}
@@ -0,0 +1,60 @@
+package treed
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// RenderCost summarizes the cost of casting rays through a tree.
+type RenderCost struct {
+	// Mean values of the corresponding RayStats fields.
+	BranchChanges float64
+	LeavesCrossed float64
+	NodesTested   float64
+}
+
+// EstimateRenderCost measures the average cost of finding the first
+// collision of random rays with a tree, as a renderer would.
+//
+// Rays start on a sphere around the bounds and point towards random points
+// within the bounds.
+//
+// This can be used to compare the render cost of trees with equal accuracy,
+// for example trees built with different TraversalSplitLoss weights.
+func EstimateRenderCost(b *BoundedSolidTree, numRays int) *RenderCost {
+	var lock sync.Mutex
+	var total RayStats
+	collider := NewCollider(b, RecordRayStats(func(_ *model3d.Ray, stats *RayStats) {
+		lock.Lock()
+		defer lock.Unlock()
+		total.BranchChanges += stats.BranchChanges
+		total.LeavesCrossed += stats.LeavesCrossed
+		total.NodesTested += stats.NodesTested
+	}))
+
+	center := b.Min.Mid(b.Max)
+	radius := b.Min.Dist(b.Max)
+	essentials.StatefulConcurrentMap(0, numRays, func() func(int) {
+		gen := rand.New(rand.NewSource(rand.Int63()))
+		return func(int) {
+			origin := model3d.XYZ(gen.NormFloat64(), gen.NormFloat64(), gen.NormFloat64())
+			origin = center.Add(origin.Normalize().Scale(radius))
+			target := model3d.XYZ(gen.Float64(), gen.Float64(), gen.Float64())
+			target = target.Mul(b.Max.Sub(b.Min)).Add(b.Min)
+			collider.FirstRayCollision(&model3d.Ray{
+				Origin:    origin,
+				Direction: target.Sub(origin).Normalize(),
+			})
+		}
+	})
+
+	n := float64(numRays)
+	return &RenderCost{
+		BranchChanges: float64(total.BranchChanges) / n,
+		LeavesCrossed: float64(total.LeavesCrossed) / n,
+		NodesTested:   float64(total.NodesTested) / n,
+	}
+}
@@ -0,0 +1,243 @@
+package treed
+
+import (
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// Restructure rearranges the branches of a bounded tree to reduce the
+// expected depth of predictions, without changing the function that the tree
+// computes.
+//
+// The samples should be uniformly distributed within the bounds, and are
+// used to estimate the volume of each leaf. The resulting tree minimizes the
+// volume-weighted depth of its leaves by greedily applying local rotations,
+// which bring a grandchild up one level and push a child down one level.
+//
+// Every rotation is checked for equivalence by proving that a region of the
+// polytope is empty, first using the samples and then using
+// PolytopeNonEmpty(). Branches with an empty side are also pruned, and
+// branches whose children are identical leaves are merged.
+func Restructure[T comparable](
+	b *BoundedTree[float64, model3d.Coord3D, T],
+	samples []model3d.Coord3D,
+) *BoundedTree[float64, model3d.Coord3D, T] {
+	r := restructurer[T]{}
+	bounds := model3d.NewConvexPolytopeRect(b.Min, b.Max)
+	return &BoundedTree[float64, model3d.Coord3D, T]{
+		Min:  b.Min,
+		Max:  b.Max,
+		Tree: r.Restructure(b.Tree, bounds, samples),
+	}
+}
+
+// MeanDepth computes the average depth of the leaves reached by the coords.
+//
+// For uniformly distributed coordinates, this is the volume-weighted depth of
+// the leaves of the tree.
+func (t *Tree[F, C, T]) MeanDepth(coords []C) float64 {
+	var total int
+	for _, c := range coords {
+		node := t
+		for !node.IsLeaf() {
+			total++
+			if node.Axis.Dot(c) < node.Threshold {
+				node = node.LessThan
+			} else {
+				node = node.GreaterEqual
+			}
+		}
+	}
+	return float64(total) / float64(len(coords))
+}
+
+type restructurer[T comparable] struct{}
+
+// Restructure optimizes a subtree bottom-up, given the samples that reach
+// the subtree and the polytope containing it.
+func (r restructurer[T]) Restructure(
+	t *Tree[float64, model3d.Coord3D, T],
+	region model3d.ConvexPolytope,
+	samples []model3d.Coord3D,
+) *Tree[float64, model3d.Coord3D, T] {
+	if t.IsLeaf() {
+		return t
+	}
+	lt, ge := r.partition(t, samples)
+	t = &Tree[float64, model3d.Coord3D, T]{
+		Axis:         t.Axis,
+		Threshold:    t.Threshold,
+		LessThan:     r.Restructure(t.LessThan, r.side(region, t, false), lt),
+		GreaterEqual: r.Restructure(t.GreaterEqual, r.side(region, t, true), ge),
+	}
+	return r.optimize(t, region, samples)
+}
+
+// optimize applies pruning, merging, and rotations to the root of a subtree
+// whose children have already been optimized.
+func (r restructurer[T]) optimize(
+	t *Tree[float64, model3d.Coord3D, T],
+	region model3d.ConvexPolytope,
+	samples []model3d.Coord3D,
+) *Tree[float64, model3d.Coord3D, T] {
+	for {
+		if t.IsLeaf() {
+			return t
+		}
+		lt, ge := r.partition(t, samples)
+		if len(lt) == 0 && !PolytopeNonEmpty(r.side(region, t, false)) {
+			return t.GreaterEqual
+		} else if len(ge) == 0 && !PolytopeNonEmpty(r.side(region, t, true)) {
+			return t.LessThan
+		}
+		if t.LessThan.IsLeaf() && t.GreaterEqual.IsLeaf() &&
+			t.LessThan.Leaf == t.GreaterEqual.Leaf {
+			return t.LessThan
+		}
+
+		// Find the rotation with the largest reduction in total depth.
+		var bestGain int
+		var bestChildGE, bestGrandchildGE bool
+		for _, childGE := range []bool{false, true} {
+			child := r.child(t, childGE)
+			if child.IsLeaf() {
+				continue
+			}
+			childSamples, otherSamples := lt, ge
+			if childGE {
+				childSamples, otherSamples = ge, lt
+			}
+			for _, grandchildGE := range []bool{false, true} {
+				// The promoted grandchild moves up one level, and the
+				// other child of t moves down one level.
+				var gain int
+				for _, c := range childSamples {
+					if (child.Axis.Dot(c) >= child.Threshold) == grandchildGE {
+						gain++
+					}
+				}
+				gain -= len(otherSamples)
+				if gain <= bestGain {
+					continue
+				}
+				if r.canRotate(t, region, childGE, grandchildGE, otherSamples) {
+					bestGain = gain
+					bestChildGE = childGE
+					bestGrandchildGE = grandchildGE
+				}
+			}
+		}
+		if bestGain == 0 {
+			return t
+		}
+		t = r.rotate(t, region, samples, bestChildGE, bestGrandchildGE)
+	}
+}
+
+// canRotate checks if the other child of t (opposite childGE) lies entirely
+// on the opposite side of the child's split from the promoted grandchild.
+func (r restructurer[T]) canRotate(
+	t *Tree[float64, model3d.Coord3D, T],
+	region model3d.ConvexPolytope,
+	childGE, grandchildGE bool,
+	otherSamples []model3d.Coord3D,
+) bool {
+	child := r.child(t, childGE)
+	for _, c := range otherSamples {
+		if (child.Axis.Dot(c) >= child.Threshold) == grandchildGE {
+			return false
+		}
+	}
+	return !PolytopeNonEmpty(r.side(r.side(region, t, !childGE), child, grandchildGE))
+}
+
+// rotate moves the child of t up to the root of the subtree, such that the
+// promoted grandchild is a direct child of the new root.
+func (r restructurer[T]) rotate(
+	t *Tree[float64, model3d.Coord3D, T],
+	region model3d.ConvexPolytope,
+	samples []model3d.Coord3D,
+	childGE, grandchildGE bool,
+) *Tree[float64, model3d.Coord3D, T] {
+	child := r.child(t, childGE)
+	newBranch := &Tree[float64, model3d.Coord3D, T]{
+		Axis:      t.Axis,
+		Threshold: t.Threshold,
+	}
+	r.setChild(newBranch, childGE, r.child(child, !grandchildGE))
+	r.setChild(newBranch, !childGE, r.child(t, !childGE))
+
+	// The new branch is on the opposite side of the child's split from
+	// the promoted grandchild, and may itself be optimized further.
+	lt, ge := r.partition(child, samples)
+	branchSamples := lt
+	if !grandchildGE {
+		branchSamples = ge
+	}
+	branchRegion := r.side(region, child, !grandchildGE)
+
+	res := &Tree[float64, model3d.Coord3D, T]{
+		Axis:      child.Axis,
+		Threshold: child.Threshold,
+	}
+	r.setChild(res, grandchildGE, r.child(child, grandchildGE))
+	r.setChild(res, !grandchildGE, r.optimize(newBranch, branchRegion, branchSamples))
+	return res
+}
+
+func (r restructurer[T]) partition(
+	t *Tree[float64, model3d.Coord3D, T],
+	samples []model3d.Coord3D,
+) (lt, ge []model3d.Coord3D) {
+	for _, c := range samples {
+		if t.Axis.Dot(c) < t.Threshold {
+			lt = append(lt, c)
+		} else {
+			ge = append(ge, c)
+		}
+	}
+	return
+}
+
+// side creates a new polytope by restricting a region to one side of a
+// branch.
+func (r restructurer[T]) side(
+	region model3d.ConvexPolytope,
+	t *Tree[float64, model3d.Coord3D, T],
+	ge bool,
+) model3d.ConvexPolytope {
+	res := make(model3d.ConvexPolytope, len(region), len(region)+1)
+	copy(res, region)
+	if ge {
+		return append(res, &model3d.LinearConstraint{
+			Normal: t.Axis.Scale(-1),
+			Max:    -t.Threshold,
+		})
+	} else {
+		return append(res, &model3d.LinearConstraint{
+			Normal: t.Axis,
+			Max:    t.Threshold,
+		})
+	}
+}
+
+func (r restructurer[T]) child(
+	t *Tree[float64, model3d.Coord3D, T],
+	ge bool,
+) *Tree[float64, model3d.Coord3D, T] {
+	if ge {
+		return t.GreaterEqual
+	}
+	return t.LessThan
+}
+
+func (r restructurer[T]) setChild(
+	t *Tree[float64, model3d.Coord3D, T],
+	ge bool,
+	child *Tree[float64, model3d.Coord3D, T],
+) {
+	if ge {
+		t.GreaterEqual = child
+	} else {
+		t.LessThan = child
+	}
+}
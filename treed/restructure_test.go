@@ -0,0 +1,53 @@
+package treed
+
+import (
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestRestructure(t *testing.T) {
+	bounded := testTree()
+
+	// Create an unbalanced tree where large regions are deep in the tree,
+	// which can be restructured by rotations.
+	chain := &SolidTree{Leaf: true}
+	for i := 0; i < 8; i++ {
+		chain = &SolidTree{
+			Axis:         model3d.X(1),
+			Threshold:    -1 + 0.02*float64(8-i),
+			LessThan:     &SolidTree{Leaf: i%2 == 0},
+			GreaterEqual: chain,
+		}
+	}
+	chainTree := &BoundedSolidTree{Min: bounded.Min, Max: bounded.Max, Tree: chain}
+
+	for i, tree := range []*BoundedSolidTree{bounded, chainTree} {
+		samples := make([]model3d.Coord3D, 20000)
+		for j := range samples {
+			samples[j] = model3d.NewCoord3DRandBounds(tree.Min, tree.Max)
+		}
+		restructured := Restructure(tree, samples)
+
+		for j := 0; j < 10000; j++ {
+			c := model3d.NewCoord3DRandBounds(tree.Min, tree.Max)
+			if tree.Tree.Predict(c) != restructured.Tree.Predict(c) {
+				t.Fatalf("tree %d: prediction mismatch at %v", i, c)
+			}
+		}
+
+		oldDepth := tree.Tree.MeanDepth(samples)
+		newDepth := restructured.Tree.MeanDepth(samples)
+		if newDepth > oldDepth {
+			t.Errorf("tree %d: depth increased from %f to %f", i, oldDepth, newDepth)
+		}
+		if restructured.Tree.NumLeaves() > tree.Tree.NumLeaves() {
+			t.Errorf("tree %d: leaves increased from %d to %d", i, tree.Tree.NumLeaves(),
+				restructured.Tree.NumLeaves())
+		}
+		if i == 1 && newDepth >= oldDepth-1 {
+			t.Errorf("chain tree depth should decrease significantly, but went from %f to %f",
+				oldDepth, newDepth)
+		}
+	}
+}
@@ -132,6 +132,15 @@ func NewPolytopeBounds(min, max model3d.Coord3D) Polytope[float64, model3d.Coord
 	return res
 }
 
+// ConvexPolytope converts a 3D polytope into a model3d.ConvexPolytope.
+func ConvexPolytope(p Polytope[float64, model3d.Coord3D]) model3d.ConvexPolytope {
+	res := make(model3d.ConvexPolytope, len(p))
+	for i, ineq := range p {
+		res[i] = &model3d.LinearConstraint{Normal: ineq.Axis, Max: ineq.Max}
+	}
+	return res
+}
+
 func (p Polytope[F, C]) Constrain(axis C, max F) Polytope[F, C] {
 	return append(append(Polytope[F, C]{}, p...), Inequality[F, C]{Axis: axis, Max: max})
 }
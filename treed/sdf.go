@@ -0,0 +1,200 @@
+package treed
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// NearestBoundaryPoint finds the closest point to x on the boundary of the
+// occupied region of the tree.
+//
+// The returned normal points outward from the occupied region, and dist is
+// the (unsigned) distance from x to the returned point.
+//
+// If the tree has no boundary (e.g. it is entirely empty), then dist will be
+// infinite.
+//
+// Leaf polytopes are searched in best-first order, where branches are pruned
+// using their distance from x to the half-spaces of their ancestors.
+func (c *Collider) NearestBoundaryPoint(x model3d.Coord3D) (point, normal model3d.Coord3D,
+	dist float64) {
+	point, normal, dist, _ = c.nearestBoundaryPoint(x)
+	return
+}
+
+// nearestBoundaryPoint is like NearestBoundaryPoint, but also returns the
+// prediction of the tree at x.
+func (c *Collider) nearestBoundaryPoint(x model3d.Coord3D) (point, normal model3d.Coord3D,
+	dist float64, inside bool) {
+	inside = c.tree.Predict(x)
+	target := !inside
+
+	queue := &boundarySearchQueue{}
+	heap.Push(queue, &boundarySearchNode{Tree: c.tree})
+	for queue.Len() > 0 {
+		node := heap.Pop(queue).(*boundarySearchNode)
+		if node.Exact {
+			point, dist = node.Point, node.Bound
+			normal = boundaryNormal(node.Polytope, x, point, dist, inside)
+			return
+		}
+		tree := node.Tree
+		if tree.IsLeaf() {
+			if tree.Leaf != target {
+				continue
+			}
+			p, d, ok := PolytopeClosestPoint(node.Polytope, x)
+			if ok {
+				heap.Push(queue, &boundarySearchNode{
+					Polytope: node.Polytope,
+					Bound:    math.Max(node.Bound, d),
+					Exact:    true,
+					Point:    p,
+				})
+			}
+			continue
+		}
+		constraints := [2]*model3d.LinearConstraint{
+			{Normal: tree.Axis, Max: tree.Threshold},
+			{Normal: tree.Axis.Scale(-1), Max: -tree.Threshold},
+		}
+		for i, child := range [2]*SolidTree{tree.LessThan, tree.GreaterEqual} {
+			l := constraints[i]
+			planeDist := (l.Normal.Dot(x) - l.Max) / l.Normal.Norm()
+			polytope := make(model3d.ConvexPolytope, len(node.Polytope)+1)
+			copy(polytope, node.Polytope)
+			polytope[len(node.Polytope)] = l
+			heap.Push(queue, &boundarySearchNode{
+				Tree:     child,
+				Polytope: polytope,
+				Bound:    math.Max(node.Bound, planeDist),
+			})
+		}
+	}
+	return model3d.Coord3D{}, model3d.Coord3D{}, math.Inf(1), inside
+}
+
+// SignedDistance computes the distance from x to the boundary of the occupied
+// region, where the distance is positive inside the region and negative
+// outside of it.
+func (c *Collider) SignedDistance(x model3d.Coord3D) float64 {
+	_, _, dist, inside := c.nearestBoundaryPoint(x)
+	if inside {
+		return dist
+	}
+	return -dist
+}
+
+// boundaryNormal computes the outward normal of the occupied region at a
+// point on the boundary of a polytope.
+func boundaryNormal(
+	polytope model3d.ConvexPolytope,
+	x, point model3d.Coord3D,
+	dist float64,
+	inside bool,
+) model3d.Coord3D {
+	if dist > 0 {
+		if inside {
+			return point.Sub(x).Scale(1 / dist)
+		}
+		return x.Sub(point).Scale(1 / dist)
+	}
+
+	// The query point is exactly on the boundary, so we use the
+	// normal of the nearest face of the polytope.
+	var bestNormal model3d.Coord3D
+	bestDist := math.Inf(-1)
+	for _, l := range polytope {
+		norm := l.Normal.Norm()
+		d := (l.Normal.Dot(x) - l.Max) / norm
+		if d > bestDist {
+			bestDist = d
+			bestNormal = l.Normal.Scale(1 / norm)
+		}
+	}
+	if inside {
+		return bestNormal.Scale(-1)
+	}
+	return bestNormal
+}
+
+type boundarySearchNode struct {
+	Tree     *SolidTree
+	Polytope model3d.ConvexPolytope
+
+	// Bound is a lower bound on the distance, or the exact distance if Exact
+	// is true.
+	Bound float64
+	Exact bool
+	Point model3d.Coord3D
+}
+
+type boundarySearchQueue []*boundarySearchNode
+
+func (b boundarySearchQueue) Len() int {
+	return len(b)
+}
+
+func (b boundarySearchQueue) Less(i, j int) bool {
+	if b[i].Bound == b[j].Bound {
+		// Prefer exact results to break ties, so that the search can
+		// terminate as early as possible.
+		return b[i].Exact && !b[j].Exact
+	}
+	return b[i].Bound < b[j].Bound
+}
+
+func (b boundarySearchQueue) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+func (b *boundarySearchQueue) Push(x any) {
+	*b = append(*b, x.(*boundarySearchNode))
+}
+
+func (b *boundarySearchQueue) Pop() any {
+	res := (*b)[len(*b)-1]
+	*b = (*b)[:len(*b)-1]
+	return res
+}
+
+// SDF implements model3d.PointSDF and model3d.NormalSDF for the boundary of
+// the occupied region of a tree.
+type SDF struct {
+	collider *Collider
+}
+
+// NewSDF creates an SDF for the bounded tree.
+func NewSDF(b *BoundedSolidTree) *SDF {
+	return &SDF{collider: NewCollider(b)}
+}
+
+func (s *SDF) Min() model3d.Coord3D {
+	return s.collider.Min()
+}
+
+func (s *SDF) Max() model3d.Coord3D {
+	return s.collider.Max()
+}
+
+func (s *SDF) SDF(c model3d.Coord3D) float64 {
+	return s.collider.SignedDistance(c)
+}
+
+func (s *SDF) PointSDF(c model3d.Coord3D) (model3d.Coord3D, float64) {
+	point, _, dist, inside := s.collider.nearestBoundaryPoint(c)
+	if !inside {
+		dist = -dist
+	}
+	return point, dist
+}
+
+func (s *SDF) NormalSDF(c model3d.Coord3D) (model3d.Coord3D, float64) {
+	_, normal, dist, inside := s.collider.nearestBoundaryPoint(c)
+	if !inside {
+		dist = -dist
+	}
+	return normal, dist
+}
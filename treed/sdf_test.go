@@ -0,0 +1,37 @@
+package treed
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestSDF(t *testing.T) {
+	bounded := testTree()
+	mesh := model3d.MarchingCubesSearch(TreeSolid(bounded), 0.01, 8)
+	meshSDF := model3d.MeshToSDF(mesh)
+	treeSDF := NewSDF(bounded)
+
+	var _ model3d.PointSDF = treeSDF
+	var _ model3d.NormalSDF = treeSDF
+
+	for i := 0; i < 1000; i++ {
+		c := model3d.NewCoord3DRandNorm()
+		expected := meshSDF.SDF(c)
+		point, actual := treeSDF.PointSDF(c)
+		if math.Abs(expected-actual) > 0.02 {
+			t.Errorf("point %v should have SDF %f but got %f", c, expected, actual)
+		}
+		if math.Abs(point.Dist(c)-math.Abs(actual)) > 1e-8 {
+			t.Errorf("point %v has distance %f but SDF %f", c, point.Dist(c), actual)
+		}
+		normal, _ := treeSDF.NormalSDF(c)
+		if math.Abs(normal.Norm()-1) > 1e-8 {
+			t.Errorf("normal %v should have unit norm", normal)
+		}
+		if actual < -1e-3 && normal.Dot(c.Sub(point)) < 0 {
+			t.Errorf("normal %v should point towards outside point", normal)
+		}
+	}
+}
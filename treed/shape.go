@@ -0,0 +1,231 @@
+package treed
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// A ShapeSpec is a JSON-serializable description of a shape built from
+// primitives and CSG operations.
+//
+// Primitives are selected by Type:
+//
+//   - "sphere": Center and Radius.
+//   - "box": Min and Max.
+//   - "cylinder": P1, P2, and Radius.
+//   - "capsule": P1, P2, and Radius.
+//   - "torus": Center, Axis, OuterRadius, and InnerRadius.
+//
+// Operations combine Children:
+//
+//   - "union" and "intersection" of all children.
+//   - "difference" subtracts the remaining children from the first child.
+//   - "smooth_union" is a union which blends children together within a
+//     distance of Smoothness.
+type ShapeSpec struct {
+	Type string `json:"type"`
+
+	Center      *[3]float64 `json:"center,omitempty"`
+	Axis        *[3]float64 `json:"axis,omitempty"`
+	Min         *[3]float64 `json:"min,omitempty"`
+	Max         *[3]float64 `json:"max,omitempty"`
+	P1          *[3]float64 `json:"p1,omitempty"`
+	P2          *[3]float64 `json:"p2,omitempty"`
+	Radius      float64     `json:"radius,omitempty"`
+	OuterRadius float64     `json:"outer_radius,omitempty"`
+	InnerRadius float64     `json:"inner_radius,omitempty"`
+	Smoothness  float64     `json:"smoothness,omitempty"`
+
+	Children []*ShapeSpec `json:"children,omitempty"`
+}
+
+// ReadShapeSpec decodes a JSON ShapeSpec.
+func ReadShapeSpec(r io.Reader) (*ShapeSpec, error) {
+	var res ShapeSpec
+	if err := json.NewDecoder(r).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "read shape spec")
+	}
+	return &res, nil
+}
+
+// SDF creates a model3d.SDF for the shape, which is positive inside.
+//
+// For operations, the result is only a bound on the true signed distance,
+// but it always has the correct sign.
+func (s *ShapeSpec) SDF() (model3d.SDF, error) {
+	coord := func(name string, c *[3]float64) (model3d.Coord3D, error) {
+		if c == nil {
+			return model3d.Coord3D{}, errors.Errorf("%s: missing %s", s.Type, name)
+		}
+		return model3d.NewCoord3DArray(*c), nil
+	}
+	positive := func(name string, x float64) error {
+		if x <= 0 {
+			return errors.Errorf("%s: %s must be positive", s.Type, name)
+		}
+		return nil
+	}
+
+	switch s.Type {
+	case "sphere":
+		center, err := coord("center", s.Center)
+		if err != nil {
+			return nil, err
+		}
+		if err := positive("radius", s.Radius); err != nil {
+			return nil, err
+		}
+		return &model3d.Sphere{Center: center, Radius: s.Radius}, nil
+	case "box":
+		min, err := coord("min", s.Min)
+		if err != nil {
+			return nil, err
+		}
+		max, err := coord("max", s.Max)
+		if err != nil {
+			return nil, err
+		}
+		if min.X >= max.X || min.Y >= max.Y || min.Z >= max.Z {
+			return nil, errors.New("box: min must be less than max")
+		}
+		return &model3d.Rect{MinVal: min, MaxVal: max}, nil
+	case "cylinder", "capsule":
+		p1, err := coord("p1", s.P1)
+		if err != nil {
+			return nil, err
+		}
+		p2, err := coord("p2", s.P2)
+		if err != nil {
+			return nil, err
+		}
+		if err := positive("radius", s.Radius); err != nil {
+			return nil, err
+		}
+		if s.Type == "capsule" {
+			return &model3d.Capsule{P1: p1, P2: p2, Radius: s.Radius}, nil
+		}
+		if p1 == p2 {
+			return nil, errors.New("cylinder: p1 and p2 must differ")
+		}
+		return &model3d.Cylinder{P1: p1, P2: p2, Radius: s.Radius}, nil
+	case "torus":
+		center, err := coord("center", s.Center)
+		if err != nil {
+			return nil, err
+		}
+		axis, err := coord("axis", s.Axis)
+		if err != nil {
+			return nil, err
+		}
+		if norm := axis.Norm(); norm == 0 || math.IsInf(norm, 0) || math.IsNaN(norm) {
+			return nil, errors.New("torus: axis must be a non-zero, finite vector")
+		}
+		if err := positive("outer_radius", s.OuterRadius); err != nil {
+			return nil, err
+		}
+		if err := positive("inner_radius", s.InnerRadius); err != nil {
+			return nil, err
+		}
+		return &model3d.Torus{
+			Center:      center,
+			Axis:        axis.Normalize(),
+			OuterRadius: s.OuterRadius,
+			InnerRadius: s.InnerRadius,
+		}, nil
+	case "union", "intersection", "difference", "smooth_union":
+		if len(s.Children) == 0 {
+			return nil, errors.Errorf("%s: missing children", s.Type)
+		}
+		res := &csgSDF{Op: s.Type, Smoothness: s.Smoothness}
+		for _, child := range s.Children {
+			sdf, err := child.SDF()
+			if err != nil {
+				return nil, errors.Wrap(err, s.Type)
+			}
+			res.Children = append(res.Children, sdf)
+		}
+		if s.Type == "smooth_union" {
+			if err := positive("smoothness", s.Smoothness); err != nil {
+				return nil, err
+			}
+		}
+		if s.Type == "intersection" {
+			min, max := res.Min(), res.Max()
+			if min.X > max.X || min.Y > max.Y || min.Z > max.Z {
+				return nil, errors.New("intersection: bounds of children do not overlap")
+			}
+		}
+		return res, nil
+	case "":
+		return nil, errors.New("missing shape type")
+	default:
+		return nil, errors.Errorf("unknown shape type: %s", s.Type)
+	}
+}
+
+type csgSDF struct {
+	Op         string
+	Smoothness float64
+	Children   []model3d.SDF
+}
+
+func (c *csgSDF) Min() model3d.Coord3D {
+	res := c.Children[0].Min()
+	for _, child := range c.Children[1:] {
+		switch c.Op {
+		case "union", "smooth_union":
+			res = res.Min(child.Min())
+		case "intersection":
+			res = res.Max(child.Min())
+		}
+	}
+	if c.Op == "smooth_union" {
+		res = res.AddScalar(-c.Smoothness)
+	}
+	return res
+}
+
+func (c *csgSDF) Max() model3d.Coord3D {
+	res := c.Children[0].Max()
+	for _, child := range c.Children[1:] {
+		switch c.Op {
+		case "union", "smooth_union":
+			res = res.Max(child.Max())
+		case "intersection":
+			res = res.Min(child.Max())
+		}
+	}
+	if c.Op == "smooth_union" {
+		res = res.AddScalar(c.Smoothness)
+	}
+	return res
+}
+
+func (c *csgSDF) SDF(coord model3d.Coord3D) float64 {
+	res := c.Children[0].SDF(coord)
+	for _, child := range c.Children[1:] {
+		value := child.SDF(coord)
+		switch c.Op {
+		case "union":
+			res = math.Max(res, value)
+		case "intersection":
+			res = math.Min(res, value)
+		case "difference":
+			res = math.Min(res, -value)
+		case "smooth_union":
+			res = smoothMax(res, value, c.Smoothness)
+		}
+	}
+	return res
+}
+
+// smoothMax computes a polynomial smooth maximum of two values, which is at
+// least as large as the true maximum.
+func smoothMax(a, b, k float64) float64 {
+	h := math.Max(0, math.Min(1, 0.5+0.5*(a-b)/k))
+	return b + (a-b)*h + k*h*(1-h)
+}
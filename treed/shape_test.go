@@ -0,0 +1,92 @@
+package treed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestShapeSpec(t *testing.T) {
+	spec, err := ReadShapeSpec(strings.NewReader(`{
+		"type": "difference",
+		"children": [
+			{
+				"type": "union",
+				"children": [
+					{"type": "sphere", "center": [0, 0, 0], "radius": 1},
+					{"type": "box", "min": [0, -0.5, -0.5], "max": [2, 0.5, 0.5]}
+				]
+			},
+			{"type": "cylinder", "p1": [0, 0, -2], "p2": [0, 0, 2], "radius": 0.25}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdf, err := spec.SDF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdf.Min() != model3d.XYZ(-1, -1, -1) || sdf.Max() != model3d.XYZ(2, 1, 1) {
+		t.Errorf("unexpected bounds: %v, %v", sdf.Min(), sdf.Max())
+	}
+	for _, c := range []struct {
+		Point  model3d.Coord3D
+		Inside bool
+	}{
+		{model3d.XYZ(0.5, 0.5, 0), true},
+		{model3d.XYZ(1.5, 0, 0), true},
+		{model3d.XYZ(0, 0, 0), false},
+		{model3d.XYZ(0.1, 0.1, 0.9), false},
+		{model3d.XYZ(1.5, 0.7, 0), false},
+	} {
+		if actual := sdf.SDF(c.Point) > 0; actual != c.Inside {
+			t.Errorf("point %v: expected inside=%v", c.Point, c.Inside)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"type": "sphere", "radius": 1}`,
+		`{"type": "box", "min": [1, 0, 0], "max": [0, 1, 1]}`,
+		`{"type": "union"}`,
+		`{"type": "smooth_union", "children": [{"type": "sphere", "center": [0, 0, 0], "radius": 1}]}`,
+		`{"type": "pyramid"}`,
+		`{"type": "torus", "center": [0, 0, 0], "axis": [0, 0, 0], "outer_radius": 1, "inner_radius": 0.1}`,
+		`{"type": "intersection", "children": [` +
+			`{"type": "sphere", "center": [0, 0, 0], "radius": 1}, ` +
+			`{"type": "sphere", "center": [3, 0, 0], "radius": 1}]}`,
+	} {
+		spec, err := ReadShapeSpec(strings.NewReader(bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := spec.SDF(); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestShapeSpecSmoothUnion(t *testing.T) {
+	children := []*ShapeSpec{
+		{Type: "sphere", Center: &[3]float64{-0.6, 0, 0}, Radius: 0.5},
+		{Type: "sphere", Center: &[3]float64{0.6, 0, 0}, Radius: 0.5},
+	}
+	union, err := (&ShapeSpec{Type: "union", Children: children}).SDF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	smooth, err := (&ShapeSpec{Type: "smooth_union", Smoothness: 0.5, Children: children}).SDF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		c := model3d.NewCoord3DRandBounds(smooth.Min(), smooth.Max())
+		if union.SDF(c) > 0 && smooth.SDF(c) <= 0 {
+			t.Errorf("point %v is in union but not smooth union", c)
+		}
+	}
+	if mid := model3d.Origin; union.SDF(mid) > 0 || smooth.SDF(mid) <= 0 {
+		t.Error("smooth union should fill the gap between spheres")
+	}
+}
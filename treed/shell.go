@@ -0,0 +1,182 @@
+package treed
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// A DrainHole is a hole through the wall of a hollowed solid, which allows
+// material to escape from the interior.
+//
+// The hole is a prism with a regular polygonal cross-section that starts at
+// Origin and extends infinitely along Direction. The origin should be inside
+// of the hollow interior, so that the hole cuts through the wall.
+type DrainHole struct {
+	Origin    model3d.Coord3D
+	Direction model3d.Coord3D
+
+	// Radius is the inradius of the cross-section, so the hole contains a
+	// cylinder of this radius.
+	Radius float64
+
+	// Sides is the number of sides of the cross-section. If 0, a default of
+	// 16 is used.
+	Sides int
+}
+
+// Polytope creates a convex polytope for the hole.
+func (d *DrainHole) Polytope() model3d.ConvexPolytope {
+	sides := d.Sides
+	if sides == 0 {
+		sides = 16
+	}
+	dir := d.Direction.Normalize()
+	res := model3d.ConvexPolytope{
+		&model3d.LinearConstraint{Normal: dir.Scale(-1), Max: -dir.Dot(d.Origin)},
+	}
+	u, v := dir.OrthoBasis()
+	for i := 0; i < sides; i++ {
+		theta := 2 * math.Pi * float64(i) / float64(sides)
+		normal := u.Scale(math.Cos(theta)).Add(v.Scale(math.Sin(theta)))
+		res = append(res, &model3d.LinearConstraint{
+			Normal: normal,
+			Max:    normal.Dot(d.Origin) + d.Radius,
+		})
+	}
+	return res
+}
+
+// A Shell hollows out solid trees, leaving walls of a fixed thickness.
+type Shell struct {
+	// Thickness is the thickness of the walls.
+	Thickness float64
+
+	// Axes, Loss, and MaxDepth are used to fit the inward offset of the
+	// solid with GreedyTree().
+	//
+	// A Loss with a PositiveWeight less than 1 makes the offset more
+	// conservative, so that walls are less likely to be too thin.
+	Axes     []model3d.Coord3D
+	Loss     SplitLoss[float64, bool]
+	MaxDepth int
+
+	// NumSamples is the number of points to sample when fitting the offset.
+	NumSamples int
+
+	// DrainHoles are cut out of the resulting shell.
+	DrainHoles []*DrainHole
+}
+
+// Offset fits a tree to the region where the signed distance is greater than
+// the wall thickness.
+//
+// The SDF may be derived from the original mesh, or from the tree itself
+// using NewSDF().
+func (s *Shell) Offset(b *BoundedSolidTree, sdf model3d.SDF) *BoundedSolidTree {
+	coords := make([]model3d.Coord3D, s.NumSamples)
+	labels := make([]bool, s.NumSamples)
+	essentials.ConcurrentMap(0, s.NumSamples, func(i int) {
+		c := model3d.NewCoord3DRandBounds(b.Min, b.Max)
+		coords[i] = c
+		labels[i] = sdf.SDF(c) > s.Thickness
+	})
+	return &BoundedSolidTree{
+		Min:  b.Min,
+		Max:  b.Max,
+		Tree: GreedyTree[float64, model3d.Coord3D, bool](s.Axes, coords, labels, s.Loss, 0, s.MaxDepth),
+	}
+}
+
+// Hollow creates a shell by intersecting the tree with the complement of its
+// inward offset, and then cutting out the drain holes.
+func (s *Shell) Hollow(b *BoundedSolidTree, sdf model3d.SDF) *BoundedSolidTree {
+	res := SubtractTrees(b, s.Offset(b, sdf))
+	for _, hole := range s.DrainHoles {
+		res = SubtractTrees(res, &BoundedSolidTree{
+			Min:  b.Min,
+			Max:  b.Max,
+			Tree: ConvexPolytopeTree(hole.Polytope()),
+		})
+	}
+	return res
+}
+
+// A WallSample is a point on the surface of a solid, along with the
+// thickness of the solid measured inward along the surface normal.
+type WallSample struct {
+	Point     model3d.Coord3D
+	Normal    model3d.Coord3D
+	Thickness float64
+}
+
+// WallThicknessReport summarizes the results of CheckWallThickness().
+type WallThicknessReport struct {
+	// NumSamples is the number of surface points which were checked.
+	NumSamples int
+
+	// Thinnest is the sample with the smallest thickness.
+	Thinnest WallSample
+
+	// Violations contains the samples which are thinner than the minimum.
+	Violations []WallSample
+}
+
+// CheckWallThickness samples points on the surface of a tree by casting
+// random rays, and measures the thickness of the solid at each point by
+// casting a ray inward along the surface normal.
+func CheckWallThickness(
+	b *BoundedSolidTree,
+	minThickness float64,
+	numRays int,
+) *WallThicknessReport {
+	collider := NewCollider(b)
+	center := b.Min.Mid(b.Max)
+	radius := b.Min.Dist(b.Max)
+	eps := radius * 1e-8
+
+	var lock sync.Mutex
+	res := &WallThicknessReport{Thinnest: WallSample{Thickness: math.Inf(1)}}
+	essentials.StatefulConcurrentMap(0, numRays, func() func(int) {
+		gen := rand.New(rand.NewSource(rand.Int63()))
+		return func(int) {
+			origin := model3d.XYZ(gen.NormFloat64(), gen.NormFloat64(), gen.NormFloat64())
+			origin = center.Add(origin.Normalize().Scale(radius))
+			target := model3d.XYZ(gen.Float64(), gen.Float64(), gen.Float64())
+			target = target.Mul(b.Max.Sub(b.Min)).Add(b.Min)
+			ray := &model3d.Ray{Origin: origin, Direction: target.Sub(origin).Normalize()}
+			var samples []WallSample
+			collider.RayCollisions(ray, func(rc model3d.RayCollision) {
+				point := ray.Origin.Add(ray.Direction.Scale(rc.Scale))
+				inward := &model3d.Ray{
+					Origin:    point.Sub(rc.Normal.Scale(eps)),
+					Direction: rc.Normal.Scale(-1),
+				}
+				thickness := math.Inf(1)
+				if exit, ok := collider.FirstRayCollision(inward); ok {
+					thickness = exit.Scale + eps
+				}
+				samples = append(samples, WallSample{
+					Point:     point,
+					Normal:    rc.Normal,
+					Thickness: thickness,
+				})
+			})
+			lock.Lock()
+			defer lock.Unlock()
+			for _, sample := range samples {
+				res.NumSamples++
+				if sample.Thickness < res.Thinnest.Thickness {
+					res.Thinnest = sample
+				}
+				if sample.Thickness < minThickness {
+					res.Violations = append(res.Violations, sample)
+				}
+			}
+		}
+	})
+	return res
+}
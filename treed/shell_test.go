@@ -0,0 +1,106 @@
+package treed
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestShellHollow(t *testing.T) {
+	sphere := &model3d.Sphere{Radius: 0.8}
+	xs := make([]model3d.Coord3D, 50000)
+	ys := make([]bool, len(xs))
+	for i := range xs {
+		xs[i] = model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		ys[i] = sphere.Contains(xs[i])
+	}
+	axes := NewConstantAxisScheduleIcosphere(2).Init()
+	tree := &BoundedSolidTree{
+		Min:  model3d.XYZ(-1, -1, -1),
+		Max:  model3d.XYZ(1, 1, 1),
+		Tree: GreedyTree[float64, model3d.Coord3D, bool](axes, xs, ys, EntropySplitLoss[float64]{}, 0, 10),
+	}
+
+	shell := &Shell{
+		Thickness:  0.3,
+		Axes:       axes,
+		Loss:       EntropySplitLoss[float64]{PositiveWeight: 0.5},
+		MaxDepth:   10,
+		NumSamples: 50000,
+		DrainHoles: []*DrainHole{
+			{Origin: model3d.Origin, Direction: model3d.Z(-1), Radius: 0.1},
+		},
+	}
+	hollow := shell.Hollow(tree, sphere)
+
+	for _, c := range []model3d.Coord3D{
+		model3d.Origin,
+		model3d.XYZ(0.2, 0.2, 0.1),
+		model3d.Z(-0.65),
+		model3d.XYZ(0.9, 0.0, 0.0),
+	} {
+		if hollow.Tree.Predict(c) {
+			t.Errorf("point %v should not be in shell", c)
+		}
+	}
+	var numWall, numInWall int
+	for _, c := range xs {
+		if r := c.Norm(); r > 0.6 && r < 0.7 && (c.Z > 0 || math.Hypot(c.X, c.Y) > 0.2) {
+			numWall++
+			if hollow.Tree.Predict(c) {
+				numInWall++
+			}
+		}
+	}
+	if frac := float64(numInWall) / float64(numWall); frac < 0.95 {
+		t.Errorf("expected points in the wall to be in the shell, but got fraction %f", frac)
+	}
+
+	var count int
+	for _, c := range xs {
+		if hollow.Tree.Predict(c) {
+			count++
+		}
+	}
+	volume := 8 * float64(count) / float64(len(xs))
+	expected := 4.0 / 3.0 * math.Pi * (math.Pow(0.8, 3) - math.Pow(0.5, 3))
+	// The offset is conservative, so walls may be thicker than requested.
+	if volume < expected*0.9 || volume > expected*1.4 {
+		t.Errorf("expected volume around %f but got %f", expected, volume)
+	}
+}
+
+func TestCheckWallThickness(t *testing.T) {
+	slab := &BoundedSolidTree{
+		Min:  model3d.XYZ(-0.5, -0.5, -0.05),
+		Max:  model3d.XYZ(0.5, 0.5, 0.05),
+		Tree: &SolidTree{Leaf: true},
+	}
+	tree := &BoundedSolidTree{
+		Min:  model3d.XYZ(-1, -1, -1),
+		Max:  model3d.XYZ(1, 1, 1),
+		Tree: slab.AsTree(false, model3d.X(1), model3d.Y(1), model3d.Z(1)),
+	}
+
+	report := CheckWallThickness(tree, 0.2, 2000)
+	if report.NumSamples == 0 {
+		t.Fatal("no samples")
+	}
+	if math.Abs(report.Thinnest.Thickness-0.1) > 1e-5 {
+		t.Errorf("expected thinnest wall 0.1 but got %f", report.Thinnest.Thickness)
+	}
+	if frac := float64(len(report.Violations)) / float64(report.NumSamples); frac < 0.5 {
+		t.Errorf("expected most samples to be violations, but got fraction %f", frac)
+	}
+	for _, v := range report.Violations {
+		if v.Thickness >= 0.2 {
+			t.Fatalf("violation has thickness %f", v.Thickness)
+		}
+	}
+
+	report = CheckWallThickness(tree, 0.05, 2000)
+	if len(report.Violations) != 0 {
+		t.Errorf("expected no violations but got %d", len(report.Violations))
+	}
+}
@@ -0,0 +1,163 @@
+package treed
+
+import (
+	"math"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model2d"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// SliceTree intersects a 3D tree with the plane at the given z value,
+// producing an equivalent 2D tree over (x, y) coordinates.
+//
+// Branches which are parallel to the plane are replaced by the child that
+// the entire plane falls into.
+func SliceTree[T any](
+	t *Tree[float64, model3d.Coord3D, T],
+	z float64,
+) *Tree[float64, model2d.Coord, T] {
+	for !t.IsLeaf() {
+		axis := model2d.XY(t.Axis.X, t.Axis.Y)
+		threshold := t.Threshold - t.Axis.Z*z
+		if axis.X != 0 || axis.Y != 0 {
+			return &Tree[float64, model2d.Coord, T]{
+				Axis:         axis,
+				Threshold:    threshold,
+				LessThan:     SliceTree(t.LessThan, z),
+				GreaterEqual: SliceTree(t.GreaterEqual, z),
+			}
+		}
+		if 0 < threshold {
+			t = t.LessThan
+		} else {
+			t = t.GreaterEqual
+		}
+	}
+	return &Tree[float64, model2d.Coord, T]{Leaf: t.Leaf}
+}
+
+// SliceBoundedTree is like SliceTree, but also slices the bounds.
+//
+// If z is outside of the bounds, the resulting tree is a single leaf with
+// the zero value of T (i.e. empty space for a solid tree).
+func SliceBoundedTree[T any](
+	b *BoundedTree[float64, model3d.Coord3D, T],
+	z float64,
+) *BoundedTree[float64, model2d.Coord, T] {
+	res := &BoundedTree[float64, model2d.Coord, T]{
+		Min: model2d.XY(b.Min.X, b.Min.Y),
+		Max: model2d.XY(b.Max.X, b.Max.Y),
+	}
+	if z < b.Min.Z || z > b.Max.Z {
+		res.Tree = &Tree[float64, model2d.Coord, T]{}
+	} else {
+		res.Tree = SliceTree(b.Tree, z)
+	}
+	return res
+}
+
+// SlicePolygons computes the exact occupied region of a 2D tree as a set of
+// disjoint convex polygons, one per non-empty occupied leaf.
+//
+// Vertices are in counter-clockwise order.
+func SlicePolygons(b *BoundedTree[float64, model2d.Coord, bool]) [][]model2d.Coord {
+	var res [][]model2d.Coord
+	var iterate func(t *Tree[float64, model2d.Coord, bool], poly []model2d.Coord)
+	iterate = func(t *Tree[float64, model2d.Coord, bool], poly []model2d.Coord) {
+		if len(poly) < 3 {
+			return
+		}
+		if t.IsLeaf() {
+			if t.Leaf && polygonArea(poly) > 0 {
+				res = append(res, poly)
+			}
+			return
+		}
+		iterate(t.LessThan, clipPolygon(poly, t.Axis, t.Threshold, 0))
+		iterate(t.GreaterEqual, clipPolygon(poly, t.Axis.Scale(-1), -t.Threshold, 0))
+	}
+	iterate(b.Tree, []model2d.Coord{
+		b.Min,
+		model2d.XY(b.Max.X, b.Min.Y),
+		b.Max,
+		model2d.XY(b.Min.X, b.Max.Y),
+	})
+	return res
+}
+
+// RasterizeSlice renders the occupied region of a 2D tree into a grayscale
+// image covering the bounds, stored in row-major order with the first row
+// at the maximum y value.
+//
+// If antialias is false, each pixel is 1 or 0 depending on the prediction at
+// its center. Otherwise, each pixel is the fraction of its area which is
+// occupied, computed exactly from SlicePolygons().
+func RasterizeSlice(
+	b *BoundedTree[float64, model2d.Coord, bool],
+	width, height int,
+	antialias bool,
+) []float64 {
+	res := make([]float64, width*height)
+	pixelSize := b.Max.Sub(b.Min).Div(model2d.XY(float64(width), float64(height)))
+	if !antialias {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				c := model2d.XY(
+					b.Min.X+(float64(x)+0.5)*pixelSize.X,
+					b.Max.Y-(float64(y)+0.5)*pixelSize.Y,
+				)
+				if b.Tree.Predict(c) {
+					res[x+y*width] = 1
+				}
+			}
+		}
+		return res
+	}
+
+	pixelArea := pixelSize.X * pixelSize.Y
+	for _, poly := range SlicePolygons(b) {
+		polyMin, polyMax := poly[0], poly[0]
+		for _, c := range poly[1:] {
+			polyMin = polyMin.Min(c)
+			polyMax = polyMax.Max(c)
+		}
+		minX := essentials.MaxInt(0, int(math.Floor((polyMin.X-b.Min.X)/pixelSize.X)))
+		maxX := essentials.MinInt(width-1, int(math.Floor((polyMax.X-b.Min.X)/pixelSize.X)))
+		minY := essentials.MaxInt(0, int(math.Floor((b.Max.Y-polyMax.Y)/pixelSize.Y)))
+		maxY := essentials.MinInt(height-1, int(math.Floor((b.Max.Y-polyMin.Y)/pixelSize.Y)))
+		for y := minY; y <= maxY; y++ {
+			pixelMaxY := b.Max.Y - float64(y)*pixelSize.Y
+			pixelMinY := pixelMaxY - pixelSize.Y
+			row := clipPolygon(poly, model2d.Y(1), pixelMaxY, 0)
+			row = clipPolygon(row, model2d.Y(-1), -pixelMinY, 0)
+			if len(row) < 3 {
+				continue
+			}
+			for x := minX; x <= maxX; x++ {
+				pixelMinX := b.Min.X + float64(x)*pixelSize.X
+				pixelMaxX := pixelMinX + pixelSize.X
+				cell := clipPolygon(row, model2d.X(1), pixelMaxX, 0)
+				cell = clipPolygon(cell, model2d.X(-1), -pixelMinX, 0)
+				if len(cell) >= 3 {
+					res[x+y*width] += polygonArea(cell) / pixelArea
+				}
+			}
+		}
+	}
+	for i, x := range res {
+		res[i] = math.Min(1, x)
+	}
+	return res
+}
+
+// polygonArea computes the signed area of a polygon, which is positive for
+// counter-clockwise vertices.
+func polygonArea(poly []model2d.Coord) float64 {
+	var res float64
+	for i, p1 := range poly {
+		p2 := poly[(i+1)%len(poly)]
+		res += p1.X*p2.Y - p2.X*p1.Y
+	}
+	return res / 2
+}
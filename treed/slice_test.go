@@ -0,0 +1,117 @@
+package treed
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/model3d/model2d"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestSliceTree(t *testing.T) {
+	tree := sliceTestTree()
+	for i := 0; i < 100; i++ {
+		z := rand.Float64()*2 - 1
+		slice := SliceBoundedTree(tree, z)
+		for j := 0; j < 100; j++ {
+			c := model3d.NewCoord3DRandBounds(tree.Min, tree.Max)
+			c.Z = z
+			expected := tree.Tree.Predict(c)
+			actual := slice.Tree.Predict(model2d.XY(c.X, c.Y))
+			if expected != actual {
+				t.Fatalf("point %v: expected %v but got %v", c, expected, actual)
+			}
+		}
+	}
+
+	// Planes parallel to the slice should be removed.
+	flat := &SolidTree{
+		Axis:         model3d.Z(2),
+		Threshold:    1,
+		LessThan:     &SolidTree{Leaf: true},
+		GreaterEqual: &SolidTree{Leaf: false},
+	}
+	if s := SliceTree(flat, 0.49); !s.IsLeaf() || !s.Leaf {
+		t.Errorf("unexpected slice below plane: %v", s)
+	}
+	if s := SliceTree(flat, 0.5); !s.IsLeaf() || s.Leaf {
+		t.Errorf("unexpected slice on plane: %v", s)
+	}
+
+	// Slices outside of the bounds should be empty.
+	bounded := &BoundedSolidTree{
+		Min:  model3d.XYZ(-1, -1, 0),
+		Max:  model3d.XYZ(1, 1, 0.25),
+		Tree: flat,
+	}
+	for _, z := range []float64{-0.1, 0.3} {
+		if s := SliceBoundedTree(bounded, z); !s.Tree.IsLeaf() || s.Tree.Leaf {
+			t.Errorf("unexpected slice outside of bounds at %f: %v", z, s.Tree)
+		}
+	}
+	if s := SliceBoundedTree(bounded, 0.25); !s.Tree.IsLeaf() || !s.Tree.Leaf {
+		t.Errorf("unexpected slice at top of bounds: %v", s.Tree)
+	}
+}
+
+func TestRasterizeSlice(t *testing.T) {
+	tree := sliceTestTree()
+	slice := SliceBoundedTree(tree, 0.1)
+
+	var polyArea float64
+	for _, poly := range SlicePolygons(slice) {
+		area := polygonArea(poly)
+		if area <= 0 {
+			t.Fatalf("polygon should have positive area but got %f", area)
+		}
+		polyArea += area
+	}
+	var count int
+	numSamples := 100000
+	for i := 0; i < numSamples; i++ {
+		c := model2d.NewCoordRandBounds(slice.Min, slice.Max)
+		if slice.Tree.Predict(c) {
+			count++
+		}
+	}
+	expectedArea := 4 * float64(count) / float64(numSamples)
+	if math.Abs(polyArea-expectedArea) > 0.03 {
+		t.Errorf("expected area %f but got %f", expectedArea, polyArea)
+	}
+
+	width, height := 37, 23
+	pixelArea := 4 / float64(width*height)
+	for _, antialias := range []bool{false, true} {
+		image := RasterizeSlice(slice, width, height, antialias)
+		var rasterArea float64
+		for _, x := range image {
+			if x < 0 || x > 1 {
+				t.Fatalf("pixel out of range: %f", x)
+			}
+			rasterArea += x * pixelArea
+		}
+		if antialias && math.Abs(rasterArea-polyArea) > 1e-8 {
+			t.Errorf("expected antialiased area %f but got %f", polyArea, rasterArea)
+		} else if math.Abs(rasterArea-polyArea) > 0.1 {
+			t.Errorf("expected area %f but got %f (antialias=%v)", polyArea, rasterArea,
+				antialias)
+		}
+	}
+}
+
+func sliceTestTree() *BoundedSolidTree {
+	xs := make([]model3d.Coord3D, 20000)
+	ys := make([]bool, len(xs))
+	for i := range xs {
+		x := model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		xs[i] = x
+		ys[i] = x.Norm() < 0.7 || x.Dist(model3d.XYZ(0.6, 0.6, 0.3)) < 0.3
+	}
+	axes := NewConstantAxisScheduleIcosphere(1).Init()
+	return &BoundedSolidTree{
+		Min:  model3d.XYZ(-1, -1, -1),
+		Max:  model3d.XYZ(1, 1, 1),
+		Tree: GreedyTree[float64, model3d.Coord3D, bool](axes, xs, ys, EntropySplitLoss[float64]{}, 0, 8),
+	}
+}
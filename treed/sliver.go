@@ -0,0 +1,181 @@
+package treed
+
+import (
+	"math"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize/convex/lp"
+)
+
+// LeafShape describes the size of a leaf polytope.
+type LeafShape struct {
+	// Volume is the volume of the leaf polytope.
+	Volume float64
+
+	// Inradius is the radius of the largest ball that fits inside the leaf
+	// polytope. Long, thin slivers have a small inradius even if their volume
+	// is relatively large.
+	Inradius float64
+}
+
+// NewLeafShape computes the volume and inradius of a leaf polytope.
+//
+// The center and scale should roughly describe the bounds of the polytope,
+// and are used to keep the linear program well-conditioned.
+func NewLeafShape(p model3d.ConvexPolytope, center model3d.Coord3D, scale float64) LeafShape {
+	inradius := polytopeInradius(p, center, scale)
+	if inradius <= 0 {
+		return LeafShape{}
+	}
+	return LeafShape{
+		Volume:   math.Abs(p.Mesh().Volume()),
+		Inradius: inradius,
+	}
+}
+
+// polytopeInradius finds the radius of the Chebyshev ball of a polytope, or
+// returns 0 if the polytope is empty.
+func polytopeInradius(p model3d.ConvexPolytope, center model3d.Coord3D, scale float64) float64 {
+	g := mat.NewDense(len(p), 4, nil)
+	h := make([]float64, len(p))
+	for i, l := range p {
+		norm := l.Normal.Norm()
+		if norm == 0 {
+			if l.Max < 0 {
+				return 0
+			}
+			continue
+		}
+		normal := l.Normal.Scale(1 / norm)
+		g.Set(i, 0, normal.X)
+		g.Set(i, 1, normal.Y)
+		g.Set(i, 2, normal.Z)
+		g.Set(i, 3, 1)
+		h[i] = (l.Max - l.Normal.Dot(center)) / (norm * scale)
+	}
+	c := []float64{0, 0, 0, -1}
+	cNew, aNew, bNew := lp.Convert(c, g, h, nil, nil)
+	_, x, err := lp.Simplex(cNew, aNew, bNew, 1e-10, nil)
+	if err != nil {
+		return 0
+	}
+	return math.Max(0, (x[3]-x[7])*scale)
+}
+
+// SliverFilter removes small and thin parts of the occupied region of a
+// solid tree, such as the slivers that greedy trees sometimes create outside
+// of the object they approximate.
+//
+// Thresholds which are zero are not used.
+type SliverFilter struct {
+	// MinInradius is the smallest inradius of an occupied leaf which is kept.
+	MinInradius float64
+
+	// MinLeafVolume is the smallest volume of an occupied leaf which is kept.
+	MinLeafVolume float64
+
+	// MinComponentVolume is the smallest total volume of a connected
+	// component of occupied leaves which is kept.
+	//
+	// Components are computed after removing thin or small leaves, using the
+	// adjacency of a LeafGraph.
+	MinComponentVolume float64
+}
+
+// SliverFilterResult is the result of SliverFilter.Filter().
+type SliverFilterResult struct {
+	Tree *BoundedSolidTree
+
+	// LeavesRemoved is the total number of leaves changed to false, and
+	// SliverLeaves is the number of these removed for being too thin or too
+	// small on their own.
+	LeavesRemoved int
+	SliverLeaves  int
+
+	// ComponentsRemoved is the number of connected components removed for
+	// having too little volume.
+	ComponentsRemoved int
+
+	// VolumeRemoved is the total volume of the removed leaves.
+	VolumeRemoved float64
+}
+
+// Filter relabels thin or small occupied leaves and small connected
+// components of the occupied region as empty.
+func (s *SliverFilter) Filter(b *BoundedSolidTree) *SliverFilterResult {
+	graph := NewLeafGraph(b)
+	polytopes := LeafPolytopes(b)
+	center := b.Min.Mid(b.Max)
+	scale := b.Min.Dist(b.Max)
+
+	shapes := make([]LeafShape, len(graph.Leaves))
+	essentials.ConcurrentMap(0, len(graph.Leaves), func(i int) {
+		if graph.Leaves[i].Leaf {
+			shapes[i] = NewLeafShape(polytopes[i], center, scale)
+		}
+	})
+
+	res := &SliverFilterResult{}
+	removed := map[*SolidTree]bool{}
+	remove := func(i int) {
+		removed[graph.Leaves[i]] = true
+		res.LeavesRemoved++
+		res.VolumeRemoved += shapes[i].Volume
+	}
+
+	kept := make([]bool, len(graph.Leaves))
+	for i, leaf := range graph.Leaves {
+		if !leaf.Leaf {
+			continue
+		}
+		shape := shapes[i]
+		if shape.Inradius < s.MinInradius || shape.Volume < s.MinLeafVolume {
+			remove(i)
+			res.SliverLeaves++
+		} else {
+			kept[i] = true
+		}
+	}
+
+	if s.MinComponentVolume > 0 {
+		visited := make([]bool, len(graph.Leaves))
+		for start := range graph.Leaves {
+			if !kept[start] || visited[start] {
+				continue
+			}
+			visited[start] = true
+			component := []int{start}
+			var volume float64
+			for j := 0; j < len(component); j++ {
+				i := component[j]
+				volume += shapes[i].Volume
+				for _, face := range graph.Faces[i] {
+					for _, neighbor := range face.Neighbors {
+						if kept[neighbor] && !visited[neighbor] {
+							visited[neighbor] = true
+							component = append(component, neighbor)
+						}
+					}
+				}
+			}
+			if volume < s.MinComponentVolume {
+				res.ComponentsRemoved++
+				for _, i := range component {
+					remove(i)
+				}
+			}
+		}
+	}
+
+	res.Tree = &BoundedSolidTree{
+		Min:  b.Min,
+		Max:  b.Max,
+		Tree: b.Tree,
+	}
+	if len(removed) > 0 {
+		res.Tree.Tree = repairLeaves(b.Tree, removed, false)
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package treed
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestNewLeafShape(t *testing.T) {
+	min := model3d.XYZ(-1, -2, 0.5)
+	max := model3d.XYZ(2, 1, 1)
+	p := model3d.NewConvexPolytopeRect(min, max)
+	shape := NewLeafShape(p, model3d.Origin, 3)
+	if math.Abs(shape.Volume-4.5) > 1e-5 {
+		t.Errorf("expected volume 4.5 but got %f", shape.Volume)
+	}
+	if math.Abs(shape.Inradius-0.25) > 1e-5 {
+		t.Errorf("expected inradius 0.25 but got %f", shape.Inradius)
+	}
+
+	p = append(p, &model3d.LinearConstraint{Normal: model3d.X(1), Max: -2})
+	shape = NewLeafShape(p, model3d.Origin, 3)
+	if shape.Volume != 0 || shape.Inradius != 0 {
+		t.Errorf("expected empty shape but got %v", shape)
+	}
+}
+
+func TestSliverFilter(t *testing.T) {
+	bigSphere := &model3d.Sphere{Radius: 0.5}
+	smallSphere := &model3d.Sphere{Center: model3d.XYZ(0.8, 0.8, 0.8), Radius: 0.1}
+	sliver := &model3d.Rect{
+		MinVal: model3d.XYZ(-0.9, -0.9, -0.9),
+		MaxVal: model3d.XYZ(0.9, -0.88, 0.9),
+	}
+	solid := model3d.JoinedSolid{bigSphere, smallSphere, sliver}
+
+	min, max := model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1)
+	xs := make([]model3d.Coord3D, 50000)
+	ys := make([]bool, len(xs))
+	for i := range xs {
+		xs[i] = model3d.NewCoord3DRandBounds(min, max)
+		ys[i] = solid.Contains(xs[i])
+	}
+	for i := 0; i < 5000; i++ {
+		c := model3d.NewCoord3DRandBounds(sliver.MinVal, sliver.MaxVal)
+		xs = append(xs, c)
+		ys = append(ys, true)
+	}
+	axes := NewConstantAxisScheduleIcosphere(1).Init()
+	tree := &BoundedSolidTree{
+		Min:  min,
+		Max:  max,
+		Tree: GreedyTree[float64, model3d.Coord3D, bool](axes, xs, ys, EntropySplitLoss[float64]{}, 0, 10),
+	}
+	if !tree.Tree.Predict(sliver.MinVal.Mid(sliver.MaxVal)) ||
+		!tree.Tree.Predict(smallSphere.Center) {
+		t.Fatal("unexpected initial tree")
+	}
+
+	filter := &SliverFilter{MinInradius: 0.03, MinComponentVolume: 0.05}
+	result := filter.Filter(tree)
+	if result.SliverLeaves == 0 || result.ComponentsRemoved == 0 {
+		t.Errorf("unexpected result counts: %d slivers, %d components", result.SliverLeaves,
+			result.ComponentsRemoved)
+	}
+	if result.Tree.Tree.Predict(sliver.MinVal.Mid(sliver.MaxVal)) {
+		t.Error("sliver was not removed")
+	}
+	if result.Tree.Tree.Predict(smallSphere.Center) {
+		t.Error("small component was not removed")
+	}
+	if !result.Tree.Tree.Predict(model3d.Origin) {
+		t.Error("large component was removed")
+	}
+
+	// Estimate the removed volume with random samples.
+	var changed int
+	numSamples := 200000
+	for i := 0; i < numSamples; i++ {
+		c := model3d.NewCoord3DRandBounds(min, max)
+		if tree.Tree.Predict(c) != result.Tree.Tree.Predict(c) {
+			changed++
+		}
+	}
+	expected := 8 * float64(changed) / float64(numSamples)
+	if math.Abs(expected-result.VolumeRemoved) > 0.01+expected*0.1 {
+		t.Errorf("expected volume removed %f but got %f", expected, result.VolumeRemoved)
+	}
+}
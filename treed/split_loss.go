@@ -3,6 +3,7 @@ package treed
 import (
 	"math"
 
+	"github.com/unixpickle/essentials"
 	"golang.org/x/exp/constraints"
 )
 
@@ -45,10 +46,17 @@ type EntropySplitLoss[F comparable] struct {
 	// less than MinCount samples on the left or right will not be returned
 	// from MinimumSplit().
 	MinCount int
+
+	// PositiveWeight, if non-zero, is the weight of true labels relative to
+	// false labels. Values greater than 1 make it worse to misclassify true
+	// samples, which is useful for conservative (outer hull) trees, while
+	// values less than 1 do the opposite.
+	PositiveWeight float64
 }
 
 func (e EntropySplitLoss[F]) Predict(items List[bool]) bool {
-	return countTrue(items)*2 > items.Len
+	numTrue := countTrue(items)
+	return positiveWeight(e.PositiveWeight)*float64(numTrue) > float64(items.Len-numTrue)
 }
 
 func (e EntropySplitLoss[F]) SplitLoss(part1, part2 List[bool]) float64 {
@@ -64,10 +72,25 @@ func (e EntropySplitLoss[F]) SplitLoss(part1, part2 List[bool]) float64 {
 			rightSum++
 		}
 	}
-	return entropy(part1.Len, leftSum) + entropy(part2.Len, rightSum)
+	w := e.PositiveWeight
+	return weightedEntropy(part1.Len, leftSum, w) + weightedEntropy(part2.Len, rightSum, w)
 }
 
 func (e EntropySplitLoss[F]) MinimumSplit(sorted List[bool], thresholds List[F]) SplitInfo {
+	return minimumEntropySplit(sorted, thresholds, e.MinCount, e.PositiveWeight, nil)
+}
+
+// minimumEntropySplit finds the split with the lowest weighted entropy, plus
+// an optional penalty for splitting before each index.
+//
+// The penalty is only applied to splits with samples on both sides.
+func minimumEntropySplit[F comparable](
+	sorted List[bool],
+	thresholds List[F],
+	minCount int,
+	positiveWeight float64,
+	penalty func(i int) float64,
+) SplitInfo {
 	if sorted.Len != thresholds.Len {
 		panic("values and thresholds must have same length")
 	}
@@ -89,9 +112,13 @@ func (e EntropySplitLoss[F]) MinimumSplit(sorted List[bool], thresholds List[F])
 		rightCount := sorted.Len - i
 		split := SplitInfo{
 			Index: i,
-			Loss:  entropy(leftCount, leftSum) + entropy(rightCount, rightSum),
+			Loss: weightedEntropy(leftCount, leftSum, positiveWeight) +
+				weightedEntropy(rightCount, rightSum, positiveWeight),
+		}
+		if penalty != nil && i > 0 && i < sorted.Len {
+			split.Loss += penalty(i)
 		}
-		if (split.Loss < bestSplit.Loss && leftCount >= e.MinCount && rightCount >= e.MinCount) ||
+		if (split.Loss < bestSplit.Loss && leftCount >= minCount && rightCount >= minCount) ||
 			i == 0 {
 			bestSplit = split
 		}
@@ -100,6 +127,85 @@ func (e EntropySplitLoss[F]) MinimumSplit(sorted List[bool], thresholds List[F])
 	return bestSplit
 }
 
+// TraversalSplitLoss is a SplitLoss which adds a ray traversal cost to the
+// entropy of a split, in the spirit of the surface area heuristic used to
+// build bounding volume hierarchies.
+//
+// The cost of a split is proportional to the area of the splitting plane
+// within the node, relative to the average cross-section of the node, since
+// this estimates the fraction of rays through the node which must cross the
+// split. Cross-sections are estimated from the density of samples near the
+// threshold, so this is most accurate when samples are uniform in space.
+//
+// The cost is scaled by the number of samples so that it is comparable to the
+// entropy, which is a sum over samples.
+type TraversalSplitLoss[F constraints.Float] struct {
+	// MinCount is equivalent to EntropySplitLoss.MinCount.
+	MinCount int
+
+	// PositiveWeight is equivalent to EntropySplitLoss.PositiveWeight.
+	PositiveWeight float64
+
+	// Weight is the traversal cost of a split plane spanning an average
+	// cross-section of the node, in nats per sample.
+	// If zero, this is equivalent to EntropySplitLoss.
+	Weight float64
+
+	// Window is the fraction of samples used to estimate the density of
+	// samples around a threshold. If zero, 0.05 is used.
+	Window float64
+}
+
+func (t TraversalSplitLoss[F]) Predict(items List[bool]) bool {
+	return EntropySplitLoss[F]{PositiveWeight: t.PositiveWeight}.Predict(items)
+}
+
+// SplitLoss computes the entropy of the split.
+//
+// The traversal cost cannot be computed without thresholds, so it is not
+// included.
+func (t TraversalSplitLoss[F]) SplitLoss(part1, part2 List[bool]) float64 {
+	return EntropySplitLoss[F]{PositiveWeight: t.PositiveWeight}.SplitLoss(part1, part2)
+}
+
+func (t TraversalSplitLoss[F]) MinimumSplit(sorted List[bool], thresholds List[F]) SplitInfo {
+	var penalty func(i int) float64
+	if t.Weight != 0 {
+		penalty = func(i int) float64 {
+			return t.Weight * float64(sorted.Len) * t.relativeArea(thresholds, i)
+		}
+	}
+	return minimumEntropySplit(sorted, thresholds, t.MinCount, t.PositiveWeight, penalty)
+}
+
+// maxRelativeArea caps the result of relativeArea, so that clusters of
+// duplicate thresholds do not make nearby splits arbitrarily expensive.
+const maxRelativeArea = 10.0
+
+// relativeArea estimates the cross-sectional area of a split before index i,
+// relative to the average cross-section over the range of thresholds.
+//
+// The result is at most maxRelativeArea.
+func (t TraversalSplitLoss[F]) relativeArea(thresholds List[F], i int) float64 {
+	window := t.Window
+	if window == 0 {
+		window = 0.05
+	}
+	n := thresholds.Len
+	radius := essentials.MaxInt(1, int(window*float64(n)/2))
+	start := essentials.MaxInt(0, i-radius)
+	end := essentials.MinInt(n-1, i+radius-1)
+
+	totalRange := float64(thresholds.Get(n-1) - thresholds.Get(0))
+	localRange := float64(thresholds.Get(end) - thresholds.Get(start))
+	if localRange == 0 {
+		return maxRelativeArea
+	}
+	localDensity := float64(end-start) / localRange
+	meanDensity := float64(n-1) / totalRange
+	return math.Min(maxRelativeArea, localDensity/meanDensity)
+}
+
 func countTrue(list List[bool]) int {
 	var count int
 	for i := 0; i < list.Len; i++ {
@@ -121,6 +227,30 @@ func entropy(numPoints, numTrue int) float64 {
 		float64(numFalse)*logOrZero(fracFalse))
 }
 
+// weightedEntropy is like entropy, except that true samples are weighted by
+// w, or 1 if w is 0.
+func weightedEntropy(numPoints, numTrue int, w float64) float64 {
+	w = positiveWeight(w)
+	if w == 1 {
+		return entropy(numPoints, numTrue)
+	}
+	weightedTrue := w * float64(numTrue)
+	weightedFalse := float64(numPoints - numTrue)
+	total := weightedTrue + weightedFalse
+	if total == 0 {
+		return 0
+	}
+	return -(weightedTrue*logOrZero(weightedTrue/total) +
+		weightedFalse*logOrZero(weightedFalse/total))
+}
+
+func positiveWeight(w float64) float64 {
+	if w == 0 {
+		return 1
+	}
+	return w
+}
+
 func logOrZero(x float64) float64 {
 	if x == 0 {
 		return 0
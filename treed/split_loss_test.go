@@ -0,0 +1,131 @@
+package treed
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestTraversalSplitLossZeroWeight(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		n := rand.Intn(100) + 2
+		thresholds := make([]float64, n)
+		labels := make([]bool, n)
+		for j := range thresholds {
+			thresholds[j] = float64(rand.Intn(50))
+			labels[j] = rand.Intn(2) == 0
+		}
+		sort.Float64s(thresholds)
+		expected := EntropySplitLoss[float64]{MinCount: 2}.MinimumSplit(
+			NewListSlice(labels),
+			NewListSlice(thresholds),
+		)
+		actual := TraversalSplitLoss[float64]{MinCount: 2}.MinimumSplit(
+			NewListSlice(labels),
+			NewListSlice(thresholds),
+		)
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	}
+}
+
+func TestTraversalSplitLossDuplicates(t *testing.T) {
+	// A perfect split right next to a cluster of duplicate thresholds should
+	// not be overwhelmed by the traversal cost.
+	var thresholds []float64
+	for i := 0; i < 1000; i++ {
+		thresholds = append(thresholds, rand.Float64())
+	}
+	for i := 0; i < 200; i++ {
+		thresholds = append(thresholds, 0.499)
+	}
+	sort.Float64s(thresholds)
+	labels := make([]bool, len(thresholds))
+	expectedIndex := 0
+	for i, x := range thresholds {
+		labels[i] = x >= 0.5
+		if !labels[i] {
+			expectedIndex = i + 1
+		}
+	}
+	loss := TraversalSplitLoss[float64]{Weight: 0.01}
+	split := loss.MinimumSplit(NewListSlice(labels), NewListSlice(thresholds))
+	if split.Index != expectedIndex {
+		t.Errorf("expected split at %d but got %d", expectedIndex, split.Index)
+	}
+	for i := 1; i < len(thresholds); i++ {
+		if area := loss.relativeArea(NewListSlice(thresholds), i); area > maxRelativeArea {
+			t.Fatalf("relative area %f exceeds maximum", area)
+		}
+	}
+}
+
+func TestTraversalSplitLossRenderCost(t *testing.T) {
+	xs := make([]model3d.Coord3D, 20000)
+	ys := make([]bool, len(xs))
+	for i := range xs {
+		x := model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		xs[i] = x
+		ys[i] = x.Norm() < 0.7 || x.Dist(model3d.XYZ(0.8, 0.8, 0.8)) < 0.1
+	}
+	axes := NewConstantAxisScheduleIcosphere(1).Init()
+
+	var costs []float64
+	var leaves []int
+	for _, weight := range []float64{0, 0.02} {
+		loss := TraversalSplitLoss[float64]{Weight: weight}
+		tree := GreedyTree[float64, model3d.Coord3D, bool](axes, xs, ys, loss, 0, 8)
+		bounded := &BoundedSolidTree{
+			Min:  model3d.XYZ(-1, -1, -1),
+			Max:  model3d.XYZ(1, 1, 1),
+			Tree: tree,
+		}
+		costs = append(costs, EstimateRenderCost(bounded, 10000).BranchChanges)
+		leaves = append(leaves, tree.NumLeaves())
+	}
+	if costs[1] >= costs[0] {
+		t.Errorf("expected traversal cost to decrease, but got %f -> %f", costs[0], costs[1])
+	}
+	if leaves[1] >= leaves[0] {
+		t.Errorf("expected leaf count to decrease, but got %d -> %d", leaves[0], leaves[1])
+	}
+}
+
+func TestEntropySplitLossPositiveWeight(t *testing.T) {
+	xs := make([]model3d.Coord3D, 20000)
+	ys := make([]bool, len(xs))
+	for i := range xs {
+		x := model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		xs[i] = x
+		ys[i] = x.Norm() < 0.7
+	}
+	axes := NewConstantAxisScheduleIcosphere(1).Init()
+
+	var falseNegatives, falsePositives []int
+	for _, weight := range []float64{1, 10} {
+		loss := EntropySplitLoss[float64]{PositiveWeight: weight}
+		tree := GreedyTree[float64, model3d.Coord3D, bool](axes, xs, ys, loss, 0, 5)
+		var fn, fp int
+		for i, x := range xs {
+			pred := tree.Predict(x)
+			if ys[i] && !pred {
+				fn++
+			} else if !ys[i] && pred {
+				fp++
+			}
+		}
+		falseNegatives = append(falseNegatives, fn)
+		falsePositives = append(falsePositives, fp)
+	}
+	if falseNegatives[1] >= falseNegatives[0] {
+		t.Errorf("expected fewer false negatives, but got %d -> %d",
+			falseNegatives[0], falseNegatives[1])
+	}
+	if falsePositives[1] <= falsePositives[0] {
+		t.Errorf("expected more false positives, but got %d -> %d",
+			falsePositives[0], falsePositives[1])
+	}
+}
@@ -76,6 +76,31 @@ func (_ EqualityTAOLoss[T]) Loss(label, prediction T) float64 {
 	}
 }
 
+// WeightedBoolTAOLoss is like EqualityTAOLoss for boolean labels, except that
+// misclassifying a true label costs PositiveWeight rather than 1.
+//
+// Weights greater than 1 bias trees towards covering every true sample, as
+// in conservative (outer hull) trees, while weights less than 1 bias trees
+// towards covering only true samples (inner hulls).
+type WeightedBoolTAOLoss struct {
+	PositiveWeight float64
+}
+
+func (w WeightedBoolTAOLoss) Predict(items List[bool]) bool {
+	numTrue := countTrue(items)
+	return positiveWeight(w.PositiveWeight)*float64(numTrue) > float64(items.Len-numTrue)
+}
+
+func (w WeightedBoolTAOLoss) Loss(label, prediction bool) float64 {
+	if label == prediction {
+		return 0
+	} else if label {
+		return positiveWeight(w.PositiveWeight)
+	} else {
+		return 1
+	}
+}
+
 // SquaredErrorTAOLoss computes the squared error between the prediction and
 // the target, summed across dimensions.
 type SquaredErrorTAOLoss[F constraints.Float, C Coord[F, C]] struct{}
@@ -0,0 +1,138 @@
+package treed
+
+import (
+	"golang.org/x/exp/constraints"
+)
+
+// TAOProgress is the state of a TAORefiner in between iterations.
+//
+// It can be stored and restored to resume refinement, for example from a
+// checkpoint.
+type TAOProgress struct {
+	// Iteration is the number of completed TAO iterations.
+	Iteration int
+
+	// TestLoss is the test loss of the current tree, and BestTestLoss is the
+	// lowest test loss seen so far. StaleIterations is the number of
+	// iterations since BestTestLoss last improved.
+	TestLoss        float64
+	BestTestLoss    float64
+	StaleIterations int
+
+	// Done is set once refinement should stop.
+	Done bool
+}
+
+// A TAORefiner repeatedly applies TAO to a tree, stopping early if the
+// training loss stops decreasing or if the test loss does not improve for
+// Patience iterations.
+type TAORefiner[F constraints.Float, C Coord[F, C], T any] struct {
+	TAO *TAO[F, C, T]
+
+	// Iters is the maximum number of TAO iterations.
+	Iters int
+
+	// Patience, if non-zero, is the number of TAO iterations to allow without
+	// an improvement in test loss before stopping.
+	Patience int
+
+	// Logf, if non-nil, is used to log progress.
+	Logf func(format string, args ...any)
+}
+
+// Start creates the initial progress for refining a tree.
+//
+// The test set may be empty, in which case only the training loss is used
+// for early stopping.
+func (r *TAORefiner[F, C, T]) Start(
+	tree *Tree[F, C, T],
+	testCoords []C,
+	testLabels []T,
+) *TAOProgress {
+	var testLoss float64
+	if len(testCoords) > 0 {
+		testLoss = r.TAO.EvaluateLoss(tree, testCoords, testLabels)
+	}
+	return &TAOProgress{
+		TestLoss:     testLoss,
+		BestTestLoss: testLoss,
+		Done:         r.Iters <= 0,
+	}
+}
+
+// Step runs a single iteration of TAO and updates p.
+//
+// The returned tree is the refined tree, or the original tree if TAO did not
+// decrease the training loss. After the final iteration, p.Done is set.
+func (r *TAORefiner[F, C, T]) Step(
+	tree *Tree[F, C, T],
+	coords []C,
+	labels []T,
+	testCoords []C,
+	testLabels []T,
+	p *TAOProgress,
+) *Tree[F, C, T] {
+	if p.Done || p.Iteration >= r.Iters {
+		p.Done = true
+		return tree
+	}
+	hasTest := len(testCoords) > 0
+
+	result := r.TAO.Optimize(tree, coords, labels)
+	if result.NewLoss >= result.OldLoss {
+		if hasTest {
+			r.logf("no improvement at iteration %d: loss=%f test_loss=%f", p.Iteration,
+				result.OldLoss, p.TestLoss)
+		} else {
+			r.logf("no improvement at iteration %d: loss=%f", p.Iteration, result.OldLoss)
+		}
+		p.Done = true
+		return tree
+	}
+	p.Iteration++
+	if p.Iteration >= r.Iters {
+		p.Done = true
+	}
+
+	if !hasTest {
+		r.logf("TAO iteration %d: loss=%f->%f", p.Iteration-1, result.OldLoss, result.NewLoss)
+		return result.Tree
+	}
+
+	newTestLoss := r.TAO.EvaluateLoss(result.Tree, testCoords, testLabels)
+	r.logf("TAO iteration %d: loss=%f->%f test_loss=%f->%f", p.Iteration-1, result.OldLoss,
+		result.NewLoss, p.TestLoss, newTestLoss)
+	p.TestLoss = newTestLoss
+	if newTestLoss < p.BestTestLoss {
+		p.BestTestLoss = newTestLoss
+		p.StaleIterations = 0
+	} else {
+		p.StaleIterations++
+		if r.Patience != 0 && p.StaleIterations >= r.Patience {
+			r.logf("stopping after %d iterations without test improvement", p.StaleIterations)
+			p.Done = true
+		}
+	}
+	return result.Tree
+}
+
+// Refine runs TAO on a tree until refinement stops.
+func (r *TAORefiner[F, C, T]) Refine(
+	tree *Tree[F, C, T],
+	coords []C,
+	labels []T,
+	testCoords []C,
+	testLabels []T,
+) *Tree[F, C, T] {
+	p := r.Start(tree, testCoords, testLabels)
+	for !p.Done {
+		tree = r.Step(tree, coords, labels, testCoords, testLabels, p)
+	}
+	return tree
+}
+
+func (r *TAORefiner[F, C, T]) logf(format string, args ...any) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
@@ -94,6 +94,68 @@ func TestTAO(t *testing.T) {
 	}
 }
 
+func TestTAORefiner(t *testing.T) {
+	rand.Seed(1337)
+	points := make([]model3d.Coord3D, 5000)
+	for i := range points {
+		points[i] = model3d.NewCoord3DRandUniform()
+	}
+	labels := make([]bool, len(points))
+	flipped := make([]bool, len(points))
+	for i, x := range points {
+		labels[i] = x.Dist(model3d.XYZ(0.3, 0.7, 0.5)) < 0.5
+		flipped[i] = !labels[i]
+	}
+	axes := []model3d.Coord3D{model3d.X(1), model3d.Y(1), model3d.Z(1)}
+	tree := GreedyTree[float64, model3d.Coord3D, bool](
+		axes,
+		points,
+		labels,
+		EntropySplitLoss[float64]{},
+		0,
+		4,
+	)
+	tao := TAO[float64, model3d.Coord3D, bool]{
+		Loss:        EqualityTAOLoss[bool]{},
+		LR:          1e-2,
+		WeightDecay: 1e-3,
+		Momentum:    0.9,
+		Iters:       1000,
+	}
+
+	t.Run("Iters", func(t *testing.T) {
+		refiner := &TAORefiner[float64, model3d.Coord3D, bool]{TAO: &tao, Iters: 2}
+		p := refiner.Start(tree, points, labels)
+		newTree := tree
+		for !p.Done {
+			newTree = refiner.Step(newTree, points, labels, points, labels, p)
+		}
+		if p.Iteration < 1 || p.Iteration > 2 {
+			t.Errorf("unexpected iteration count: %d", p.Iteration)
+		}
+		if p.TestLoss >= tao.EvaluateLoss(tree, points, labels) {
+			t.Errorf("test loss did not decrease: %f", p.TestLoss)
+		}
+		if p.TestLoss != tao.EvaluateLoss(newTree, points, labels) {
+			t.Errorf("test loss %f does not match tree", p.TestLoss)
+		}
+	})
+
+	t.Run("Patience", func(t *testing.T) {
+		// The test labels are the opposite of the training labels, so the test
+		// loss gets worse whenever the training loss improves.
+		refiner := &TAORefiner[float64, model3d.Coord3D, bool]{TAO: &tao, Iters: 10, Patience: 1}
+		p := refiner.Start(tree, points, flipped)
+		for !p.Done {
+			refiner.Step(tree, points, labels, points, flipped, p)
+		}
+		if p.Iteration != 1 || p.StaleIterations != 1 {
+			t.Errorf("expected to stop after one iteration, but got %d (stale %d)",
+				p.Iteration, p.StaleIterations)
+		}
+	})
+}
+
 func BenchmarkTAO(b *testing.B) {
 	rand.Seed(1337)
 	points := make([]model3d.Coord3D, 10000)
@@ -53,6 +53,110 @@ func (t *Tree[F, C, T]) Predict(c C) T {
 	}
 }
 
+// FindLeaf returns the leaf node that c falls into.
+func (t *Tree[F, C, T]) FindLeaf(c C) *Tree[F, C, T] {
+	for !t.IsLeaf() {
+		if t.Axis.Dot(c) < t.Threshold {
+			t = t.LessThan
+		} else {
+			t = t.GreaterEqual
+		}
+	}
+	return t
+}
+
+// PredictPath is like Predict, but also returns the branch decisions that were
+// made to arrive at the leaf. A decision is false for the LessThan branch, and
+// true for the GreaterEqual branch.
+func (t *Tree[F, C, T]) PredictPath(c C) (T, []bool) {
+	var path []bool
+	for !t.IsLeaf() {
+		decision := t.Axis.Dot(c) >= t.Threshold
+		path = append(path, decision)
+		if decision {
+			t = t.GreaterEqual
+		} else {
+			t = t.LessThan
+		}
+	}
+	return t.Leaf, path
+}
+
+// Leaves returns the leaf nodes of the tree in depth-first order, where the
+// LessThan branch is always visited before the GreaterEqual branch.
+//
+// The position of a leaf in this list is its leaf index, which is stable as
+// long as the structure of the tree does not change.
+func (t *Tree[F, C, T]) Leaves() []*Tree[F, C, T] {
+	var res []*Tree[F, C, T]
+	t.iterateLeaves(func(leaf *Tree[F, C, T]) {
+		res = append(res, leaf)
+	})
+	return res
+}
+
+func (t *Tree[F, C, T]) iterateLeaves(f func(*Tree[F, C, T])) {
+	if t.IsLeaf() {
+		f(t)
+	} else {
+		t.LessThan.iterateLeaves(f)
+		t.GreaterEqual.iterateLeaves(f)
+	}
+}
+
+// LeafIndex returns the index of the leaf that c falls into, corresponding to
+// the order of Leaves().
+//
+// This must count the leaves of every skipped branch, so it may be as slow as
+// NumLeaves(). For many queries, use a LeafIndexer instead.
+func (t *Tree[F, C, T]) LeafIndex(c C) int {
+	var index int
+	for !t.IsLeaf() {
+		if t.Axis.Dot(c) < t.Threshold {
+			t = t.LessThan
+		} else {
+			index += t.LessThan.NumLeaves()
+			t = t.GreaterEqual
+		}
+	}
+	return index
+}
+
+// A LeafIndexer computes leaf indices for a tree in time proportional to the
+// depth of the tree, by precomputing the index of every leaf.
+//
+// The indices are only valid as long as the tree is not modified.
+type LeafIndexer[F constraints.Float, C Coord[F, C], T any] struct {
+	tree    *Tree[F, C, T]
+	indices map[*Tree[F, C, T]]int
+}
+
+// NewLeafIndexer creates a LeafIndexer for the tree.
+func NewLeafIndexer[F constraints.Float, C Coord[F, C], T any](
+	t *Tree[F, C, T],
+) *LeafIndexer[F, C, T] {
+	leaves := t.Leaves()
+	indices := make(map[*Tree[F, C, T]]int, len(leaves))
+	for i, leaf := range leaves {
+		indices[leaf] = i
+	}
+	return &LeafIndexer[F, C, T]{tree: t, indices: indices}
+}
+
+// LeafIndex is equivalent to Tree.LeafIndex().
+func (l *LeafIndexer[F, C, T]) LeafIndex(c C) int {
+	return l.indices[l.tree.FindLeaf(c)]
+}
+
+// Index returns the index of a leaf node, or -1 if the node is not a leaf of
+// the tree.
+func (l *LeafIndexer[F, C, T]) Index(leaf *Tree[F, C, T]) int {
+	if idx, ok := l.indices[leaf]; ok {
+		return idx
+	}
+	return -1
+}
+
 func (t *Tree[F, C, T]) String() string {
 	if t.IsLeaf() {
 		return fmt.Sprintf("return %v", t.Leaf)
@@ -28,3 +28,37 @@ func mustEqual(t *testing.T, x, y string) {
 		t.Fatalf("expected %s but got %s", x, y)
 	}
 }
+
+func TestTreeLeafIndex(t *testing.T) {
+	tree := testTree().Tree
+	leaves := tree.Leaves()
+	if len(leaves) != tree.NumLeaves() {
+		t.Fatalf("expected %d leaves but got %d", tree.NumLeaves(), len(leaves))
+	}
+	indexer := NewLeafIndexer(tree)
+	for i := 0; i < 1000; i++ {
+		c := model3d.NewCoord3DRandBounds(model3d.XYZ(-1, -1, -1), model3d.XYZ(1, 1, 1))
+		idx := tree.LeafIndex(c)
+		if leaves[idx] != tree.FindLeaf(c) {
+			t.Fatalf("leaf index %d does not match leaf for point %v", idx, c)
+		}
+		if indexed := indexer.LeafIndex(c); indexed != idx {
+			t.Fatalf("indexer gave %d but expected %d", indexed, idx)
+		}
+		pred, path := tree.PredictPath(c)
+		if pred != tree.Predict(c) {
+			t.Fatalf("unexpected prediction from path")
+		}
+		node := tree
+		for _, decision := range path {
+			if decision {
+				node = node.GreaterEqual
+			} else {
+				node = node.LessThan
+			}
+		}
+		if node != leaves[idx] {
+			t.Fatalf("path does not end at leaf %d", idx)
+		}
+	}
+}
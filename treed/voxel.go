@@ -0,0 +1,196 @@
+package treed
+
+import (
+	"math"
+	"sync"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// A VoxelGrid stores an occupancy value for every cell of a regular grid
+// within some bounds.
+//
+// Values range from 0 (empty) to 1 (fully occupied). They are stored with
+// the z index changing fastest and the x index changing slowest, matching a
+// C-order array of shape (Size[0], Size[1], Size[2]).
+type VoxelGrid struct {
+	Min  model3d.Coord3D
+	Max  model3d.Coord3D
+	Size [3]int
+	Data []float64
+}
+
+// NewVoxelGridTree converts a tree into a voxel grid covering its bounds.
+//
+// If exact is false, each voxel is 1 or 0 depending on the prediction at
+// its center. Otherwise, each voxel is the fraction of its volume which is
+// occupied, computed by clipping the occupied leaf polytopes to the voxel.
+func NewVoxelGridTree(b *BoundedSolidTree, size [3]int, exact bool) *VoxelGrid {
+	res := &VoxelGrid{
+		Min:  b.Min,
+		Max:  b.Max,
+		Size: size,
+		Data: make([]float64, size[0]*size[1]*size[2]),
+	}
+	if !exact {
+		essentials.ConcurrentMap(0, len(res.Data), func(i int) {
+			if b.Tree.Predict(res.VoxelCenter(res.Position(i))) {
+				res.Data[i] = 1
+			}
+		})
+		return res
+	}
+
+	var leaves []*BoxTree[bool]
+	var iterate func(box *BoxTree[bool])
+	iterate = func(box *BoxTree[bool]) {
+		if box.IsLeaf() {
+			leaves = append(leaves, box)
+		} else {
+			iterate(box.LessThan)
+			iterate(box.GreaterEqual)
+		}
+	}
+	iterate(NewBoxTree(b))
+	polytopes := LeafPolytopes(b)
+
+	var lock sync.Mutex
+	voxelVolume := res.VoxelSize().X * res.VoxelSize().Y * res.VoxelSize().Z
+	essentials.ConcurrentMap(0, len(leaves), func(i int) {
+		box := leaves[i]
+		if !box.Tree.Leaf || box.Empty() {
+			return
+		}
+		minIdx, maxIdx := res.indexRange(box.Min, box.Max)
+		values := map[int]float64{}
+		for x := minIdx[0]; x <= maxIdx[0]; x++ {
+			for y := minIdx[1]; y <= maxIdx[1]; y++ {
+				for z := minIdx[2]; z <= maxIdx[2]; z++ {
+					min, max := res.VoxelBounds(x, y, z)
+					volume := polytopeBoxVolume(polytopes[i], min, max)
+					if volume > 0 {
+						values[res.Index(x, y, z)] = volume / voxelVolume
+					}
+				}
+			}
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		for idx, value := range values {
+			res.Data[idx] += value
+		}
+	})
+	for i, x := range res.Data {
+		res.Data[i] = math.Min(1, x)
+	}
+	return res
+}
+
+// Index gets the index of a voxel in Data.
+func (v *VoxelGrid) Index(x, y, z int) int {
+	return z + v.Size[2]*(y+v.Size[1]*x)
+}
+
+// Position gets the voxel coordinates of an index in Data.
+func (v *VoxelGrid) Position(idx int) (x, y, z int) {
+	z = idx % v.Size[2]
+	idx /= v.Size[2]
+	y = idx % v.Size[1]
+	x = idx / v.Size[1]
+	return
+}
+
+// Get returns the value of a voxel, or 0 if the voxel is out of bounds.
+func (v *VoxelGrid) Get(x, y, z int) float64 {
+	if x < 0 || y < 0 || z < 0 || x >= v.Size[0] || y >= v.Size[1] || z >= v.Size[2] {
+		return 0
+	}
+	return v.Data[v.Index(x, y, z)]
+}
+
+// VoxelSize gets the dimensions of a single voxel.
+func (v *VoxelGrid) VoxelSize() model3d.Coord3D {
+	return v.Max.Sub(v.Min).Div(model3d.XYZ(
+		float64(v.Size[0]),
+		float64(v.Size[1]),
+		float64(v.Size[2]),
+	))
+}
+
+// VoxelBounds gets the bounding box of a voxel.
+func (v *VoxelGrid) VoxelBounds(x, y, z int) (min, max model3d.Coord3D) {
+	size := v.VoxelSize()
+	min = v.Min.Add(size.Mul(model3d.XYZ(float64(x), float64(y), float64(z))))
+	max = min.Add(size)
+	return
+}
+
+// VoxelCenter gets the center of a voxel.
+func (v *VoxelGrid) VoxelCenter(x, y, z int) model3d.Coord3D {
+	min, max := v.VoxelBounds(x, y, z)
+	return min.Mid(max)
+}
+
+// Contains checks if the voxel containing c is at least half occupied.
+//
+// This can be used as an oracle to fit a tree to the voxel grid.
+func (v *VoxelGrid) Contains(c model3d.Coord3D) bool {
+	idx := c.Sub(v.Min).Div(v.VoxelSize()).Array()
+	return v.Get(
+		int(math.Floor(idx[0])),
+		int(math.Floor(idx[1])),
+		int(math.Floor(idx[2])),
+	) >= 0.5
+}
+
+// indexRange gets the range of voxel indices overlapping a box, clipped to
+// the grid.
+func (v *VoxelGrid) indexRange(min, max model3d.Coord3D) (minIdx, maxIdx [3]int) {
+	size := v.VoxelSize().Array()
+	minArr, maxArr, gridMin := min.Array(), max.Array(), v.Min.Array()
+	for i := 0; i < 3; i++ {
+		minIdx[i] = essentials.MaxInt(0, int(math.Floor((minArr[i]-gridMin[i])/size[i])))
+		maxIdx[i] = essentials.MinInt(v.Size[i]-1, int(math.Floor((maxArr[i]-gridMin[i])/size[i])))
+	}
+	return
+}
+
+// polytopeBoxVolume computes the volume of the intersection of a polytope
+// and a box.
+func polytopeBoxVolume(p model3d.ConvexPolytope, min, max model3d.Coord3D) float64 {
+	var corners [8]model3d.Coord3D
+	for i := range corners {
+		c := min
+		if i&1 != 0 {
+			c.X = max.X
+		}
+		if i&2 != 0 {
+			c.Y = max.Y
+		}
+		if i&4 != 0 {
+			c.Z = max.Z
+		}
+		corners[i] = c
+	}
+	inside := true
+	for _, l := range p {
+		var numInside int
+		for _, c := range corners {
+			if l.Contains(c) {
+				numInside++
+			}
+		}
+		if numInside == 0 {
+			return 0
+		} else if numInside < len(corners) {
+			inside = false
+		}
+	}
+	if inside {
+		size := max.Sub(min)
+		return size.X * size.Y * size.Z
+	}
+	clipped := append(model3d.NewConvexPolytopeRect(min, max), p...)
+	return math.Abs(clipped.Mesh().Volume())
+}
@@ -0,0 +1,372 @@
+package treed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unixpickle/model3d/model3d"
+)
+
+// WriteVoxelsRaw writes the voxels of a grid as a dense array of bytes, in
+// the same order as VoxelGrid.Data, where 0 is empty and 255 is occupied.
+func WriteVoxelsRaw(w io.Writer, v *VoxelGrid) error {
+	data := make([]byte, len(v.Data))
+	for i, x := range v.Data {
+		data[i] = voxelByte(x)
+	}
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "write raw voxels")
+	}
+	return nil
+}
+
+// WriteSparseVoxelsRaw writes the non-empty voxels of a grid as a sequence
+// of little-endian records, each containing three int32 voxel indices
+// followed by a float32 value.
+func WriteSparseVoxelsRaw(w io.Writer, v *VoxelGrid) error {
+	bw := bufio.NewWriter(w)
+	for i, value := range v.Data {
+		if value == 0 {
+			continue
+		}
+		x, y, z := v.Position(i)
+		record := struct {
+			X, Y, Z int32
+			Value   float32
+		}{int32(x), int32(y), int32(z), float32(value)}
+		if err := binary.Write(bw, binary.LittleEndian, record); err != nil {
+			return errors.Wrap(err, "write sparse raw voxels")
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return errors.Wrap(err, "write sparse raw voxels")
+	}
+	return nil
+}
+
+// WriteVoxelsNPY writes the voxels of a grid as a NumPy float32 array of
+// shape (Size[0], Size[1], Size[2]).
+func WriteVoxelsNPY(w io.Writer, v *VoxelGrid) error {
+	data := make([]float32, len(v.Data))
+	for i, x := range v.Data {
+		data[i] = float32(x)
+	}
+	if err := writeNPY(w, v.Size[:], data); err != nil {
+		return errors.Wrap(err, "write voxels npy")
+	}
+	return nil
+}
+
+// WriteSparseVoxelsNPY writes the non-empty voxels of a grid as a NumPy
+// float32 array of shape (N, 4), where each row is (x, y, z, value).
+func WriteSparseVoxelsNPY(w io.Writer, v *VoxelGrid) error {
+	var data []float32
+	for i, value := range v.Data {
+		if value == 0 {
+			continue
+		}
+		x, y, z := v.Position(i)
+		data = append(data, float32(x), float32(y), float32(z), float32(value))
+	}
+	if err := writeNPY(w, []int{len(data) / 4, 4}, data); err != nil {
+		return errors.Wrap(err, "write sparse voxels npy")
+	}
+	return nil
+}
+
+// ReadVoxelsNPY reads a dense 3D NumPy array of voxels.
+//
+// Arrays may contain booleans, bytes (where 255 is occupied), or floats.
+// The resulting grid has unit voxels with a minimum at the origin.
+//
+// To avoid running out of memory on corrupt files, arrays may contain at
+// most maxNPYVoxels voxels.
+func ReadVoxelsNPY(r io.Reader) (*VoxelGrid, error) {
+	grid, err := readNPY(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read voxels npy")
+	}
+	return grid, nil
+}
+
+// WriteVoxelsVox writes the voxels of a grid which are at least half
+// occupied to a MagicaVoxel file.
+//
+// The grid may not be larger than 256 voxels along any axis.
+func WriteVoxelsVox(w io.Writer, v *VoxelGrid) error {
+	for _, size := range v.Size {
+		if size > 256 {
+			return errors.New("write voxels vox: grid is larger than 256 voxels")
+		}
+	}
+	var xyzi bytes.Buffer
+	var count int32
+	for i, value := range v.Data {
+		if value >= 0.5 {
+			x, y, z := v.Position(i)
+			xyzi.Write([]byte{byte(x), byte(y), byte(z), 1})
+			count++
+		}
+	}
+
+	var children bytes.Buffer
+	size := []int32{int32(v.Size[0]), int32(v.Size[1]), int32(v.Size[2])}
+	writeVoxChunk(&children, "SIZE", size)
+	writeVoxChunk(&children, "XYZI", count, xyzi.Bytes())
+
+	var out bytes.Buffer
+	out.WriteString("VOX ")
+	binary.Write(&out, binary.LittleEndian, int32(150))
+	out.WriteString("MAIN")
+	binary.Write(&out, binary.LittleEndian, []int32{0, int32(children.Len())})
+	out.Write(children.Bytes())
+	if _, err := w.Write(out.Bytes()); err != nil {
+		return errors.Wrap(err, "write voxels vox")
+	}
+	return nil
+}
+
+// ReadVoxelsVox reads the first model from a MagicaVoxel file.
+//
+// The resulting grid has unit voxels with a minimum at the origin.
+// As in MagicaVoxel, models may be at most 256 voxels along each axis.
+func ReadVoxelsVox(r io.Reader) (*VoxelGrid, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read voxels vox")
+	}
+	if len(data) < 8 || string(data[:4]) != "VOX " {
+		return nil, errors.New("read voxels vox: invalid header")
+	}
+	var grid *VoxelGrid
+	data = data[8:]
+	for len(data) >= 12 {
+		id := string(data[:4])
+		contentSize := int(binary.LittleEndian.Uint32(data[4:]))
+		childrenSize := int(binary.LittleEndian.Uint32(data[8:]))
+		data = data[12:]
+		if contentSize > len(data) {
+			return nil, errors.New("read voxels vox: truncated chunk")
+		}
+		content := data[:contentSize]
+		data = data[contentSize:]
+		if id == "MAIN" {
+			// Children are stored right after the (empty) content.
+			continue
+		}
+		switch id {
+		case "SIZE":
+			if grid != nil || len(content) < 12 {
+				break
+			}
+			var size [3]int
+			for i := range size {
+				size[i] = int(binary.LittleEndian.Uint32(content[i*4:]))
+				if size[i] < 1 || size[i] > 256 {
+					return nil, errors.New("read voxels vox: invalid size")
+				}
+			}
+			grid = &VoxelGrid{
+				Max:  model3d.XYZ(float64(size[0]), float64(size[1]), float64(size[2])),
+				Size: size,
+				Data: make([]float64, size[0]*size[1]*size[2]),
+			}
+		case "XYZI":
+			if grid == nil {
+				return nil, errors.New("read voxels vox: missing size chunk")
+			}
+			if len(content) < 4 {
+				return nil, errors.New("read voxels vox: truncated voxels")
+			}
+			count := int(binary.LittleEndian.Uint32(content))
+			if count > (len(content)-4)/4 {
+				return nil, errors.New("read voxels vox: truncated voxels")
+			}
+			for i := 0; i < count; i++ {
+				v := content[4+i*4:]
+				x, y, z := int(v[0]), int(v[1]), int(v[2])
+				if x < grid.Size[0] && y < grid.Size[1] && z < grid.Size[2] {
+					grid.Data[grid.Index(x, y, z)] = 1
+				}
+			}
+			return grid, nil
+		}
+		if childrenSize > len(data) {
+			return nil, errors.New("read voxels vox: truncated chunk")
+		}
+		data = data[childrenSize:]
+	}
+	return nil, errors.New("read voxels vox: missing voxel chunk")
+}
+
+func writeVoxChunk(w *bytes.Buffer, id string, content ...any) {
+	var buf bytes.Buffer
+	for _, x := range content {
+		if b, ok := x.([]byte); ok {
+			buf.Write(b)
+		} else {
+			binary.Write(&buf, binary.LittleEndian, x)
+		}
+	}
+	w.WriteString(id)
+	binary.Write(w, binary.LittleEndian, []int32{int32(buf.Len()), 0})
+	w.Write(buf.Bytes())
+}
+
+func voxelByte(x float64) byte {
+	return byte(math.Round(math.Max(0, math.Min(1, x)) * 255))
+}
+
+func writeNPY(w io.Writer, shape []int, data []float32) error {
+	shapeStrs := make([]string, len(shape))
+	for i, x := range shape {
+		shapeStrs[i] = strconv.Itoa(x)
+	}
+	shapeStr := strings.Join(shapeStrs, ", ")
+	if len(shape) == 1 {
+		shapeStr += ","
+	}
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%s), }", shapeStr)
+
+	// The total header length must be a multiple of 64, including the
+	// trailing newline.
+	for (10+len(header)+1)%64 != 0 {
+		header += " "
+	}
+	header += "\n"
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(bw, binary.LittleEndian, uint16(len(header)))
+	bw.WriteString(header)
+	if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+const (
+	maxNPYHeaderLen = 1 << 20
+	maxNPYVoxels    = 1 << 28
+)
+
+var (
+	npyDescrExpr   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortranExpr = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShapeExpr   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+func readNPY(r io.Reader) (*VoxelGrid, error) {
+	br := bufio.NewReader(r)
+	var magic [8]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, err
+	}
+	if string(magic[:6]) != "\x93NUMPY" {
+		return nil, errors.New("invalid magic")
+	}
+	var headerLen int
+	if magic[6] == 1 {
+		var n uint16
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	} else {
+		var n uint32
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	}
+	if headerLen > maxNPYHeaderLen {
+		return nil, errors.New("header is too large")
+	}
+	headerData := make([]byte, headerLen)
+	if _, err := io.ReadFull(br, headerData); err != nil {
+		return nil, err
+	}
+	header := string(headerData)
+
+	descr := npyDescrExpr.FindStringSubmatch(header)
+	fortran := npyFortranExpr.FindStringSubmatch(header)
+	shapeMatch := npyShapeExpr.FindStringSubmatch(header)
+	if descr == nil || fortran == nil || shapeMatch == nil {
+		return nil, errors.New("invalid header")
+	}
+	if fortran[1] == "True" {
+		return nil, errors.New("fortran order is not supported")
+	}
+	var size [3]int
+	var numDims int
+	for _, part := range strings.Split(shapeMatch[1], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if numDims == 3 {
+			return nil, errors.New("array must be 3D")
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse shape")
+		}
+		size[numDims] = n
+		numDims++
+	}
+	if numDims != 3 {
+		return nil, errors.New("array must be 3D")
+	}
+	count := 1
+	for _, n := range size {
+		if n < 1 {
+			return nil, errors.New("array dimensions must be positive")
+		} else if n > maxNPYVoxels/count {
+			return nil, errors.New("array is too large")
+		}
+		count *= n
+	}
+
+	grid := &VoxelGrid{
+		Max:  model3d.XYZ(float64(size[0]), float64(size[1]), float64(size[2])),
+		Size: size,
+		Data: make([]float64, count),
+	}
+	var err error
+	switch descr[1] {
+	case "|b1", "|u1":
+		raw := make([]byte, len(grid.Data))
+		if _, err = io.ReadFull(br, raw); err == nil {
+			scale := 1.0 / 255
+			if descr[1] == "|b1" {
+				scale = 1
+			}
+			for i, x := range raw {
+				grid.Data[i] = float64(x) * scale
+			}
+		}
+	case "<f4":
+		raw := make([]float32, len(grid.Data))
+		if err = binary.Read(br, binary.LittleEndian, raw); err == nil {
+			for i, x := range raw {
+				grid.Data[i] = float64(x)
+			}
+		}
+	case "<f8":
+		err = binary.Read(br, binary.LittleEndian, grid.Data)
+	default:
+		return nil, errors.Errorf("unsupported dtype: %s", descr[1])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return grid, nil
+}
@@ -0,0 +1,187 @@
+package treed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestNewVoxelGridTree(t *testing.T) {
+	tree := voxelTestTree()
+	size := [3]int{13, 11, 9}
+	exact := NewVoxelGridTree(tree, size, true)
+	centers := NewVoxelGridTree(tree, size, false)
+
+	voxelSize := exact.VoxelSize()
+	voxelVolume := voxelSize.X * voxelSize.Y * voxelSize.Z
+	var volume float64
+	for _, x := range exact.Data {
+		if x < 0 || x > 1 {
+			t.Fatalf("value out of range: %f", x)
+		}
+		volume += x * voxelVolume
+	}
+	if math.Abs(volume-0.5) > 1e-5 {
+		t.Errorf("expected volume 0.5 but got %f", volume)
+	}
+
+	for i, x := range centers.Data {
+		c := centers.VoxelCenter(centers.Position(i))
+		if expected := tree.Tree.Predict(c); expected != (x == 1) {
+			t.Fatalf("voxel %d: expected %v but got %f", i, expected, x)
+		}
+		if exact.Data[i] == 0 && x == 1 {
+			t.Fatalf("voxel %d has occupied center but no exact volume", i)
+		}
+	}
+
+	// Compare some exact voxels to sampled estimates.
+	for i, x := range exact.Data {
+		if x == 0 || x == 1 {
+			continue
+		}
+		min, max := exact.VoxelBounds(exact.Position(i))
+		var count int
+		numSamples := 20000
+		for j := 0; j < numSamples; j++ {
+			if tree.Tree.Predict(model3d.NewCoord3DRandBounds(min, max)) {
+				count++
+			}
+		}
+		if frac := float64(count) / float64(numSamples); math.Abs(frac-x) > 0.02 {
+			t.Fatalf("voxel %d: expected fraction around %f but got %f", i, frac, x)
+		}
+	}
+}
+
+func TestVoxelGridIO(t *testing.T) {
+	grid := NewVoxelGridTree(voxelTestTree(), [3]int{13, 11, 9}, true)
+
+	var buf bytes.Buffer
+	if err := WriteVoxelsNPY(&buf, grid); err != nil {
+		t.Fatal(err)
+	}
+	npyGrid, err := ReadVoxelsNPY(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if npyGrid.Size != grid.Size {
+		t.Fatalf("expected size %v but got %v", grid.Size, npyGrid.Size)
+	}
+	for i, x := range grid.Data {
+		if math.Abs(npyGrid.Data[i]-x) > 1e-6 {
+			t.Fatalf("voxel %d: expected %f but got %f", i, x, npyGrid.Data[i])
+		}
+	}
+
+	buf.Reset()
+	if err := WriteVoxelsVox(&buf, grid); err != nil {
+		t.Fatal(err)
+	}
+	voxGrid, err := ReadVoxelsVox(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voxGrid.Size != grid.Size {
+		t.Fatalf("expected size %v but got %v", grid.Size, voxGrid.Size)
+	}
+	for i, x := range grid.Data {
+		if (x >= 0.5) != (voxGrid.Data[i] == 1) {
+			t.Fatalf("voxel %d: expected %f but got %f", i, x, voxGrid.Data[i])
+		}
+	}
+
+	var numNonZero int
+	for _, x := range grid.Data {
+		if x != 0 {
+			numNonZero++
+		}
+	}
+	buf.Reset()
+	if err := WriteSparseVoxelsRaw(&buf, grid); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != numNonZero*16 {
+		t.Errorf("expected %d bytes but got %d", numNonZero*16, buf.Len())
+	}
+	buf.Reset()
+	if err := WriteVoxelsRaw(&buf, grid); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != len(grid.Data) {
+		t.Errorf("expected %d bytes but got %d", len(grid.Data), buf.Len())
+	}
+}
+
+func TestReadVoxelsVoxCorrupt(t *testing.T) {
+	grid := NewVoxelGridTree(voxelTestTree(), [3]int{13, 11, 9}, true)
+	var buf bytes.Buffer
+	if err := WriteVoxelsVox(&buf, grid); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	for i := 0; i < len(data); i++ {
+		if _, err := ReadVoxelsVox(bytes.NewReader(data[:i])); err == nil {
+			t.Fatalf("expected error for data truncated to %d bytes", i)
+		}
+	}
+
+	// Corrupted data should never cause a panic.
+	for i := 0; i < 10000; i++ {
+		corrupt := append([]byte{}, data...)
+		for j := 0; j < 1+rand.Intn(4); j++ {
+			idx := 8 + rand.Intn(len(corrupt)-8)
+			if rand.Intn(2) == 0 {
+				corrupt[idx] = byte(rand.Intn(256))
+			} else {
+				corrupt[idx] = 0xff
+			}
+		}
+		ReadVoxelsVox(bytes.NewReader(corrupt))
+	}
+}
+
+func TestReadVoxelsNPYBadShape(t *testing.T) {
+	for _, shape := range []string{
+		"(-1, 2, 2)",
+		"(0, 2, 2)",
+		"(2, 2)",
+		"(100000, 100000, 100000)",
+		"(9223372036854775807, 2, 2)",
+		"(4294967296, 4294967296, 4)",
+	} {
+		header := "{'descr': '|u1', 'fortran_order': False, 'shape': " + shape + ", }\n"
+		var buf bytes.Buffer
+		buf.WriteString("\x93NUMPY\x01\x00")
+		binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+		buf.WriteString(header)
+		buf.Write(make([]byte, 16))
+		if _, err := ReadVoxelsNPY(&buf); err == nil {
+			t.Errorf("expected error for shape %s", shape)
+		}
+	}
+}
+
+func voxelTestTree() *BoundedSolidTree {
+	box := &BoundedSolidTree{
+		Min:  model3d.XYZ(-0.5, -0.5, -0.25),
+		Max:  model3d.XYZ(0.5, 0.5, 0.25),
+		Tree: &SolidTree{Leaf: true},
+	}
+	rotation := model3d.NewMatrix3Rotation(model3d.XYZ(1, -2, 3).Normalize(), 0.7)
+	return &BoundedSolidTree{
+		Min: model3d.XYZ(-1, -1, -1),
+		Max: model3d.XYZ(1, 1, 1),
+		Tree: transformTree(
+			box.AsTree(false, model3d.X(1), model3d.Y(1), model3d.Z(1)),
+			rotation,
+			1,
+			model3d.Origin,
+		),
+	}
+}
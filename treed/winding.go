@@ -0,0 +1,233 @@
+package treed
+
+import (
+	"math"
+	"sort"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+const windingLeafSize = 8
+
+// A WindingNumberSolid is a model3d.Solid which contains the points where the
+// generalized winding number of a mesh is at least 0.5.
+//
+// Unlike a collider-based solid, this gives reasonable answers for meshes
+// with holes, self-intersections, or duplicated surfaces, since the winding
+// number degrades gracefully as the mesh deviates from being watertight.
+type WindingNumberSolid struct {
+	min  model3d.Coord3D
+	max  model3d.Coord3D
+	beta float64
+	root *windingNode
+}
+
+// NewWindingNumberSolid creates a WindingNumberSolid for a mesh.
+//
+// Winding numbers are computed hierarchically: clusters of triangles are
+// approximated by a single dipole when the query point is more than beta
+// times the cluster's radius away from its center. A beta of 2 gives errors
+// well below the 0.5 threshold in practice, while 0 computes exact winding
+// numbers at the cost of visiting every triangle.
+func NewWindingNumberSolid(mesh *model3d.Mesh, beta float64) *WindingNumberSolid {
+	res := &WindingNumberSolid{
+		min:  mesh.Min(),
+		max:  mesh.Max(),
+		beta: beta,
+	}
+	if tris := mesh.TriangleSlice(); len(tris) > 0 {
+		res.root = newWindingNodeTriangles(tris)
+	}
+	return res
+}
+
+// Min gets the minimum of the mesh's bounding box.
+func (w *WindingNumberSolid) Min() model3d.Coord3D {
+	return w.min
+}
+
+// Max gets the maximum of the mesh's bounding box.
+func (w *WindingNumberSolid) Max() model3d.Coord3D {
+	return w.max
+}
+
+// Contains checks if the winding number at c is at least 0.5.
+//
+// Points outside of the bounding box are never contained.
+func (w *WindingNumberSolid) Contains(c model3d.Coord3D) bool {
+	return model3d.InBounds(w, c) && w.WindingNumber(c) >= 0.5
+}
+
+// WindingNumber computes the (approximate) generalized winding number of the
+// mesh at a point, which is 1 inside and 0 outside of a closed mesh with
+// outward-facing normals.
+func (w *WindingNumberSolid) WindingNumber(c model3d.Coord3D) float64 {
+	if w.root == nil {
+		return 0
+	}
+	return w.root.SolidAngle(c, w.beta) / (4 * math.Pi)
+}
+
+type windingNode struct {
+	Center model3d.Coord3D
+	Radius float64
+
+	// AreaNormal is the sum of the area-scaled normals of the elements.
+	AreaNormal model3d.Coord3D
+
+	// Set for leaves.
+	Elements []windingElement
+
+	// Set for branches.
+	Children [2]*windingNode
+}
+
+func newWindingNodeTriangles(tris []*model3d.Triangle) *windingNode {
+	elements := make([]windingElement, len(tris))
+	for i, t := range tris {
+		elements[i] = windingTriangle{t}
+	}
+	return newWindingNode(elements)
+}
+
+func newWindingNode(elements []windingElement) *windingNode {
+	res := &windingNode{}
+	var totalArea float64
+	var weightedCenter, meanCenter model3d.Coord3D
+	for _, e := range elements {
+		area := e.Area()
+		centroid := e.Centroid()
+		totalArea += area
+		weightedCenter = weightedCenter.Add(centroid.Scale(area))
+		meanCenter = meanCenter.Add(centroid)
+		res.AreaNormal = res.AreaNormal.Add(e.AreaNormal())
+	}
+	if totalArea > 0 {
+		res.Center = weightedCenter.Scale(1 / totalArea)
+	} else {
+		res.Center = meanCenter.Scale(1 / float64(len(elements)))
+	}
+	for _, e := range elements {
+		res.Radius = math.Max(res.Radius, e.MaxDist(res.Center))
+	}
+
+	if len(elements) <= windingLeafSize {
+		res.Elements = elements
+		return res
+	}
+
+	// Split at the median centroid along the longest axis.
+	min, max := elements[0].Centroid(), elements[0].Centroid()
+	for _, e := range elements[1:] {
+		min = min.Min(e.Centroid())
+		max = max.Max(e.Centroid())
+	}
+	size := max.Sub(min)
+	axis := model3d.X(1)
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = model3d.Y(1)
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = model3d.Z(1)
+	}
+	elements = append([]windingElement{}, elements...)
+	sort.Slice(elements, func(i, j int) bool {
+		return axis.Dot(elements[i].Centroid()) < axis.Dot(elements[j].Centroid())
+	})
+	mid := len(elements) / 2
+	res.Children = [2]*windingNode{newWindingNode(elements[:mid]), newWindingNode(elements[mid:])}
+	return res
+}
+
+// SolidAngle computes the total signed solid angle of the elements as seen
+// from c.
+func (w *windingNode) SolidAngle(c model3d.Coord3D, beta float64) float64 {
+	if w.Elements != nil {
+		var res float64
+		for _, e := range w.Elements {
+			res += e.SolidAngle(c)
+		}
+		return res
+	}
+	diff := w.Center.Sub(c)
+	dist := diff.Norm()
+	if beta > 0 && dist > beta*w.Radius {
+		// Far-field dipole approximation.
+		return dipoleSolidAngle(w.AreaNormal, diff)
+	}
+	return w.Children[0].SolidAngle(c, beta) + w.Children[1].SolidAngle(c, beta)
+}
+
+// A windingElement is a piece of an oriented surface which contributes to a
+// generalized winding number.
+type windingElement interface {
+	Centroid() model3d.Coord3D
+	Area() float64
+	AreaNormal() model3d.Coord3D
+	MaxDist(c model3d.Coord3D) float64
+	SolidAngle(c model3d.Coord3D) float64
+}
+
+type windingTriangle struct {
+	*model3d.Triangle
+}
+
+func (w windingTriangle) Centroid() model3d.Coord3D {
+	return w.Triangle[0].Add(w.Triangle[1]).Add(w.Triangle[2]).Scale(1.0 / 3)
+}
+
+func (w windingTriangle) AreaNormal() model3d.Coord3D {
+	t := w.Triangle
+	return t[1].Sub(t[0]).Cross(t[2].Sub(t[0])).Scale(0.5)
+}
+
+func (w windingTriangle) MaxDist(c model3d.Coord3D) float64 {
+	t := w.Triangle
+	return math.Max(t[0].Dist(c), math.Max(t[1].Dist(c), t[2].Dist(c)))
+}
+
+// SolidAngle computes the signed solid angle of the triangle as seen from c,
+// using the formula of Van Oosterom and Strackee.
+//
+// The result is positive when the triangle's normal faces away from c.
+func (w windingTriangle) SolidAngle(c model3d.Coord3D) float64 {
+	t := w.Triangle
+	a, b, d := t[0].Sub(c), t[1].Sub(c), t[2].Sub(c)
+	la, lb, ld := a.Norm(), b.Norm(), d.Norm()
+	numerator := a.Dot(b.Cross(d))
+	denominator := la*lb*ld + a.Dot(b)*ld + a.Dot(d)*lb + b.Dot(d)*la
+	return 2 * math.Atan2(numerator, denominator)
+}
+
+// A windingDipole is an oriented point with an associated surface area.
+type windingDipole struct {
+	Point  model3d.Coord3D
+	Normal model3d.Coord3D
+	Weight float64
+}
+
+func (w windingDipole) Centroid() model3d.Coord3D {
+	return w.Point
+}
+
+func (w windingDipole) Area() float64 {
+	return w.Weight
+}
+
+func (w windingDipole) AreaNormal() model3d.Coord3D {
+	return w.Normal.Scale(w.Weight)
+}
+
+func (w windingDipole) MaxDist(c model3d.Coord3D) float64 {
+	return w.Point.Dist(c)
+}
+
+func (w windingDipole) SolidAngle(c model3d.Coord3D) float64 {
+	return dipoleSolidAngle(w.AreaNormal(), w.Point.Sub(c))
+}
+
+// dipoleSolidAngle approximates the solid angle of a small surface patch
+// with the given area-scaled normal, located at an offset from the viewer.
+func dipoleSolidAngle(areaNormal, offset model3d.Coord3D) float64 {
+	dist := offset.Norm()
+	return areaNormal.Dot(offset) / (dist * dist * dist)
+}
@@ -0,0 +1,98 @@
+package treed
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/model3d/model3d"
+)
+
+func TestWindingNumberSolid(t *testing.T) {
+	mesh := model3d.NewMeshIcosphere(model3d.XYZ(0.1, -0.2, 0.3), 1.0, 8)
+	collider := model3d.NewColliderSolid(model3d.MeshToCollider(mesh))
+	exact := NewWindingNumberSolid(mesh, 0)
+	approx := NewWindingNumberSolid(mesh, 2)
+
+	for i := 0; i < 1000; i++ {
+		c := model3d.NewCoord3DRandNorm().Add(mesh.Min().Mid(mesh.Max()))
+		expected := collider.Contains(c)
+		if math.Abs(c.Dist(model3d.XYZ(0.1, -0.2, 0.3))-1) < 0.02 {
+			// Avoid ambiguity from tessellation near the surface.
+			continue
+		}
+		exactWinding := exact.WindingNumber(c)
+		approxWinding := approx.WindingNumber(c)
+		if expected && math.Abs(exactWinding-1) > 1e-5 {
+			t.Errorf("point %v should have winding number 1 but got %f", c, exactWinding)
+		} else if !expected && math.Abs(exactWinding) > 1e-5 {
+			t.Errorf("point %v should have winding number 0 but got %f", c, exactWinding)
+		}
+		if math.Abs(approxWinding-exactWinding) > 0.05 {
+			t.Errorf("point %v has approximate winding number %f but exact %f", c,
+				approxWinding, exactWinding)
+		}
+		if approx.Contains(c) != expected {
+			t.Errorf("point %v should have containment %v", c, expected)
+		}
+	}
+}
+
+func TestWindingNumberSolidHoles(t *testing.T) {
+	mesh := model3d.NewMeshIcosphere(model3d.Origin, 1.0, 8)
+	mesh.Iterate(func(tri *model3d.Triangle) {
+		if tri.Normal().Z > 0.95 {
+			mesh.Remove(tri)
+		}
+	})
+	solid := NewWindingNumberSolid(mesh, 2)
+	for i := 0; i < 1000; i++ {
+		c := model3d.NewCoord3DRandNorm()
+		r := c.Norm()
+		if r < 0.8 && !solid.Contains(c) {
+			t.Errorf("point %v should be inside", c)
+		} else if r > 1.2 && solid.Contains(c) {
+			t.Errorf("point %v should be outside", c)
+		}
+	}
+}
+
+func TestDiagnoseMesh(t *testing.T) {
+	mesh := model3d.NewMeshIcosphere(model3d.Origin, 1.0, 4)
+	diag := DiagnoseMesh(mesh)
+	if !diag.Watertight() {
+		t.Errorf("closed mesh should be watertight: %+v", diag)
+	}
+	if diag.NumTriangles != mesh.NumTriangles() {
+		t.Errorf("expected %d triangles but got %d", mesh.NumTriangles(), diag.NumTriangles)
+	}
+
+	// Cut a hole at the top, and attach a dangling triangle to an edge at
+	// the bottom.
+	var top, bottom *model3d.Triangle
+	mesh.Iterate(func(tri *model3d.Triangle) {
+		if top == nil || tri.Normal().Z > top.Normal().Z {
+			top = tri
+		}
+		if bottom == nil || tri.Normal().Z < bottom.Normal().Z {
+			bottom = tri
+		}
+	})
+	topNeighbor := mesh.Neighbors(top)[0]
+	mesh.Remove(top)
+	mesh.Remove(topNeighbor)
+	mesh.Add(&model3d.Triangle{bottom[0], bottom[1], model3d.Z(-2)})
+
+	diag = DiagnoseMesh(mesh)
+	if diag.Watertight() {
+		t.Error("mesh with holes should not be watertight")
+	}
+	if diag.Holes != 2 {
+		t.Errorf("expected 2 holes but got %d", diag.Holes)
+	}
+	if diag.BoundaryEdges != 6 {
+		t.Errorf("expected 6 boundary edges but got %d", diag.BoundaryEdges)
+	}
+	if diag.NonManifoldEdges != 1 {
+		t.Errorf("expected 1 non-manifold edge but got %d", diag.NonManifoldEdges)
+	}
+}